@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"frappuccino/helper"
@@ -15,6 +16,7 @@ import (
 	"frappuccino/internal/dal"
 	"frappuccino/internal/handler"
 	"frappuccino/internal/service"
+	"frappuccino/models"
 
 	_ "github.com/lib/pq"
 )
@@ -40,16 +42,85 @@ func main() {
 	menuService := service.NewMenuService(menuRepo)
 	menuHandler := handler.NewMenuHandler(menuService)
 
+	priceRepo := dal.NewPriceRepository(db)
+	// PRICE_SCHEDULER_INTERVAL — как часто планировщик перепроверяет запланированные цены
+	intervalValue := config.GetEnv("PRICE_SCHEDULER_INTERVAL", "1m")
+	schedulerInterval, err := time.ParseDuration(intervalValue)
+	if err != nil || schedulerInterval <= 0 {
+		log.Fatal("Invalid PRICE_SCHEDULER_INTERVAL: ", intervalValue)
+	}
+	priceService := service.NewPriceService(priceRepo, schedulerInterval)
+	priceHandler := handler.NewPriceHandler(priceService)
+
+	taxRepo := dal.NewTaxRepository(db)
+	taxService := service.NewTaxService(taxRepo)
+	taxHandler := handler.NewTaxHandler(taxService)
+	// TAX_INCLUSIVE=true — цены меню уже включают налог; TAX_ROUNDING=line — округлять налог по позициям
+	taxSettings := service.TaxSettings{
+		Inclusive: config.GetEnv("TAX_INCLUSIVE", "false") == "true",
+		Rounding:  config.GetEnv("TAX_ROUNDING", models.TaxRoundingOrder),
+	}
+	if taxSettings.Rounding != models.TaxRoundingOrder && taxSettings.Rounding != models.TaxRoundingLine {
+		log.Fatal("Invalid TAX_ROUNDING: ", taxSettings.Rounding)
+	}
+
+	promotionRepo := dal.NewPromotionRepository(db)
+	promotionService := service.NewPromotionService(promotionRepo)
+	promotionHandler := handler.NewPromotionHandler(promotionService)
+
+	pricingRuleRepo := dal.NewPricingRuleRepository(db)
+	pricingRuleService := service.NewPricingRuleService(pricingRuleRepo)
+	pricingRuleHandler := handler.NewPricingRuleHandler(pricingRuleService)
+	// SHOP_TIMEZONE — часовой пояс кофейни, в нём проверяются правила цены
+	location, err := time.LoadLocation(config.GetEnv("SHOP_TIMEZONE", "Asia/Almaty"))
+	if err != nil {
+		log.Fatal("Invalid SHOP_TIMEZONE: ", err)
+	}
+
+	customerRepo := dal.NewCustomerRepository(db)
+
+	// LOYALTY_POINT_VALUE — сколько стоит балл при оплате; LOYALTY_POINTS_TTL — срок жизни баллов (0 — бессрочно)
+	pointValue := config.GetEnv("LOYALTY_POINT_VALUE", "0.01")
+	pointsTTL := config.GetEnv("LOYALTY_POINTS_TTL", "8760h")
+	var loyaltySettings service.LoyaltySettings
+	if loyaltySettings.PointValue, err = strconv.ParseFloat(pointValue, 64); err != nil || loyaltySettings.PointValue <= 0 {
+		log.Fatal("Invalid LOYALTY_POINT_VALUE: ", pointValue)
+	}
+	if loyaltySettings.PointsTTL, err = time.ParseDuration(pointsTTL); err != nil || loyaltySettings.PointsTTL < 0 {
+		log.Fatal("Invalid LOYALTY_POINTS_TTL: ", pointsTTL)
+	}
+	loyaltyRepo := dal.NewLoyaltyRepository(db)
+	loyaltyService := service.NewLoyaltyService(loyaltyRepo, loyaltySettings)
+	loyaltyHandler := handler.NewLoyaltyHandler(loyaltyService)
+
 	orderRepo := dal.NewOrderRepository(db)
-	orderService := service.NewOrderService(orderRepo, menuRepo)
+	// REQUIRE_FULL_PAYMENT=false разрешает закрывать неоплаченные заказы
+	requireFullPayment := config.GetEnv("REQUIRE_FULL_PAYMENT", "true") != "false"
+	orderService := service.NewOrderService(orderRepo, menuRepo, taxRepo, promotionRepo, pricingRuleRepo, location, customerRepo, loyaltySettings, loyaltyRepo,
+		requireFullPayment, taxSettings)
 	orderHandler := handler.NewOrderHandler(orderService)
 
+	customerService := service.NewCustomerService(customerRepo, orderRepo)
+	customerHandler := handler.NewCustomerHandler(customerService)
+
 	reportRepo := dal.NewReportRepository(db)
 	reportService := service.NewReportService(reportRepo)
 	reportHandler := handler.NewReportHandler(reportService)
 
+	giftCardRepo := dal.NewGiftCardRepository(db)
+	giftCardService := service.NewGiftCardService(giftCardRepo)
+	giftCardHandler := handler.NewGiftCardHandler(giftCardService)
+
+	paymentRepo := dal.NewPaymentRepository(db)
+	paymentService := service.NewPaymentService(paymentRepo, loyaltySettings)
+	paymentHandler := handler.NewPaymentHandler(paymentService)
+
+	idempotencyRepo := dal.NewIdempotencyRepository(db)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo)
+	idempotencyMiddleware := handler.NewIdempotencyMiddleware(idempotencyService)
+
 	mux := http.NewServeMux()
-	config.SetupRoutes(mux, orderHandler, menuHandler, inventoryHandler, reportHandler)
+	config.SetupRoutes(mux, orderHandler, menuHandler, inventoryHandler, reportHandler, paymentHandler, taxHandler, promotionHandler, pricingRuleHandler, priceHandler, customerHandler, loyaltyHandler, giftCardHandler, idempotencyMiddleware)
 
 	if *port < 1 || *port > 65535 {
 		log.Fatal("Error port")
@@ -64,6 +135,11 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// Фоновый планировщик применяет запланированные изменения цен
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go priceService.RunScheduler(schedulerCtx)
+
 	// Канал для обработки сигналов завершения работы
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
@@ -79,6 +155,7 @@ func main() {
 	// Ожидаем сигнала для остановки
 	<-stop
 	log.Println("Получен сигнал остановки, завершаем работу...")
+	stopScheduler()
 
 	// Корректное завершение работы сервера
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1,16 +1,49 @@
 DROP TABLE IF EXISTS orders CASCADE;
+DROP TABLE IF EXISTS customers CASCADE;
 DROP TABLE IF EXISTS order_items CASCADE;
 DROP TABLE IF EXISTS order_status_history CASCADE;
 DROP TABLE IF EXISTS menu_items CASCADE;
 DROP TABLE IF EXISTS menu_item_ingredients CASCADE;
+DROP TABLE IF EXISTS menu_item_variants CASCADE;
+DROP TABLE IF EXISTS menu_item_variant_ingredients CASCADE;
 DROP TABLE IF EXISTS price_history CASCADE;
+DROP TABLE IF EXISTS scheduled_price_changes CASCADE;
 DROP TABLE IF EXISTS inventory CASCADE;
 DROP TABLE IF EXISTS inventory_transaction CASCADE;
+DROP TABLE IF EXISTS inventory_recipes CASCADE;
+DROP TABLE IF EXISTS inventory_reservations CASCADE;
+DROP TABLE IF EXISTS ingredient_substitutes CASCADE;
+DROP TABLE IF EXISTS menu_extras CASCADE;
+DROP TABLE IF EXISTS modifier_groups CASCADE;
+DROP TABLE IF EXISTS modifiers CASCADE;
+DROP TABLE IF EXISTS bundle_slots CASCADE;
+DROP TABLE IF EXISTS bundle_slot_choices CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
+DROP TABLE IF EXISTS payments CASCADE;
+DROP TABLE IF EXISTS refunds CASCADE;
+DROP TABLE IF EXISTS refund_items CASCADE;
+DROP TABLE IF EXISTS refund_payments CASCADE;
+DROP TABLE IF EXISTS tax_rates CASCADE;
+DROP TABLE IF EXISTS order_taxes CASCADE;
+DROP TABLE IF EXISTS promotions CASCADE;
+DROP TABLE IF EXISTS order_discounts CASCADE;
+DROP TABLE IF EXISTS pricing_rules CASCADE;
+DROP TABLE IF EXISTS loyalty_rules CASCADE;
+DROP TABLE IF EXISTS loyalty_ledger CASCADE;
+DROP TABLE IF EXISTS gift_cards CASCADE;
+DROP TABLE IF EXISTS gift_card_ledger CASCADE;
 
 DO $$
 BEGIN
     IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'order_status') THEN
-        CREATE TYPE order_status AS ENUM ('open', 'updated', 'closed', 'cancelled');
+        CREATE TYPE order_status AS ENUM ('open', 'in_progress', 'ready', 'closed', 'cancelled', 'refunded');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'payment_method') THEN
+        CREATE TYPE payment_method AS ENUM ('cash', 'card', 'gift_card', 'loyalty_points', 'other');
     END IF;
 END $$;
 
@@ -21,10 +54,52 @@ BEGIN
     END IF;
 END $$;
 
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'order_type') THEN
+        CREATE TYPE order_type AS ENUM ('dine_in', 'takeaway');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'promotion_type') THEN
+        CREATE TYPE promotion_type AS ENUM ('percentage', 'fixed', 'buy_x_get_y');
+    END IF;
+END $$;
+
 DO $$
 BEGIN
     IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'transaction_type') THEN
-        CREATE TYPE transaction_type AS ENUM ('restock', 'use', 'adjustment');
+        CREATE TYPE transaction_type AS ENUM ('restock', 'use', 'adjustment', 'waste', 'production');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'item_size') THEN
+        CREATE TYPE item_size AS ENUM ('small', 'medium', 'large');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'reservation_status') THEN
+        CREATE TYPE reservation_status AS ENUM ('held', 'consumed', 'released');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'loyalty_entry_type') THEN
+        CREATE TYPE loyalty_entry_type AS ENUM ('earn', 'redeem', 'reverse', 'restore', 'expire');
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'gift_card_entry_type') THEN
+        CREATE TYPE gift_card_entry_type AS ENUM ('issue', 'top_up', 'redeem', 'refund');
     END IF;
 END $$;
 
@@ -34,16 +109,71 @@ CREATE TABLE menu_items (
     description TEXT,
     price DECIMAL(10, 2) NOT NULL CHECK (price > 0),
     categories VARCHAR[],
+    tax_category VARCHAR(50) NOT NULL DEFAULT 'drinks', -- см. tax_rates
+    sold_out BOOLEAN NOT NULL DEFAULT FALSE, -- снята с продажи вручную («86»), независимо от склада
+    version INT NOT NULL DEFAULT 1,
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Размерные варианты позиции меню со своей ценой и рецептом
+CREATE TABLE menu_item_variants (
+    id SERIAL PRIMARY KEY,
+    menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    size item_size NOT NULL,
+    price DECIMAL(10, 2) NOT NULL CHECK (price > 0),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (menu_item_id, size)
+);
+
+-- Правила цены по дням недели и времени (счастливые часы, утреннее предложение).
+-- Действуют на позицию menu_item_id или на категорию меню; время — по часовому поясу кофейни.
+-- days_of_week по ISO: 1 — понедельник … 7 — воскресенье, пустой массив — каждый день.
+-- start_time > end_time — окно через полночь.
+CREATE TABLE pricing_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    menu_item_id INT REFERENCES menu_items(id) ON DELETE CASCADE,
+    category VARCHAR(50),
+    days_of_week SMALLINT[] NOT NULL DEFAULT '{}',
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    percent_off DECIMAL(5, 2) CHECK (percent_off > 0 AND percent_off < 100),
+    fixed_price DECIMAL(10, 2) CHECK (fixed_price > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((menu_item_id IS NULL) <> (category IS NULL)),
+    CHECK ((percent_off IS NULL) <> (fixed_price IS NULL)),
+    CHECK (start_time <> end_time),
+    CHECK (days_of_week <@ ARRAY[1, 2, 3, 4, 5, 6, 7]::SMALLINT[])
+);
+
+-- Постоянные клиенты; preferences — индивидуальные предпочтения (молоко, сахар и т.п.)
+CREATE TABLE customers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(63) NOT NULL,
+    phone VARCHAR(20) UNIQUE,
+    email VARCHAR(100) UNIQUE,
+    preferences JSONB NOT NULL DEFAULT '{}'::JSONB,
+    version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
-    name VARCHAR(50) NOT NULL,
+    name VARCHAR(50) NOT NULL, -- имя гостя; у заказов постоянных клиентов — имя из customers
+    customer_id INT REFERENCES customers(id) ON DELETE SET NULL, -- NULL — гость без карточки клиента
     status order_status NOT NULL DEFAULT 'open',
+    order_type order_type NOT NULL DEFAULT 'dine_in',
+    subtotal DECIMAL(10, 2), -- сумма позиций; NULL у заказов, созданных до учёта налогов
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_inclusive BOOLEAN NOT NULL DEFAULT false, -- налог уже входил в цены меню
+    promo_code VARCHAR(50),
+    discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     total_amount DECIMAL(10, 2) NOT NULL CHECK (total_amount >= 0),
     special_instructions JSONB DEFAULT '{}'::JSONB,
+    version INT NOT NULL DEFAULT 1,
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
@@ -54,15 +184,28 @@ CREATE TABLE inventory (
     quantity DECIMAL NOT NULL CHECK (quantity >= 0),
     unit VARCHAR(50) NOT NULL,
     reorder_threshold DECIMAL CHECK (reorder_threshold >= 0),
+    allergens TEXT[] NOT NULL DEFAULT '{}',    -- см. models.Allergens
+    dietary_tags TEXT[] NOT NULL DEFAULT '{}', -- диеты, которым ингредиент подходит (vegan, vegetarian, ...)
+    version INT NOT NULL DEFAULT 1,
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
 CREATE TABLE order_items (
+    id SERIAL PRIMARY KEY,
     order_id INT REFERENCES orders(id) ON DELETE CASCADE,
     menu_item_id INT REFERENCES menu_items(id) ON DELETE CASCADE,
     quantity INT CHECK(quantity > 0),
     price DECIMAL(10, 2) NOT NULL CHECK (price > 0),
-    PRIMARY KEY (order_id, menu_item_id)
+    -- вариант нельзя удалить, пока на него ссылаются позиции заказов: иначе открытые
+    -- заказы молча перейдут на рецепт и цену базовой позиции
+    variant_id INT REFERENCES menu_item_variants(id) ON DELETE RESTRICT,
+    -- замены ингредиентов, добавки, модификаторы: {"substitutions": [...], "extras": {...}}
+    customizations JSONB NOT NULL DEFAULT '{}'::JSONB,
+    -- правило цены, действовавшее при расчёте; имя сохраняется на случай удаления правила
+    pricing_rule_id INT REFERENCES pricing_rules(id) ON DELETE SET NULL,
+    pricing_rule_name VARCHAR(100),
+    -- когда позиция последний раз пересчитывалась; NULL — в момент создания заказа
+    priced_at TIMESTAMPTZ
 );
 
 CREATE TABLE order_status_history (
@@ -70,15 +213,21 @@ CREATE TABLE order_status_history (
     order_id INT REFERENCES orders(id) ON DELETE CASCADE,
     status order_status NOT NULL DEFAULT 'open',
     notes TEXT,
+    changed_by VARCHAR(50),
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Примечание и автора перехода приложение передаёт через set_config
+-- (frappuccino.status_notes / frappuccino.status_actor) в той же транзакции
 CREATE OR REPLACE FUNCTION log_order_status_change()
 RETURNS TRIGGER AS $$
 BEGIN
     IF OLD.status IS DISTINCT FROM NEW.status THEN
-        INSERT INTO order_status_history(order_id, status, created_at)
-        VALUES (NEW.id, NEW.status, NOW());
+        INSERT INTO order_status_history(order_id, status, notes, changed_by, created_at)
+        VALUES (NEW.id, NEW.status,
+                NULLIF(current_setting('frappuccino.status_notes', true), ''),
+                NULLIF(current_setting('frappuccino.status_actor', true), ''),
+                NOW());
     END IF;
     RETURN NEW;
 END;
@@ -89,6 +238,16 @@ AFTER UPDATE ON orders
 FOR EACH ROW
 EXECUTE FUNCTION log_order_status_change();
 
+-- Рецепт заготовки (cold brew, сиропы): сколько ингредиента уходит на единицу заготовки.
+-- Ингредиент с рецептом — заготовка; в рецепт могут входить другие заготовки.
+CREATE TABLE inventory_recipes (
+    prepared_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (prepared_id, ingredient_id),
+    CHECK (prepared_id <> ingredient_id)
+);
+
 CREATE TABLE menu_item_ingredients (
     menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
     ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
@@ -96,12 +255,252 @@ CREATE TABLE menu_item_ingredients (
     PRIMARY KEY (menu_item_id, ingredient_id)
 );
 
+CREATE TABLE menu_item_variant_ingredients (
+    variant_id INT NOT NULL REFERENCES menu_item_variants(id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (variant_id, ingredient_id)
+);
+
+-- Допустимые замены ингредиентов (например, обычное молоко → овсяное)
+CREATE TABLE ingredient_substitutes (
+    ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    substitute_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (ingredient_id, substitute_id),
+    CHECK (ingredient_id <> substitute_id)
+);
+
+-- Добавки к любой позиции (дополнительный шот эспрессо и т.п.)
+CREATE TABLE menu_extras (
+    code VARCHAR(30) PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL NOT NULL CHECK (quantity > 0),
+    price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0
+);
+
+-- Группы модификаторов позиции меню (например, «Сироп: ваниль / карамель / без сиропа»)
+CREATE TABLE modifier_groups (
+    id SERIAL PRIMARY KEY,
+    menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    min_selections INT NOT NULL DEFAULT 0 CHECK (min_selections >= 0),
+    max_selections INT NOT NULL DEFAULT 1 CHECK (max_selections >= 1),
+    UNIQUE (menu_item_id, name),
+    CHECK (min_selections <= max_selections),
+    CHECK (NOT required OR min_selections >= 1)
+);
+
+-- Модификатор: наценка и, при необходимости, расход ингредиента на единицу позиции
+CREATE TABLE modifiers (
+    id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES modifier_groups(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    ingredient_id INT REFERENCES inventory(id) ON DELETE SET NULL,
+    quantity DECIMAL NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    UNIQUE (group_id, name)
+);
+
+-- Слоты комбо-набора: позиция bundle_id продаётся по своей цене и состоит
+-- из quantity штук позиции menu_item_id в каждом слоте. Позиция, входящая в набор, не удаляется.
+CREATE TABLE bundle_slots (
+    id SERIAL PRIMARY KEY,
+    bundle_id INT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    UNIQUE (bundle_id, name),
+    CHECK (bundle_id <> menu_item_id)
+);
+
+-- Замены позиции в слоте на выбор гостя (например, латте → капучино) с доплатой
+CREATE TABLE bundle_slot_choices (
+    slot_id INT NOT NULL REFERENCES bundle_slots(id) ON DELETE CASCADE,
+    menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE RESTRICT,
+    price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (price_delta >= 0),
+    PRIMARY KEY (slot_id, menu_item_id)
+);
+
+-- Оплаты заказа: заказ можно оплатить несколькими частями разными способами.
+-- amount — сумма, зачтённая в оплату; для наличных tendered — сколько дал гость, change_due — сдача;
+-- points — сколько баллов лояльности списано (только loyalty_points)
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    method payment_method NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    tendered DECIMAL(10, 2) CHECK (tendered >= amount),
+    change_due DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (change_due >= 0),
+    reference VARCHAR(100),
+    points INT CHECK (points > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((method = 'loyalty_points') = (points IS NOT NULL))
+);
+
+-- Ставки налогов по налоговой категории позиции меню и типу заказа.
+-- На одну категорию может действовать несколько налогов (например, НДС и городской сбор)
+CREATE TABLE tax_rates (
+    id SERIAL PRIMARY KEY,
+    tax_category VARCHAR(50) NOT NULL,
+    order_type order_type NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    rate DECIMAL(6, 4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+    UNIQUE (tax_category, order_type, name)
+);
+
+-- Налоги, начисленные на заказ (по одной строке на налог и ставку)
+CREATE TABLE order_taxes (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    rate DECIMAL(6, 4) NOT NULL,
+    taxable_amount DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL
+);
+
+-- Акции: скидка в процентах, фиксированная скидка или «купи X — получи Y».
+-- menu_item_id / category сужают акцию до позиции или категории меню, без них — на весь заказ.
+-- Акция с code — купон (применяется по promo_code заказа), без code — автоматическая.
+CREATE TABLE promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    type promotion_type NOT NULL,
+    value DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (value >= 0), -- проценты или сумма
+    menu_item_id INT REFERENCES menu_items(id) ON DELETE CASCADE,
+    category VARCHAR(50),
+    buy_quantity INT CHECK (buy_quantity > 0),
+    get_quantity INT CHECK (get_quantity > 0),
+    code VARCHAR(50) UNIQUE,
+    usage_limit INT CHECK (usage_limit > 0), -- NULL — без ограничения
+    valid_from TIMESTAMPTZ,
+    valid_to TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- удалённая акция больше не применяется, но купон остаётся у заказов, которые его уже приняли
+    deleted_at TIMESTAMPTZ,
+    CHECK (type <> 'percentage' OR value <= 100),
+    CHECK (type <> 'buy_x_get_y' OR (buy_quantity IS NOT NULL AND get_quantity IS NOT NULL)),
+    CHECK (valid_to IS NULL OR valid_from IS NULL OR valid_to > valid_from)
+);
+
+-- Скидки, применённые к заказу (по одной строке на акцию)
+CREATE TABLE order_discounts (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    promotion_id INT REFERENCES promotions(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    code VARCHAR(50),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    -- скидка баллами лояльности (promotion_id NULL): баллы списываются при закрытии заказа
+    points INT CHECK (points > 0)
+);
+
+-- Возвраты по закрытым заказам: полные или по отдельным позициям.
+-- restock — ингредиенты вернулись на склад (adjustment), иначе списаны как отходы (waste)
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount >= 0),
+    restock BOOLEAN NOT NULL DEFAULT false,
+    reason TEXT,
+    actor VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Возвращённые количества по позициям заказа
+CREATE TABLE refund_items (
+    id SERIAL PRIMARY KEY,
+    refund_id INT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity DECIMAL NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0
+);
+
+-- Возврат денег по исходным оплатам: одна строка на каждую оплату, с которой вернули деньги
+CREATE TABLE refund_payments (
+    id SERIAL PRIMARY KEY,
+    refund_id INT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    payment_id INT NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    -- чем возвращено, если не тем же способом (оплата истёкшей подарочной картой — наличными)
+    refunded_as payment_method
+);
+
+-- Подарочные карты: balance — текущий остаток, равен сумме amount в gift_card_ledger.
+-- После expires_at картой нельзя платить и её нельзя пополнить
+CREATE TABLE gift_cards (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    initial_amount DECIMAL(10, 2) NOT NULL CHECK (initial_amount > 0),
+    balance DECIMAL(10, 2) NOT NULL CHECK (balance >= 0),
+    customer_id INT REFERENCES customers(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Движение денег по карте: выпуск, пополнение, оплата заказа (отрицательная сумма)
+-- и возврат на карту при возврате заказа
+CREATE TABLE gift_card_ledger (
+    id SERIAL PRIMARY KEY,
+    gift_card_id INT NOT NULL REFERENCES gift_cards(id) ON DELETE CASCADE,
+    entry_type gift_card_entry_type NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount <> 0),
+    order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Правила начисления баллов лояльности при закрытии заказа клиента:
+-- без category — points баллов за каждую оплаченную деньгами единицу суммы заказа,
+-- с category — points баллов за каждую позицию этой категории меню. Правила суммируются.
+CREATE TABLE loyalty_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    category VARCHAR(50),
+    points DECIMAL(10, 2) NOT NULL CHECK (points > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Журнал баллов клиента; баланс — сумма points. Начисления (earn, restore) — партии
+-- со сроком expires_at, remaining — ещё не потраченный остаток партии. Списания
+-- (redeem, reverse, expire) уменьшают remaining партий, начиная с ближайших к сгоранию.
+CREATE TABLE loyalty_ledger (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+    entry_type loyalty_entry_type NOT NULL,
+    points INT NOT NULL CHECK (points <> 0),
+    remaining INT NOT NULL DEFAULT 0 CHECK (remaining >= 0),
+    expires_at TIMESTAMPTZ,
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Ключи идемпотентности: повтор запроса с тем же ключом возвращает сохранённый ответ
+CREATE TABLE idempotency_keys (
+    idempotency_key VARCHAR(255) NOT NULL,
+    endpoint VARCHAR(100) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT NOT NULL,
+    response_body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (idempotency_key, endpoint)
+);
+
 CREATE TABLE inventory_transaction (
     id SERIAL PRIMARY KEY,
     inventory_id INT REFERENCES inventory(id) ON DELETE CASCADE,
     transaction_type transaction_type NOT NULL DEFAULT 'use',
     quantity DECIMAL NOT NULL,
     notes TEXT,
+    -- заказ, при закрытии которого списано (use) или при возврате которого возвращено
+    -- (adjustment, waste): возврат отменяет именно эти списания
+    order_id INT REFERENCES orders(id) ON DELETE SET NULL,
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
@@ -109,14 +508,17 @@ CREATE OR REPLACE FUNCTION log_inventory_change()
 RETURNS TRIGGER AS $$
 BEGIN
     IF OLD.quantity IS DISTINCT FROM NEW.quantity THEN
-        INSERT INTO inventory_transaction(inventory_id, transaction_type, quantity, notes, created_at)
+        INSERT INTO inventory_transaction(inventory_id, transaction_type, quantity, notes, order_id, created_at)
         VALUES (NEW.id, 
-                CASE 
-                    WHEN NEW.quantity > OLD.quantity THEN 'restock'::transaction_type 
-                    ELSE 'use'::transaction_type 
-                END,
+                -- Тип и примечание можно передать через set_config (например, возврат на склад — adjustment)
+                COALESCE(NULLIF(current_setting('frappuccino.inventory_txn_type', true), '')::transaction_type,
+                    CASE 
+                        WHEN NEW.quantity > OLD.quantity THEN 'restock'::transaction_type 
+                        ELSE 'use'::transaction_type 
+                    END),
                 ABS(NEW.quantity - OLD.quantity),
-                'Auto update from inventory change',
+                COALESCE(NULLIF(current_setting('frappuccino.inventory_notes', true), ''), 'Auto update from inventory change'),
+                NULLIF(current_setting('frappuccino.inventory_order_id', true), '')::INT,
                 NOW());
     END IF;
     RETURN NEW;
@@ -131,12 +533,25 @@ EXECUTE FUNCTION log_inventory_change();
 CREATE TABLE price_history (
     id SERIAL PRIMARY KEY,
     menu_item_id INT REFERENCES menu_items(id) ON DELETE CASCADE,
+    variant_id INT REFERENCES menu_item_variants(id) ON DELETE CASCADE, -- NULL — базовая цена позиции
     price DECIMAL(10, 2) NOT NULL,
     effective_from TIMESTAMPTZ DEFAULT NOW(),
     effective_to TIMESTAMPTZ,
     change_reason TEXT
 );
 
+-- Запланированные изменения цены позиции меню; applied_at IS NULL — ещё не применено.
+-- Применяет фоновый планировщик сервера, когда наступает effective_at
+CREATE TABLE scheduled_price_changes (
+    id SERIAL PRIMARY KEY,
+    menu_item_id INT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    price DECIMAL(10, 2) NOT NULL CHECK (price > 0),
+    effective_at TIMESTAMPTZ NOT NULL,
+    reason TEXT NOT NULL,
+    applied_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 CREATE OR REPLACE FUNCTION log_price_change()
 RETURNS TRIGGER AS $$
 BEGIN
@@ -144,11 +559,13 @@ BEGIN
         -- Закрываем старую запись
         UPDATE price_history
         SET effective_to = NOW()
-        WHERE menu_item_id = NEW.id AND effective_to IS NULL;
+        WHERE menu_item_id = NEW.id AND variant_id IS NULL AND effective_to IS NULL;
 
         -- Добавляем новую запись
+        -- Причину передаёт приложение через set_config (плановая смена цены)
         INSERT INTO price_history(menu_item_id, price, effective_from, change_reason)
-        VALUES (NEW.id, NEW.price, NOW(), 'Auto update from menu_items');
+        VALUES (NEW.id, NEW.price, NOW(),
+                COALESCE(NULLIF(current_setting('frappuccino.price_change_reason', true), ''), 'Auto update from menu_items'));
     END IF;
     RETURN NEW;
 END;
@@ -159,6 +576,71 @@ AFTER UPDATE OF price ON menu_items
 FOR EACH ROW
 EXECUTE FUNCTION log_price_change();
 
+CREATE OR REPLACE FUNCTION log_variant_price_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO price_history(menu_item_id, variant_id, price, effective_from, change_reason)
+        VALUES (NEW.menu_item_id, NEW.id, NEW.price, NOW(), 'Initial variant price');
+    ELSIF OLD.price IS DISTINCT FROM NEW.price THEN
+        UPDATE price_history
+        SET effective_to = NOW()
+        WHERE variant_id = NEW.id AND effective_to IS NULL;
+
+        INSERT INTO price_history(menu_item_id, variant_id, price, effective_from, change_reason)
+        VALUES (NEW.menu_item_id, NEW.id, NEW.price, NOW(), 'Auto update from menu_item_variants');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER variant_price_change_trigger
+AFTER INSERT OR UPDATE OF price ON menu_item_variants
+FOR EACH ROW
+EXECUTE FUNCTION log_variant_price_change();
+
+-- Версия строки для оптимистичной блокировки (ETag / If-Match):
+-- увеличивается при любом изменении, в том числе сменой статуса или списанием
+CREATE OR REPLACE FUNCTION bump_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_version_trigger
+BEFORE UPDATE ON orders
+FOR EACH ROW
+EXECUTE FUNCTION bump_version();
+
+CREATE TRIGGER menu_items_version_trigger
+BEFORE UPDATE ON menu_items
+FOR EACH ROW
+EXECUTE FUNCTION bump_version();
+
+CREATE TRIGGER customers_version_trigger
+BEFORE UPDATE ON customers
+FOR EACH ROW
+EXECUTE FUNCTION bump_version();
+
+CREATE TRIGGER inventory_version_trigger
+BEFORE UPDATE ON inventory
+FOR EACH ROW
+EXECUTE FUNCTION bump_version();
+
+-- Резерв ингредиентов под открытые заказы: ставится при создании заказа,
+-- списывается при закрытии, снимается при отмене (при удалении заказа — каскадно)
+CREATE TABLE inventory_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL NOT NULL CHECK (quantity > 0),
+    status reservation_status NOT NULL DEFAULT 'held',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 -- Создание индексов
 -- Индекс для поиска по категориям меню
 CREATE INDEX idx_menu_items_categories ON menu_items USING GIN (categories);
@@ -172,33 +654,103 @@ CREATE INDEX idx_orders_status ON orders (status);
 -- Составной индекс для поиска заказов за определенный период
 CREATE INDEX idx_orders_created_status ON orders (created_at, status);
 
+-- Индекс для истории заказов клиента
+CREATE INDEX idx_orders_customer ON orders (customer_id);
+
 -- Индекс для быстрого поиска ингредиентов, которые скоро закончатся
 CREATE INDEX idx_inventory_reorder ON inventory (reorder_threshold, quantity);
 
 -- Индекс для поиска транзакций по типу
 CREATE INDEX idx_inventory_transaction_type ON inventory_transaction (transaction_type);
 
-INSERT INTO inventory (ingredient_name, quantity, unit, reorder_threshold, updated_at) VALUES
-('Coffee beans', 10.0, 'kg', 2.0, NOW()),
-('Milk', 25.0, 'l', 5.0, NOW()),
-('Sugar', 8.0, 'kg', 1.5, NOW()),
-('Chocolate syrup', 5.0, 'l', 1.0, NOW()),
-('Vanilla syrup', 4.5, 'l', 1.0, NOW()),
-('Caramel syrup', 4.0, 'l', 1.0, NOW()),
-('Cream', 10.0, 'l', 2.0, NOW()),
-('Cocoa powder', 3.0, 'kg', 0.5, NOW()),
-('Cinnamon', 1.0, 'kg', 0.2, NOW()),
-('Water', 100.0, 'l', 20.0, NOW()),
-('Black tea', 2.0, 'kg', 0.5, NOW()),
-('Green tea', 1.5, 'kg', 0.5, NOW()),
-('Mint', 0.5, 'kg', 0.1, NOW()),
-('Lemon', 3.0, 'kg', 0.7, NOW()),
-('Ginger', 1.0, 'kg', 0.2, NOW()),
-('Honey', 2.5, 'kg', 0.5, NOW()),
-('Whipped cream', 3.0, 'l', 1.0, NOW()),
-('Soy milk', 5.0, 'l', 1.0, NOW()),
-('Almond milk', 5.0, 'l', 1.0, NOW()),
-('Coconut milk', 4.0, 'l', 1.0, NOW());
+-- Заготовки, в которые входит ингредиент (проверка циклов в рецептах)
+CREATE INDEX idx_inventory_recipes_ingredient ON inventory_recipes (ingredient_id);
+
+-- Индекс для загрузки позиций заказа
+CREATE INDEX idx_order_items_order ON order_items (order_id);
+
+-- Индекс для подсчёта зарезервированного количества ингредиента
+CREATE INDEX idx_inventory_reservations_held ON inventory_reservations (ingredient_id) WHERE status = 'held';
+
+-- Индекс для загрузки модификаторов группы
+CREATE INDEX idx_modifiers_group ON modifiers (group_id);
+
+-- Поиск наборов, в которые входит позиция (удаление позиции, отчёт по выручке)
+CREATE INDEX idx_bundle_slots_bundle ON bundle_slots (bundle_id);
+CREATE INDEX idx_bundle_slots_menu_item ON bundle_slots (menu_item_id);
+CREATE INDEX idx_bundle_slot_choices_menu_item ON bundle_slot_choices (menu_item_id);
+
+-- Индекс для очистки устаревших ключей идемпотентности
+CREATE INDEX idx_idempotency_keys_created ON idempotency_keys (created_at);
+
+-- Индекс для подсчёта оплаченной суммы заказа
+CREATE INDEX idx_payments_order ON payments (order_id);
+
+CREATE INDEX idx_order_taxes_order ON order_taxes (order_id);
+CREATE INDEX idx_order_discounts_order ON order_discounts (order_id);
+CREATE INDEX idx_order_discounts_promotion ON order_discounts (promotion_id);
+
+-- Индексы для подсчёта уже возвращённого по заказу, позиции и оплате
+CREATE INDEX idx_refunds_order ON refunds (order_id);
+CREATE INDEX idx_refund_items_order_item ON refund_items (order_item_id);
+CREATE INDEX idx_refund_payments_payment ON refund_payments (payment_id);
+
+-- Индексы для истории карты и поиска её оплаты при возврате
+CREATE INDEX idx_gift_card_ledger_card ON gift_card_ledger (gift_card_id, created_at);
+CREATE INDEX idx_gift_card_ledger_payment ON gift_card_ledger (payment_id);
+
+-- Индексы для журнала баллов клиента и его непотраченных партий
+CREATE INDEX idx_loyalty_ledger_customer ON loyalty_ledger (customer_id, created_at);
+CREATE INDEX idx_loyalty_ledger_lots ON loyalty_ledger (customer_id, expires_at) WHERE remaining > 0;
+CREATE INDEX idx_loyalty_ledger_order ON loyalty_ledger (order_id);
+
+-- Индекс для планировщика: ближайшие неприменённые изменения цены
+CREATE INDEX idx_scheduled_price_changes_pending ON scheduled_price_changes (effective_at) WHERE applied_at IS NULL;
+
+INSERT INTO inventory (ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags, updated_at) VALUES
+('Coffee beans', 10.0, 'kg', 2.0, '{}', '{vegan,vegetarian}', NOW()),
+('Milk', 25.0, 'l', 5.0, '{dairy}', '{vegetarian}', NOW()),
+('Sugar', 8.0, 'kg', 1.5, '{}', '{vegan,vegetarian}', NOW()),
+('Chocolate syrup', 5.0, 'l', 1.0, '{dairy}', '{vegetarian}', NOW()),
+('Vanilla syrup', 4.5, 'l', 1.0, '{}', '{vegan,vegetarian}', NOW()),
+('Caramel syrup', 4.0, 'l', 1.0, '{dairy}', '{vegetarian}', NOW()),
+('Cream', 10.0, 'l', 2.0, '{dairy}', '{vegetarian}', NOW()),
+('Cocoa powder', 3.0, 'kg', 0.5, '{}', '{vegan,vegetarian}', NOW()),
+('Cinnamon', 1.0, 'kg', 0.2, '{}', '{vegan,vegetarian}', NOW()),
+('Water', 100.0, 'l', 20.0, '{}', '{vegan,vegetarian}', NOW()),
+('Black tea', 2.0, 'kg', 0.5, '{}', '{vegan,vegetarian}', NOW()),
+('Green tea', 1.5, 'kg', 0.5, '{}', '{vegan,vegetarian}', NOW()),
+('Mint', 0.5, 'kg', 0.1, '{}', '{vegan,vegetarian}', NOW()),
+('Lemon', 3.0, 'kg', 0.7, '{}', '{vegan,vegetarian}', NOW()),
+('Ginger', 1.0, 'kg', 0.2, '{}', '{vegan,vegetarian}', NOW()),
+('Honey', 2.5, 'kg', 0.5, '{}', '{vegetarian}', NOW()),
+('Whipped cream', 3.0, 'l', 1.0, '{dairy}', '{vegetarian}', NOW()),
+('Soy milk', 5.0, 'l', 1.0, '{soy}', '{vegan,vegetarian}', NOW()),
+('Almond milk', 5.0, 'l', 1.0, '{nuts}', '{vegan,vegetarian}', NOW()),
+('Coconut milk', 4.0, 'l', 1.0, '{}', '{vegan,vegetarian}', NOW()),
+('Oat milk', 5.0, 'l', 1.0, '{gluten}', '{vegan,vegetarian}', NOW()),
+('Croissant', 40, 'pcs', 10, '{gluten,dairy,eggs}', '{vegetarian}', NOW()),
+('Cold brew', 4.0, 'l', 1.0, '{}', '{}', NOW()),
+('Simple syrup', 1.5, 'l', 0.5, '{}', '{}', NOW()),
+('Vanilla sweet cream', 1.0, 'l', 0.3, '{}', '{}', NOW());
+
+-- Prepared ingredients made in batches (per 1 unit of the prepared ingredient);
+-- their allergens and dietary tags are rolled up from these recipes
+INSERT INTO inventory_recipes (prepared_id, ingredient_id, quantity) VALUES
+(23, 1, 0.08), (23, 10, 1.0),                 -- Cold brew: coffee beans, water
+(24, 3, 0.5), (24, 10, 0.5),                  -- Simple syrup: sugar, water
+(25, 7, 0.7), (25, 24, 0.2), (25, 5, 0.1);    -- Vanilla sweet cream: cream, simple syrup, vanilla syrup
+
+-- Substitutions and extras
+INSERT INTO ingredient_substitutes (ingredient_id, substitute_id, price_delta) VALUES
+(2, 18, 0.50), -- Milk → Soy milk
+(2, 19, 0.50), -- Milk → Almond milk
+(2, 20, 0.50), -- Milk → Coconut milk
+(2, 21, 0.60); -- Milk → Oat milk
+
+INSERT INTO menu_extras (code, name, ingredient_id, quantity, price_delta) VALUES
+('extra_shot', 'Extra espresso shot', 1, 0.02, 0.60),
+('whipped_cream', 'Whipped cream topping', 17, 0.03, 0.40);
 
 -- Menu population
 INSERT INTO menu_items (name, description, price, categories, created_at, updated_at) VALUES
@@ -213,6 +765,38 @@ INSERT INTO menu_items (name, description, price, categories, created_at, update
 ('Ginger tea with honey', 'Black tea with ginger and honey', 4.00, ARRAY['tea', 'hot drinks', 'specials'], NOW() - INTERVAL '3 months', NOW()),
 ('Iced latte', 'Cold espresso-based drink with milk and ice', 5.00, ARRAY['coffee', 'cold drinks', 'milk drinks'], NOW() - INTERVAL '3 months', NOW());
 
+-- Food, a combo deal (its components are listed in bundle_slots; its tax is split between
+-- the components' tax categories, so its own tax_category is not used) and a drink made from prepared ingredients
+INSERT INTO menu_items (name, description, price, categories, tax_category, created_at, updated_at) VALUES
+('Croissant', 'Butter croissant', 2.50, ARRAY['food', 'pastry'], 'food', NOW() - INTERVAL '2 months', NOW()),
+('Latte + croissant', 'Any milk coffee with a butter croissant', 6.50, ARRAY['combos'], 'drinks', NOW() - INTERVAL '1 month', NOW()),
+('Cold brew', 'Slow-steeped cold brew with vanilla sweet cream', 4.75, ARRAY['coffee', 'cold drinks'], 'drinks', NOW() - INTERVAL '1 month', NOW());
+
+-- Tax rates: drinks and food are taxed differently for dine-in and takeaway
+INSERT INTO tax_rates (tax_category, order_type, name, rate) VALUES
+('drinks', 'dine_in', 'VAT', 0.12),
+('drinks', 'takeaway', 'VAT', 0.12),
+('food', 'dine_in', 'VAT', 0.12),
+('food', 'dine_in', 'City tax', 0.02),
+('food', 'takeaway', 'VAT', 0.05);
+
+-- Promotions: an automatic category discount, a buy-2-get-1 deal and coupons
+INSERT INTO promotions (name, type, value, menu_item_id, category, buy_quantity, get_quantity, code, usage_limit, valid_from, valid_to) VALUES
+('Tea week', 'percentage', 10, NULL, 'tea', NULL, NULL, NULL, NULL, NOW() - INTERVAL '1 day', NOW() + INTERVAL '6 days'),
+('Espresso 2+1', 'buy_x_get_y', 0, 1, NULL, 2, 1, NULL, NULL, NULL, NULL),
+('Welcome coupon', 'fixed', 2.00, NULL, NULL, NULL, NULL, 'WELCOME2', 100, NULL, NOW() + INTERVAL '3 months'),
+('Cold drinks 15%', 'percentage', 15, NULL, 'cold drinks', NULL, NULL, 'COLD15', NULL, NOW(), NOW() + INTERVAL '1 month');
+
+-- Pricing rules: weekday happy hour on tea and a morning espresso price
+INSERT INTO pricing_rules (name, menu_item_id, category, days_of_week, start_time, end_time, percent_off, fixed_price) VALUES
+('Happy hour', NULL, 'tea', '{1,2,3,4,5}', '15:00', '17:00', 20, NULL),
+('Morning espresso', 1, NULL, '{}', '07:00', '10:00', NULL, 2.50);
+
+-- Loyalty rules: 5 points per unit paid and a bonus for every tea
+INSERT INTO loyalty_rules (name, category, points) VALUES
+('Base points', NULL, 5),
+('Tea lovers', 'tea', 10);
+
 -- Menu and ingredients relationship
 INSERT INTO menu_item_ingredients (menu_item_id, ingredient_id, quantity) VALUES
 (1, 1, 0.02), -- Espresso - coffee beans
@@ -234,7 +818,44 @@ INSERT INTO menu_item_ingredients (menu_item_id, ingredient_id, quantity) VALUES
 (9, 15, 0.01),-- Ginger tea - ginger
 (9, 16, 0.02),-- Ginger tea - honey
 (10, 1, 0.02),-- Iced latte - coffee beans
-(10, 2, 0.2); -- Iced latte - milk
+(10, 2, 0.2), -- Iced latte - milk
+(11, 22, 1),  -- Croissant
+(13, 23, 0.25), -- Cold brew - cold brew
+(13, 25, 0.03); -- Cold brew - vanilla sweet cream
+
+-- Size variants (price history rows are written by variant_price_change_trigger)
+INSERT INTO menu_item_variants (menu_item_id, size, price) VALUES
+(3, 'small', 4.25), (3, 'medium', 4.75), (3, 'large', 5.50),   -- Latte
+(2, 'small', 4.00), (2, 'medium', 4.50), (2, 'large', 5.25);   -- Cappuccino
+
+INSERT INTO menu_item_variant_ingredients (variant_id, ingredient_id, quantity) VALUES
+(1, 1, 0.02), (1, 2, 0.15),
+(2, 1, 0.02), (2, 2, 0.2),
+(3, 1, 0.03), (3, 2, 0.3),
+(4, 1, 0.02), (4, 2, 0.08),
+(5, 1, 0.02), (5, 2, 0.1),
+(6, 1, 0.03), (6, 2, 0.15);
+
+-- Modifier groups
+INSERT INTO modifier_groups (menu_item_id, name, required, min_selections, max_selections) VALUES
+(3, 'Syrup', FALSE, 0, 1),
+(6, 'Topping', FALSE, 0, 2);
+
+INSERT INTO modifiers (group_id, name, price_delta, ingredient_id, quantity) VALUES
+(1, 'Vanilla', 0.50, 5, 0.02),
+(1, 'Caramel', 0.50, 6, 0.02),
+(1, 'No syrup', 0.00, NULL, 0),
+(2, 'Chocolate drizzle', 0.40, 4, 0.01),
+(2, 'Cinnamon', 0.20, 9, 0.002);
+
+-- Bundle slots: latte (or cappuccino / mocha) + croissant
+INSERT INTO bundle_slots (bundle_id, name, menu_item_id, quantity) VALUES
+(12, 'Drink', 3, 1),
+(12, 'Pastry', 11, 1);
+
+INSERT INTO bundle_slot_choices (slot_id, menu_item_id, price_delta) VALUES
+(1, 2, 0.00),
+(1, 5, 0.50);
 
 -- Price history
 INSERT INTO price_history (menu_item_id, price, effective_from, effective_to, change_reason) VALUES
@@ -249,6 +870,16 @@ INSERT INTO price_history (menu_item_id, price, effective_from, effective_to, ch
 (5, 5.00, NOW() - INTERVAL '12 months', NOW() - INTERVAL '5 months', 'Initial price'),
 (5, 5.25, NOW() - INTERVAL '5 months', NULL, 'Increase due to rising chocolate syrup prices');
 
+-- Scheduled price change (applied by the server when due)
+INSERT INTO scheduled_price_changes (menu_item_id, price, effective_at, reason) VALUES
+(6, 5.75, NOW() + INTERVAL '1 month', 'Summer menu: higher ice and milk costs');
+
+-- Regular customers
+INSERT INTO customers (name, phone, email, preferences) VALUES
+('Anna', '+77011234567', 'anna@example.com', '{"sugar": "no sugar", "favorite_drink": "Espresso"}'),
+('Ivan', '+77017654321', NULL, '{"milk": "soy"}'),
+('Elena', NULL, 'elena@example.com', '{"milk": "almond", "syrup": "double portion"}');
+
 -- Orders
 INSERT INTO orders (name, status, total_amount, special_instructions, created_at, updated_at) VALUES
 ('Anna', 'closed', 9.00, '{"sugar": "no sugar"}', NOW() - INTERVAL '30 days', NOW() - INTERVAL '30 days'),
@@ -276,12 +907,15 @@ INSERT INTO orders (name, status, total_amount, special_instructions, created_at
 ('Lubov', 'closed', 9.75, '{"sugar": "no sugar"}', NOW() - INTERVAL '8 days', NOW() - INTERVAL '8 days'),
 ('Viktor', 'closed', 4.50, '{}', NOW() - INTERVAL '7 days', NOW() - INTERVAL '7 days'),
 ('Marina', 'closed', 6.25, '{"cinnamon": "with cinnamon"}', NOW() - INTERVAL '6 days', NOW() - INTERVAL '6 days'),
-('Evgeny', 'updated', 8.00, '{}', NOW() - INTERVAL '5 days', NOW() - INTERVAL '5 days'),
+('Evgeny', 'in_progress', 8.00, '{}', NOW() - INTERVAL '5 days', NOW() - INTERVAL '5 days'),
 ('Ksenia', 'closed', 5.75, '{"milk": "soy"}', NOW() - INTERVAL '4 days', NOW() - INTERVAL '4 days'),
 ('Artem', 'open', 7.00, '{}', NOW() - INTERVAL '3 days', NOW() - INTERVAL '3 days'),
 ('Galina', 'open', 10.25, '{"sugar": "1 teaspoon"}', NOW() - INTERVAL '2 days', NOW() - INTERVAL '2 days'),
 ('Nikolay', 'cancelled', 6.75, '{}', NOW() - INTERVAL '1 day', NOW() - INTERVAL '1 day');
 
+-- Orders placed by regular customers
+UPDATE orders SET customer_id = c.id FROM customers c WHERE orders.name = c.name;
+
 -- Order items
 INSERT INTO order_items (order_id, menu_item_id, quantity, price) VALUES
 (1, 1, 1, 3.50), (1, 2, 1, 4.50), (1, 7, 1, 3.00),
@@ -315,6 +949,47 @@ INSERT INTO order_items (order_id, menu_item_id, quantity, price) VALUES
 (29, 3, 1, 4.75), (29, 6, 1, 5.50),
 (30, 10, 1, 5.00);
 
+-- Reservations for orders that are still in progress
+INSERT INTO inventory_reservations (order_id, ingredient_id, quantity)
+SELECT oi.order_id, mii.ingredient_id, SUM(mii.quantity * oi.quantity)
+FROM order_items oi
+JOIN orders o ON o.id = oi.order_id
+JOIN menu_item_ingredients mii ON mii.menu_item_id = oi.menu_item_id
+WHERE o.status IN ('open', 'in_progress', 'ready')
+GROUP BY oi.order_id, mii.ingredient_id;
+
+-- Closed orders are paid in full: every third one in cash, the rest by card
+INSERT INTO payments (order_id, method, amount, created_at)
+SELECT id, CASE WHEN id % 3 = 0 THEN 'cash' ELSE 'card' END::payment_method, total_amount, updated_at
+FROM orders
+WHERE status IN ('closed', 'refunded') AND total_amount > 0;
+
+-- Gift cards: one partly spent, one issued to a customer and one already expired
+INSERT INTO gift_cards (code, initial_amount, balance, customer_id, expires_at, created_at, updated_at) VALUES
+('GC-WELCOME-0001', 25.00, 15.50, NULL, NOW() + INTERVAL '11 months', NOW() - INTERVAL '1 month', NOW() - INTERVAL '20 days'),
+('GC-ANNA-BDAY', 50.00, 50.00, 1, NOW() + INTERVAL '1 year', NOW() - INTERVAL '3 days', NOW() - INTERVAL '3 days'),
+('GC-OLD-2024', 20.00, 7.25, NULL, NOW() - INTERVAL '2 months', NOW() - INTERVAL '14 months', NOW() - INTERVAL '3 months');
+
+INSERT INTO gift_card_ledger (gift_card_id, entry_type, amount, notes, created_at) VALUES
+(1, 'issue', 25.00, 'Gift card issued', NOW() - INTERVAL '1 month'),
+(1, 'redeem', -9.50, 'Paid at the counter', NOW() - INTERVAL '20 days'),
+(2, 'issue', 50.00, 'Birthday gift', NOW() - INTERVAL '3 days'),
+(3, 'issue', 20.00, 'Gift card issued', NOW() - INTERVAL '14 months'),
+(3, 'redeem', -12.75, 'Paid at the counter', NOW() - INTERVAL '3 months');
+
+-- Loyalty points earned by regular customers on their closed orders (see loyalty_rules)
+INSERT INTO loyalty_ledger (customer_id, order_id, entry_type, points, remaining, expires_at, notes, created_at)
+SELECT customer_id, id, 'earn', points, points, updated_at + INTERVAL '1 year', 'Order ' || id, updated_at
+FROM (
+    SELECT o.customer_id, o.id, o.updated_at,
+        FLOOR(o.total_amount * 5 + 10 * (SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi
+            JOIN menu_items mi ON mi.id = oi.menu_item_id
+            WHERE oi.order_id = o.id AND 'tea' = ANY (mi.categories)))::INT AS points
+    FROM orders o
+    WHERE o.customer_id IS NOT NULL AND o.status = 'closed'
+) earned
+WHERE points > 0;
+
 -- Order status history
 INSERT INTO order_status_history (order_id, status, notes, created_at) VALUES
 (1, 'open', 'Order received', NOW() - INTERVAL '30 days' - INTERVAL '10 minutes'),
@@ -368,7 +1043,7 @@ INSERT INTO order_status_history (order_id, status, notes, created_at) VALUES
 (25, 'open', 'Order received', NOW() - INTERVAL '6 days' - INTERVAL '12 minutes'),
 (25, 'closed', 'Order completed', NOW() - INTERVAL '6 days'),
 (26, 'open', 'Order received', NOW() - INTERVAL '5 days' - INTERVAL '20 minutes'),
-(26, 'updated', 'Order composition changed', NOW() - INTERVAL '5 days'),
+(26, 'in_progress', 'Order started', NOW() - INTERVAL '5 days'),
 (27, 'open', 'Order received', NOW() - INTERVAL '4 days' - INTERVAL '7 minutes'),
 (27, 'closed', 'Order completed', NOW() - INTERVAL '4 days'),
 (28, 'open', 'Order received', NOW() - INTERVAL '3 days'),
@@ -9,7 +9,7 @@ import (
 	"frappuccino/internal/handler"
 )
 
-func SetupRoutes(mux *http.ServeMux, orderHandler handler.OrderHandler, menuHandler handler.MenuHandler, inventoryHandler handler.InventoryHandler, reportHandler handler.ReportHandler) {
+func SetupRoutes(mux *http.ServeMux, orderHandler handler.OrderHandler, menuHandler handler.MenuHandler, inventoryHandler handler.InventoryHandler, reportHandler handler.ReportHandler, paymentHandler handler.PaymentHandler, taxHandler handler.TaxHandler, promotionHandler handler.PromotionHandler, pricingRuleHandler handler.PricingRuleHandler, priceHandler handler.PriceHandler, customerHandler handler.CustomerHandler, loyaltyHandler handler.LoyaltyHandler, giftCardHandler handler.GiftCardHandler, idempotency handler.IdempotencyMiddleware) {
 	// Вспомогательная функция для логирования и обработки маршрутов
 	handleWithLog := func(path string, handlerFunc http.HandlerFunc) {
 		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
@@ -18,15 +18,33 @@ func SetupRoutes(mux *http.ServeMux, orderHandler handler.OrderHandler, menuHand
 		})
 	}
 
-	handleWithLog("/orders", HandleRequestsOrders(orderHandler))
-	handleWithLog("/orders/", HandleRequestsOrders(orderHandler))
+	handleWithLog("/orders", HandleRequestsOrders(orderHandler, paymentHandler, idempotency))
+	handleWithLog("/orders/", HandleRequestsOrders(orderHandler, paymentHandler, idempotency))
 
-	handleWithLog("/menu", HandleMenu(menuHandler))
-	handleWithLog("/menu/", HandleMenu(menuHandler))
+	handleWithLog("/menu", HandleMenu(menuHandler, priceHandler))
+	handleWithLog("/menu/", HandleMenu(menuHandler, priceHandler))
 
 	handleWithLog("/inventory", HandleRequestsInventory(inventoryHandler))
 	handleWithLog("/inventory/", HandleRequestsInventory(inventoryHandler))
 
+	handleWithLog("/customers", HandleCustomers(customerHandler, loyaltyHandler))
+	handleWithLog("/customers/", HandleCustomers(customerHandler, loyaltyHandler))
+
+	handleWithLog("/gift-cards", HandleGiftCards(giftCardHandler))
+	handleWithLog("/gift-cards/", HandleGiftCards(giftCardHandler))
+
+	handleWithLog("/loyalty-rules", HandleLoyaltyRules(loyaltyHandler))
+	handleWithLog("/loyalty-rules/", HandleLoyaltyRules(loyaltyHandler))
+
+	handleWithLog("/tax-rates", HandleTaxRates(taxHandler))
+	handleWithLog("/tax-rates/", HandleTaxRates(taxHandler))
+
+	handleWithLog("/promotions", HandlePromotions(promotionHandler))
+	handleWithLog("/promotions/", HandlePromotions(promotionHandler))
+
+	handleWithLog("/pricing-rules", HandlePricingRules(pricingRuleHandler))
+	handleWithLog("/pricing-rules/", HandlePricingRules(pricingRuleHandler))
+
 	handleWithLog("/reports", HandleRequestsReports(reportHandler))
 	handleWithLog("/reports/", HandleRequestsReports(reportHandler))
 
@@ -36,6 +54,237 @@ func SetupRoutes(mux *http.ServeMux, orderHandler handler.OrderHandler, menuHand
 	})
 }
 
+func HandleCustomers(customerHandler handler.CustomerHandler, loyaltyHandler handler.LoyaltyHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				customerHandler.HandleGetCustomers(w, r)
+			case http.MethodPost:
+				customerHandler.HandleCreateCustomer(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(parts) > 3 || (len(parts) == 3 && parts[2] != "orders" && parts[2] != "loyalty") {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+			return
+		}
+
+		// /customers/{id}/orders и /customers/{id}/loyalty
+		if len(parts) == 3 {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if parts[2] == "loyalty" {
+				loyaltyHandler.HandleGetCustomerLoyalty(w, r, id)
+			} else {
+				customerHandler.HandleGetCustomerOrders(w, r, id)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			customerHandler.HandleGetCustomer(w, r, id)
+		case http.MethodPut:
+			customerHandler.HandleUpdateCustomer(w, r, id)
+		case http.MethodDelete:
+			customerHandler.HandleDeleteCustomer(w, r, id)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func HandleTaxRates(taxHandler handler.TaxHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				taxHandler.HandleGetTaxRates(w, r)
+			case http.MethodPost:
+				taxHandler.HandleCreateTaxRate(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(parts) != 2 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid tax rate ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			taxHandler.HandleDeleteTaxRate(w, r, id)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func HandlePromotions(promotionHandler handler.PromotionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				promotionHandler.HandleGetPromotions(w, r)
+			case http.MethodPost:
+				promotionHandler.HandleCreatePromotion(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(parts) != 2 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			promotionHandler.HandleDeletePromotion(w, r, id)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func HandlePricingRules(pricingRuleHandler handler.PricingRuleHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				pricingRuleHandler.HandleGetPricingRules(w, r)
+			case http.MethodPost:
+				pricingRuleHandler.HandleCreatePricingRule(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(parts) != 2 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid pricing rule ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			pricingRuleHandler.HandleDeletePricingRule(w, r, id)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func HandleGiftCards(giftCardHandler handler.GiftCardHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		switch {
+		// POST /gift-cards
+		case len(parts) == 1:
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			giftCardHandler.HandleIssueGiftCard(w, r)
+		// GET /gift-cards/{code}
+		case len(parts) == 2:
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			giftCardHandler.HandleGetGiftCard(w, r, parts[1])
+		// POST /gift-cards/{code}/top-up
+		case len(parts) == 3 && parts[2] == "top-up":
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			giftCardHandler.HandleTopUpGiftCard(w, r, parts[1])
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	}
+}
+
+func HandleLoyaltyRules(loyaltyHandler handler.LoyaltyHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				loyaltyHandler.HandleGetLoyaltyRules(w, r)
+			case http.MethodPost:
+				loyaltyHandler.HandleCreateLoyaltyRule(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(parts) != 2 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid loyalty rule ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			loyaltyHandler.HandleDeleteLoyaltyRule(w, r, id)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
 func HandleRequestsReports(reportHandler handler.ReportHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := strings.Trim(r.URL.Path, "/")
@@ -45,6 +294,16 @@ func HandleRequestsReports(reportHandler handler.ReportHandler) http.HandlerFunc
 		case http.MethodGet:
 			if len(parts) == 2 && parts[1] == "total-sales" {
 				reportHandler.HandleGetTotalSales(w, r)
+			} else if len(parts) == 2 && parts[1] == "taxes" {
+				reportHandler.HandleGetTaxTotals(w, r)
+			} else if len(parts) == 2 && parts[1] == "discounts" {
+				reportHandler.HandleGetDiscountTotals(w, r)
+			} else if len(parts) == 2 && parts[1] == "price-consistency" {
+				reportHandler.HandleGetPriceConsistency(w, r)
+			} else if len(parts) == 2 && parts[1] == "gift-card-liability" {
+				reportHandler.HandleGetGiftCardLiability(w, r)
+			} else if len(parts) == 2 && parts[1] == "item-revenue" {
+				reportHandler.HandleGetItemRevenue(w, r)
 			} else if len(parts) == 2 && parts[1] == "popular-items" {
 				reportHandler.HandleGetPopularItems(w, r)
 			} else if parts[1] == "search" {
@@ -78,7 +337,13 @@ func HandleRequestsInventory(inventoryHandler handler.InventoryHandler) http.Han
 
 		switch r.Method {
 		case http.MethodPost:
-			inventoryHandler.HandleCreateInventory(w, r)
+			if len(parts) == 1 {
+				inventoryHandler.HandleCreateInventory(w, r)
+			} else if len(parts) == 3 && parts[2] == "produce" {
+				inventoryHandler.HandleProduceInventory(w, r, id)
+			} else {
+				http.Error(w, "Not Found", http.StatusNotFound)
+			}
 		case http.MethodGet:
 			if len(parts) == 1 {
 				inventoryHandler.HandleGetAllInventory(w, r)
@@ -107,7 +372,7 @@ func HandleRequestsInventory(inventoryHandler handler.InventoryHandler) http.Han
 	}
 }
 
-func HandleRequestsOrders(orderHandler handler.OrderHandler) http.HandlerFunc {
+func HandleRequestsOrders(orderHandler handler.OrderHandler, paymentHandler handler.PaymentHandler, idempotency handler.IdempotencyMiddleware) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := strings.Trim(r.URL.Path, "/")
 		parts := strings.Split(path, "/")
@@ -126,11 +391,25 @@ func HandleRequestsOrders(orderHandler handler.OrderHandler) http.HandlerFunc {
 		switch r.Method {
 		case http.MethodPost:
 			if len(parts) == 1 {
-				orderHandler.HandleCreateOrder(w, r)
+				idempotency.Wrap("POST /orders", orderHandler.HandleCreateOrder)(w, r)
 			} else if len(parts) == 3 && parts[2] == "close" {
 				orderHandler.HandleCloseOrder(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "start" {
+				orderHandler.HandleStartOrder(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "ready" {
+				orderHandler.HandleReadyOrder(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "cancel" {
+				orderHandler.HandleCancelOrder(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "reopen" {
+				orderHandler.HandleReopenOrder(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "items" {
+				orderHandler.HandleAddOrderItem(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "payments" {
+				paymentHandler.HandleAddPayment(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "refund" {
+				paymentHandler.HandleRefundOrder(w, r, id)
 			} else if len(parts) == 2 && parts[1] == "batch-process" {
-				orderHandler.HandleBulkOrder(w, r)
+				idempotency.Wrap("POST /orders/batch-process", orderHandler.HandleBulkOrder)(w, r)
 			} else {
 				http.Error(w, "Bad Request", http.StatusBadRequest)
 			}
@@ -145,6 +424,10 @@ func HandleRequestsOrders(orderHandler handler.OrderHandler) http.HandlerFunc {
 				return
 			} else if len(parts) == 2 {
 				orderHandler.HandleGetOrderById(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "history" {
+				orderHandler.HandleGetOrderHistory(w, r, id)
+			} else if len(parts) == 3 && parts[2] == "payments" {
+				paymentHandler.HandleGetPayments(w, r, id)
 			} else {
 				http.Error(w, "Not Found", http.StatusNotFound)
 			}
@@ -152,6 +435,13 @@ func HandleRequestsOrders(orderHandler handler.OrderHandler) http.HandlerFunc {
 		case http.MethodDelete:
 			if len(parts) == 2 {
 				orderHandler.HandleDeleteOrder(w, r, id)
+			} else if len(parts) == 4 && parts[2] == "items" {
+				productID, err := strconv.Atoi(parts[3])
+				if err != nil {
+					http.Error(w, "Invalid product ID", http.StatusBadRequest)
+					return
+				}
+				orderHandler.HandleRemoveOrderItem(w, r, id, productID)
 			} else {
 				http.Error(w, "Not Found", http.StatusNotFound)
 			}
@@ -163,27 +453,70 @@ func HandleRequestsOrders(orderHandler handler.OrderHandler) http.HandlerFunc {
 				http.Error(w, "Bad Request", http.StatusBadRequest)
 			}
 
+		case http.MethodPatch:
+			if len(parts) == 4 && parts[2] == "items" {
+				productID, err := strconv.Atoi(parts[3])
+				if err != nil {
+					http.Error(w, "Invalid product ID", http.StatusBadRequest)
+					return
+				}
+				orderHandler.HandleUpdateOrderItem(w, r, id, productID)
+			} else {
+				http.Error(w, "Not Found", http.StatusNotFound)
+			}
+
 		default:
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	}
 }
 
-func HandleMenu(menuHandler handler.MenuHandler) http.HandlerFunc {
+func HandleMenu(menuHandler handler.MenuHandler, priceHandler handler.PriceHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := strings.Trim(r.URL.Path, "/")
-		parts := strings.SplitN(path, "/", 2)
+		parts := strings.Split(path, "/")
 
 		var id int
 		if len(parts) > 1 {
 			var err error
 			id, err = strconv.Atoi(parts[1])
 			if err != nil {
-				http.Error(w, "Invalid order ID", http.StatusBadRequest)
+				http.Error(w, "Invalid menu ID", http.StatusBadRequest)
 				return
 			}
 		}
 
+		// /menu/{id}/variants[/{variantId}], /menu/{id}/modifier-groups[/{groupId}],
+		// /menu/{id}/bundle-slots[/{slotId}], /menu/{id}/prices, /menu/{id}/price-history, /menu/{id}/price
+		// и /menu/{id}/sold-out
+		if len(parts) > 2 {
+			switch {
+			case len(parts) > 4:
+				http.Error(w, "Not Found", http.StatusNotFound)
+			case len(parts) == 3 && parts[2] == "prices" && r.Method == http.MethodPost:
+				priceHandler.HandleSchedulePriceChange(w, r, id)
+			case len(parts) == 3 && parts[2] == "price-history" && r.Method == http.MethodGet:
+				priceHandler.HandleGetPriceHistory(w, r, id)
+			case len(parts) == 3 && parts[2] == "price" && r.Method == http.MethodGet:
+				priceHandler.HandleGetPriceAt(w, r, id)
+			case len(parts) == 3 && parts[2] == "sold-out" && r.Method == http.MethodPost:
+				menuHandler.HandleSetSoldOut(w, r, id, true)
+			case len(parts) == 3 && parts[2] == "sold-out" && r.Method == http.MethodDelete:
+				menuHandler.HandleSetSoldOut(w, r, id, false)
+			case len(parts) == 3 && (parts[2] == "prices" || parts[2] == "price-history" || parts[2] == "price" || parts[2] == "sold-out"):
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			case parts[2] == "variants":
+				handleMenuVariants(w, r, menuHandler, id, parts[3:])
+			case parts[2] == "modifier-groups":
+				handleMenuModifierGroups(w, r, menuHandler, id, parts[3:])
+			case parts[2] == "bundle-slots":
+				handleMenuBundleSlots(w, r, menuHandler, id, parts[3:])
+			default:
+				http.Error(w, "Not Found", http.StatusNotFound)
+			}
+			return
+		}
+
 		switch r.Method {
 		case http.MethodPost:
 			if len(parts) == 1 {
@@ -219,3 +552,86 @@ func HandleMenu(menuHandler handler.MenuHandler) http.HandlerFunc {
 		}
 	}
 }
+
+func handleMenuVariants(w http.ResponseWriter, r *http.Request, menuHandler handler.MenuHandler, menuID int, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			menuHandler.HandleGetVariants(w, r, menuID)
+		case http.MethodPost:
+			menuHandler.HandleCreateVariant(w, r, menuID)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	variantID, err := strconv.Atoi(rest[0])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		menuHandler.HandleGetVariant(w, r, menuID, variantID)
+	case http.MethodPut:
+		menuHandler.HandleUpdateVariant(w, r, menuID, variantID)
+	case http.MethodDelete:
+		menuHandler.HandleDeleteVariant(w, r, menuID, variantID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleMenuModifierGroups(w http.ResponseWriter, r *http.Request, menuHandler handler.MenuHandler, menuID int, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			menuHandler.HandleGetModifierGroups(w, r, menuID)
+		case http.MethodPost:
+			menuHandler.HandleCreateModifierGroup(w, r, menuID)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	groupID, err := strconv.Atoi(rest[0])
+	if err != nil {
+		http.Error(w, "Invalid modifier group ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	menuHandler.HandleDeleteModifierGroup(w, r, menuID, groupID)
+}
+
+func handleMenuBundleSlots(w http.ResponseWriter, r *http.Request, menuHandler handler.MenuHandler, menuID int, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			menuHandler.HandleGetBundleSlots(w, r, menuID)
+		case http.MethodPost:
+			menuHandler.HandleCreateBundleSlot(w, r, menuID)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	slotID, err := strconv.Atoi(rest[0])
+	if err != nil {
+		http.Error(w, "Invalid bundle slot ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	menuHandler.HandleDeleteBundleSlot(w, r, menuID, slotID)
+}
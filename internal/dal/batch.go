@@ -0,0 +1,124 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// BatchOrderOutcome — результат обработки одного заказа пакета
+type BatchOrderOutcome struct {
+	Order            models.Order
+	Err              error // причина отклонения; nil — заказ принят
+	InventoryUpdates []models.InventoryUpdate
+}
+
+// errBatchRollback откатывает транзакцию пакета без ошибки для вызывающего
+var errBatchRollback = errors.New("batch rolled back")
+
+// ProcessBatch создаёт и сразу закрывает заказы в одной транзакции. Каждый заказ
+// обрабатывается в своей точке сохранения, поэтому заказ, под который не хватило
+// ингредиентов, откатывается, не задевая уже принятые.
+//
+//   - all_or_nothing: на первом отклонённом заказе обработка останавливается
+//     и вся транзакция откатывается;
+//   - best_effort: принятые заказы фиксируются, отклонённые — нет;
+//   - dry_run: все заказы проверяются по очереди, затем транзакция откатывается.
+//
+// Любая другая ошибка откатывает весь пакет. Второе значение — зафиксирован ли пакет.
+// Оплаты заказа (order.Payments) записываются в той же точке сохранения перед закрытием.
+// requirePaid — как в CloseOrder: неоплаченный заказ отклоняется (ErrOrderNotPaid).
+// pointsTTL — срок баллов лояльности, начисленных клиентам закрытых заказов.
+func (r OrderRepository) ProcessBatch(orders []models.Order, mode string, change models.OrderStatusChange, requirePaid bool,
+	pointsTTL time.Duration,
+) ([]BatchOrderOutcome, bool, error) {
+	var outcomes []BatchOrderOutcome
+	committed := false
+
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		rejected := false
+		for _, order := range orders {
+			outcome, err := processBatchOrder(tx, order, change, requirePaid, pointsTTL)
+			if err != nil {
+				return err
+			}
+			outcomes = append(outcomes, outcome)
+
+			if outcome.Err != nil {
+				rejected = true
+				if mode == models.BatchModeAllOrNothing {
+					break
+				}
+			}
+		}
+
+		if mode == models.BatchModeDryRun || (mode == models.BatchModeAllOrNothing && rejected) {
+			return errBatchRollback
+		}
+		committed = true
+		return nil
+	})
+	if errTransact != nil && !errors.Is(errTransact, errBatchRollback) {
+		return nil, false, errTransact
+	}
+
+	return outcomes, committed, nil
+}
+
+// processBatchOrder создаёт и закрывает один заказ пакета в точке сохранения.
+// Нехватка ингредиентов или баллов, отклонённая оплата и неоплаченный заказ возвращаются
+// в outcome.Err, остальные ошибки — как error.
+func processBatchOrder(tx *sql.Tx, order models.Order, change models.OrderStatusChange, requirePaid bool, pointsTTL time.Duration,
+) (BatchOrderOutcome, error) {
+	if _, err := tx.Exec(`SAVEPOINT batch_order`); err != nil {
+		return BatchOrderOutcome{}, fmt.Errorf("failed to create savepoint: %v", err)
+	}
+
+	newOrder, err := insertOrder(tx, order)
+	if err == nil {
+		err = insertBatchPayments(tx, newOrder.ID, order.Payments)
+	}
+	var updates []models.InventoryUpdate
+	if err == nil {
+		updates, err = closeOrder(tx, newOrder.ID, models.OrderStatusOpen, change, requirePaid, pointsTTL)
+		newOrder.Status = models.OrderStatusClosed
+	}
+
+	var stockErr *InsufficientStockError
+	if errors.As(err, &stockErr) || errors.Is(err, ErrOrderNotPaid) || errors.Is(err, ErrInsufficientPoints) ||
+		errors.Is(err, ErrBatchPaymentRejected) {
+		if _, errRollback := tx.Exec(`ROLLBACK TO SAVEPOINT batch_order`); errRollback != nil {
+			return BatchOrderOutcome{}, fmt.Errorf("failed to roll back to savepoint: %v", errRollback)
+		}
+		return BatchOrderOutcome{Order: order, Err: err}, nil
+	}
+	if err != nil {
+		return BatchOrderOutcome{}, err
+	}
+
+	if _, err := tx.Exec(`RELEASE SAVEPOINT batch_order`); err != nil {
+		return BatchOrderOutcome{}, fmt.Errorf("failed to release savepoint: %v", err)
+	}
+	return BatchOrderOutcome{Order: newOrder, InventoryUpdates: updates}, nil
+}
+
+// insertBatchPayments записывает оплаты заказа из пакета. Оплата, которую нельзя
+// принять (карта, баллы, сумма больше остатка), отклоняет заказ: ErrBatchPaymentRejected.
+func insertBatchPayments(tx *sql.Tx, orderID int, payments []models.Payment) error {
+	for _, payment := range payments {
+		_, err := insertPayment(tx, orderID, payment)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrGiftCardNotUsable) || errors.Is(err, ErrInsufficientPoints) ||
+			errors.Is(err, ErrOrderNotPayable) || errors.Is(err, utils.ErrValidation) {
+			return fmt.Errorf("%w: %w", ErrBatchPaymentRejected, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+
+	"github.com/lib/pq"
+)
+
+// AddBundleSlot добавляет слот в комбо-набор bundleID
+func (r MenuRepository) AddBundleSlot(slot models.BundleSlot) (models.BundleSlot, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var component bool
+		queryComponent := `SELECT EXISTS(SELECT 1 FROM bundle_slots s
+			LEFT JOIN bundle_slot_choices c ON c.slot_id = s.id
+			WHERE s.menu_item_id = $1 OR c.menu_item_id = $1)`
+		if err := tx.QueryRow(queryComponent, slot.BundleID).Scan(&component); err != nil {
+			return fmt.Errorf("ошибка при проверке состава наборов: %v", err)
+		}
+		if component {
+			return fmt.Errorf("%w: menu item %d is part of another bundle and cannot become a bundle", utils.ErrValidation, slot.BundleID)
+		}
+
+		if err := insertBundleSlot(tx, &slot); err != nil {
+			return err
+		}
+		return touchMenuItem(tx, slot.BundleID)
+	})
+	if errTransact != nil {
+		return models.BundleSlot{}, errTransact
+	}
+
+	return slot, nil
+}
+
+// insertBundleSlot сохраняет слот и его замены. Наборы не вкладываются друг в друга:
+// компонентом слота не может быть другой набор.
+func insertBundleSlot(tx *sql.Tx, slot *models.BundleSlot) error {
+	products := []int64{int64(slot.ProductID)}
+	for _, choice := range slot.Choices {
+		products = append(products, int64(choice.ProductID))
+	}
+	var nested bool
+	queryNested := `SELECT EXISTS(SELECT 1 FROM bundle_slots WHERE bundle_id = ANY($1))`
+	if err := tx.QueryRow(queryNested, pq.Array(products)).Scan(&nested); err != nil {
+		return fmt.Errorf("ошибка при проверке состава наборов: %v", err)
+	}
+	if nested {
+		return fmt.Errorf("%w: slot %q cannot contain another bundle", utils.ErrValidation, slot.Name)
+	}
+
+	query := `INSERT INTO bundle_slots (bundle_id, name, menu_item_id, quantity) VALUES ($1, $2, $3, $4) RETURNING id`
+	if err := tx.QueryRow(query, slot.BundleID, slot.Name, slot.ProductID, slot.Quantity).Scan(&slot.ID); err != nil {
+		return err
+	}
+
+	queryChoice := `INSERT INTO bundle_slot_choices (slot_id, menu_item_id, price_delta) VALUES ($1, $2, $3)`
+	for _, choice := range slot.Choices {
+		if _, err := tx.Exec(queryChoice, slot.ID, choice.ProductID, choice.PriceDelta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadBundleSlots возвращает слоты комбо-набора; у обычной позиции слотов нет
+func (r MenuRepository) LoadBundleSlots(bundleID int) ([]models.BundleSlot, error) {
+	return loadBundleSlots(r.db, bundleID)
+}
+
+func loadBundleSlots(q querier, bundleID int) ([]models.BundleSlot, error) {
+	query := `SELECT id, bundle_id, name, menu_item_id, quantity FROM bundle_slots WHERE bundle_id = $1 ORDER BY id`
+	rows, err := q.Query(query, bundleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bundle slots: %w", err)
+	}
+	defer rows.Close()
+
+	var slots []models.BundleSlot
+	for rows.Next() {
+		var slot models.BundleSlot
+		if err := rows.Scan(&slot.ID, &slot.BundleID, &slot.Name, &slot.ProductID, &slot.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		slots = append(slots, slot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	rows.Close()
+
+	queryChoices := `SELECT menu_item_id, price_delta FROM bundle_slot_choices WHERE slot_id = $1 ORDER BY price_delta, menu_item_id`
+	for i := range slots {
+		choiceRows, err := q.Query(queryChoices, slots[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load bundle slot choices: %w", err)
+		}
+		for choiceRows.Next() {
+			var choice models.BundleChoice
+			if err := choiceRows.Scan(&choice.ProductID, &choice.PriceDelta); err != nil {
+				choiceRows.Close()
+				return nil, fmt.Errorf("failed to scan row: %w", err)
+			}
+			slots[i].Choices = append(slots[i].Choices, choice)
+		}
+		err = choiceRows.Err()
+		choiceRows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error iterating rows: %w", err)
+		}
+	}
+
+	return slots, nil
+}
+
+func (r MenuRepository) DeleteBundleSlot(bundleID, slotID int) error {
+	return database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `DELETE FROM bundle_slots WHERE id = $1 AND bundle_id = $2`
+		result, err := tx.Exec(query, slotID, bundleID)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении слота набора: %v", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("не удалось получить количество затронутых строк: %v", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("%w: bundle slot %d of menu item %d", ErrNotFound, slotID, bundleID)
+		}
+
+		return touchMenuItem(tx, bundleID)
+	})
+}
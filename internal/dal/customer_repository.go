@@ -0,0 +1,179 @@
+package dal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type CustomerRepositoryInterface interface {
+	LoadCustomers() ([]models.Customer, error)
+	GetCustomer(id int) (models.Customer, error)
+	AddCustomer(customer models.Customer) (models.Customer, error)
+	UpdateCustomer(id int, customer models.Customer, version int) (models.Customer, error)
+	DeleteCustomer(id, version int) error
+	CustomerTotals(id int) (models.CustomerOrders, error)
+}
+
+type CustomerRepository struct {
+	db *sql.DB
+}
+
+func NewCustomerRepository(db *sql.DB) CustomerRepository {
+	return CustomerRepository{db: db}
+}
+
+const customerColumns = `id, name, COALESCE(phone, ''), COALESCE(email, ''), preferences, version, created_at, updated_at`
+
+func scanCustomer(row interface{ Scan(...any) error }) (models.Customer, error) {
+	var customer models.Customer
+	var preferences []byte
+	if err := row.Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Email, &preferences, &customer.Version,
+		&customer.CreatedAt, &customer.UpdatedAt); err != nil {
+		return models.Customer{}, err
+	}
+	if err := json.Unmarshal(preferences, &customer.Preferences); err != nil {
+		return models.Customer{}, fmt.Errorf("error decoding preferences: %w", err)
+	}
+	return customer, nil
+}
+
+func (r CustomerRepository) LoadCustomers() ([]models.Customer, error) {
+	rows, err := r.db.Query(`SELECT ` + customerColumns + ` FROM customers ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customers: %w", err)
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return customers, nil
+}
+
+func (r CustomerRepository) GetCustomer(id int) (models.Customer, error) {
+	customer, err := scanCustomer(r.db.QueryRow(`SELECT `+customerColumns+` FROM customers WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Customer{}, fmt.Errorf("%w: customer %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("failed to get customer: %w", err)
+	}
+	return customer, nil
+}
+
+func (r CustomerRepository) AddCustomer(customer models.Customer) (models.Customer, error) {
+	preferences, err := json.Marshal(customer.Preferences)
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("JSON marshaling error: %w", err)
+	}
+
+	query := `INSERT INTO customers (name, phone, email, preferences) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4)
+		RETURNING ` + customerColumns
+	newCustomer, err := scanCustomer(r.db.QueryRow(query, customer.Name, customer.Phone, customer.Email, preferences))
+	if err != nil {
+		return models.Customer{}, customerWriteError(err, customer)
+	}
+	return newCustomer, nil
+}
+
+// UpdateCustomer заменяет карточку клиента; version — ожидаемая версия (0 — без проверки)
+func (r CustomerRepository) UpdateCustomer(id int, customer models.Customer, version int) (models.Customer, error) {
+	preferences, err := json.Marshal(customer.Preferences)
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("JSON marshaling error: %w", err)
+	}
+
+	query := `UPDATE customers SET name = $2, phone = NULLIF($3, ''), email = NULLIF($4, ''), preferences = $5, updated_at = NOW()
+		WHERE id = $1 AND ($6 = 0 OR version = $6)
+		RETURNING ` + customerColumns
+	updated, err := scanCustomer(r.db.QueryRow(query, id, customer.Name, customer.Phone, customer.Email, preferences, version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Customer{}, versionOrNotFound(r.db, "customers", id, fmt.Errorf("%w: customer %d", ErrNotFound, id))
+	}
+	if err != nil {
+		return models.Customer{}, customerWriteError(err, customer)
+	}
+	return updated, nil
+}
+
+// DeleteCustomer удаляет клиента; его заказы остаются с именем гостя
+func (r CustomerRepository) DeleteCustomer(id, version int) error {
+	result, err := r.db.Exec(`DELETE FROM customers WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
+	if err != nil {
+		return fmt.Errorf("failed to delete customer: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return versionOrNotFound(r.db, "customers", id, fmt.Errorf("%w: customer %d", ErrNotFound, id))
+	}
+	return nil
+}
+
+// CustomerTotals считает число заказов клиента (без отменённых), потраченную сумму
+// (закрытые заказы за вычетом возвратов, как в TotalSales) и три самые частые позиции
+func (r CustomerRepository) CustomerTotals(id int) (models.CustomerOrders, error) {
+	totals := models.CustomerOrders{CustomerID: id, FavoriteItems: []models.FavoriteItem{}}
+
+	queryTotals := `SELECT COUNT(*) FILTER (WHERE o.status <> 'cancelled'),
+		COALESCE(SUM(o.total_amount) FILTER (WHERE o.status IN ('closed', 'refunded')), 0)
+			- COALESCE((SELECT SUM(ri.amount) FROM refund_items ri
+				JOIN refunds rf ON rf.id = ri.refund_id
+				JOIN orders ro ON ro.id = rf.order_id WHERE ro.customer_id = $1), 0)
+	FROM orders o WHERE o.customer_id = $1`
+	if err := r.db.QueryRow(queryTotals, id).Scan(&totals.OrderCount, &totals.TotalSpent); err != nil {
+		return models.CustomerOrders{}, fmt.Errorf("failed to count customer totals: %w", err)
+	}
+	totals.TotalSpent = utils.RoundMoney(totals.TotalSpent)
+
+	queryFavorites := `SELECT mi.id, mi.name, SUM(oi.quantity) FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN menu_items mi ON mi.id = oi.menu_item_id
+		WHERE o.customer_id = $1 AND o.status <> 'cancelled'
+		GROUP BY mi.id, mi.name
+		ORDER BY 3 DESC, mi.id
+		LIMIT 3`
+	rows, err := r.db.Query(queryFavorites, id)
+	if err != nil {
+		return models.CustomerOrders{}, fmt.Errorf("failed to load favorite items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.FavoriteItem
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Quantity); err != nil {
+			return models.CustomerOrders{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		totals.FavoriteItems = append(totals.FavoriteItems, item)
+	}
+	if err := rows.Err(); err != nil {
+		return models.CustomerOrders{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return totals, nil
+}
+
+func customerWriteError(err error, customer models.Customer) error {
+	if strings.Contains(err.Error(), "duplicate key value") {
+		if strings.Contains(err.Error(), "email") {
+			return fmt.Errorf("%w: email %q is already registered", ErrCustomerExists, customer.Email)
+		}
+		return fmt.Errorf("%w: phone %q is already registered", ErrCustomerExists, customer.Phone)
+	}
+	return fmt.Errorf("failed to save customer: %w", err)
+}
@@ -0,0 +1,76 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound — запись справочника (размер, замена, добавка и т.п.) не найдена
+var ErrNotFound = errors.New("not found")
+
+// ErrOrderNotEditable — состав закрытого, отменённого или возвращённого заказа менять нельзя
+var ErrOrderNotEditable = errors.New("order cannot be edited")
+
+// ErrOrderStatusChanged — заказ сменил статус, пока запрос его обрабатывал
+var ErrOrderStatusChanged = errors.New("order status changed")
+
+// ErrOrderNotPayable — отменённый, возвращённый или уже оплаченный заказ оплатить нельзя
+var ErrOrderNotPayable = errors.New("order cannot accept payments")
+
+// ErrOrderNotRefundable — вернуть можно только закрытый и ещё не возвращённый полностью заказ
+var ErrOrderNotRefundable = errors.New("order cannot be refunded")
+
+// ErrOrderNotPaid — заказ нельзя закрыть, пока он не оплачен полностью
+var ErrOrderNotPaid = errors.New("order is not fully paid")
+
+// ErrBatchPaymentRejected — оплату заказа из пакета не удалось принять, заказ отклоняется
+var ErrBatchPaymentRejected = errors.New("batch order payment rejected")
+
+// ErrCustomerExists — клиент с таким телефоном или email уже зарегистрирован
+var ErrCustomerExists = errors.New("customer already exists")
+
+// ErrGiftCardExists — подарочная карта с таким кодом уже выпущена
+var ErrGiftCardExists = errors.New("gift card already exists")
+
+// ErrGiftCardNotUsable — карта просрочена или на ней не осталось денег
+var ErrGiftCardNotUsable = errors.New("gift card cannot be used")
+
+// ErrInsufficientPoints — у клиента не хватает баллов лояльности для оплаты
+var ErrInsufficientPoints = errors.New("insufficient loyalty points")
+
+// ErrMenuItemInBundle — позиция входит в комбо-набор, сначала её нужно убрать из слотов набора
+var ErrMenuItemInBundle = errors.New("menu item is part of a bundle")
+
+// ErrVariantInUse — размерный вариант указан в позициях заказов и не может быть удалён
+var ErrVariantInUse = errors.New("variant is used by order items")
+
+// ErrVersionMismatch — запись изменилась после того, как клиент её прочитал (ETag устарел)
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// InsufficientStockError — ингредиента не хватает, чтобы принять или закрыть заказ
+type InsufficientStockError struct {
+	IngredientID int
+	Name         string
+	Available    float64
+	Required     float64
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient inventory for ingredient ID %d %s (available: %f, required: %f)",
+		e.IngredientID, e.Name, e.Available, e.Required)
+}
+
+// versionOrNotFound уточняет, почему UPDATE/DELETE с проверкой версии не затронул строку:
+// запись есть, но версия другая — ErrVersionMismatch, записи нет — notFound
+func versionOrNotFound(q querier, table string, id int, notFound error) error {
+	var version int
+	err := q.QueryRow(`SELECT version FROM `+table+` WHERE id = $1`, id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check version: %v", err)
+	}
+	return fmt.Errorf("%w: record %d is at version %d", ErrVersionMismatch, id, version)
+}
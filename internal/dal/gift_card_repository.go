@@ -0,0 +1,219 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type GiftCardRepositoryInterface interface {
+	IssueGiftCard(card models.GiftCard) (models.GiftCard, error)
+	GetGiftCard(code string) (models.GiftCard, error)
+	TopUpGiftCard(code string, topUp models.GiftCardTopUp) (models.GiftCard, error)
+}
+
+type GiftCardRepository struct {
+	db *sql.DB
+}
+
+func NewGiftCardRepository(db *sql.DB) GiftCardRepository {
+	return GiftCardRepository{db: db}
+}
+
+const giftCardColumns = `id, code, initial_amount, balance, COALESCE(customer_id, 0), expires_at,
+	expires_at IS NOT NULL AND expires_at <= NOW(), created_at, updated_at`
+
+func scanGiftCard(row interface{ Scan(...any) error }) (models.GiftCard, error) {
+	var card models.GiftCard
+	var expiresAt sql.NullTime
+	if err := row.Scan(&card.ID, &card.Code, &card.InitialAmount, &card.Balance, &card.CustomerID, &expiresAt,
+		&card.Expired, &card.CreatedAt, &card.UpdatedAt); err != nil {
+		return models.GiftCard{}, err
+	}
+	if expiresAt.Valid {
+		card.ExpiresAt = &expiresAt.Time
+	}
+	return card, nil
+}
+
+// IssueGiftCard выпускает карту с начальным остатком и записью issue в журнале
+func (r GiftCardRepository) IssueGiftCard(card models.GiftCard) (models.GiftCard, error) {
+	var newCard models.GiftCard
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var expiresAt sql.NullTime
+		if card.ExpiresAt != nil {
+			expiresAt = sql.NullTime{Time: *card.ExpiresAt, Valid: true}
+		}
+		query := `INSERT INTO gift_cards (code, initial_amount, balance, customer_id, expires_at)
+			VALUES ($1, $2, $2, NULLIF($3, 0), $4)
+			RETURNING ` + giftCardColumns
+		var err error
+		newCard, err = scanGiftCard(tx.QueryRow(query, card.Code, card.InitialAmount, card.CustomerID, expiresAt))
+		if err != nil {
+			if strings.Contains(err.Error(), "duplicate key value") {
+				return fmt.Errorf("%w: code %q is already used", ErrGiftCardExists, card.Code)
+			}
+			if strings.Contains(err.Error(), "foreign key") {
+				return fmt.Errorf("%w: customer %d not found", utils.ErrValidation, card.CustomerID)
+			}
+			return fmt.Errorf("failed to insert gift card: %v", err)
+		}
+
+		return addGiftCardEntry(tx, newCard.ID, models.GiftCardEntry{
+			Type: models.GiftCardEntryIssue, Amount: newCard.InitialAmount, Notes: "Gift card issued",
+		})
+	})
+	if errTransact != nil {
+		return models.GiftCard{}, errTransact
+	}
+
+	return r.GetGiftCard(newCard.Code)
+}
+
+// GetGiftCard возвращает карту по коду вместе с журналом (новые записи первыми)
+func (r GiftCardRepository) GetGiftCard(code string) (models.GiftCard, error) {
+	card, err := scanGiftCard(r.db.QueryRow(`SELECT `+giftCardColumns+` FROM gift_cards WHERE code = $1`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.GiftCard{}, fmt.Errorf("%w: gift card %s", ErrNotFound, code)
+	}
+	if err != nil {
+		return models.GiftCard{}, fmt.Errorf("failed to get gift card: %w", err)
+	}
+
+	card.Entries, err = r.loadGiftCardEntries(card.ID)
+	if err != nil {
+		return models.GiftCard{}, err
+	}
+	return card, nil
+}
+
+func (r GiftCardRepository) loadGiftCardEntries(cardID int) ([]models.GiftCardEntry, error) {
+	query := `SELECT id, entry_type, amount, COALESCE(order_id, 0), COALESCE(payment_id, 0), COALESCE(notes, ''), created_at
+		FROM gift_card_ledger WHERE gift_card_id = $1 ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(query, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gift card ledger: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.GiftCardEntry{}
+	for rows.Next() {
+		var entry models.GiftCardEntry
+		if err := rows.Scan(&entry.ID, &entry.Type, &entry.Amount, &entry.OrderID, &entry.PaymentID, &entry.Notes,
+			&entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return entries, nil
+}
+
+// TopUpGiftCard пополняет действующую карту
+func (r GiftCardRepository) TopUpGiftCard(code string, topUp models.GiftCardTopUp) (models.GiftCard, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		cardID, _, err := lockGiftCard(tx, code)
+		if err != nil {
+			return err
+		}
+
+		notes := topUp.Notes
+		if notes == "" {
+			notes = "Gift card topped up"
+		}
+		return changeGiftCardBalance(tx, cardID, models.GiftCardEntry{
+			Type: models.GiftCardEntryTopUp, Amount: topUp.Amount, Notes: notes,
+		})
+	})
+	if errTransact != nil {
+		return models.GiftCard{}, errTransact
+	}
+
+	return r.GetGiftCard(code)
+}
+
+// lockGiftCard блокирует действующую карту по коду и возвращает её id и остаток.
+// Карты с истёкшим сроком — ErrGiftCardNotUsable.
+func lockGiftCard(tx *sql.Tx, code string) (int, float64, error) {
+	var id int
+	var balance float64
+	var expired bool
+	query := `SELECT id, balance, expires_at IS NOT NULL AND expires_at <= NOW() FROM gift_cards WHERE code = $1 FOR UPDATE`
+	err := tx.QueryRow(query, code).Scan(&id, &balance, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, fmt.Errorf("%w: gift card %s", ErrNotFound, code)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lock gift card: %v", err)
+	}
+	if expired {
+		return 0, 0, fmt.Errorf("%w: gift card %s has expired", ErrGiftCardNotUsable, code)
+	}
+	return id, balance, nil
+}
+
+// changeGiftCardBalance меняет остаток карты на entry.Amount и пишет запись в журнал
+func changeGiftCardBalance(tx *sql.Tx, cardID int, entry models.GiftCardEntry) error {
+	query := `UPDATE gift_cards SET balance = balance + $2, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(query, cardID, entry.Amount); err != nil {
+		return fmt.Errorf("failed to update gift card balance: %v", err)
+	}
+	return addGiftCardEntry(tx, cardID, entry)
+}
+
+func addGiftCardEntry(tx *sql.Tx, cardID int, entry models.GiftCardEntry) error {
+	query := `INSERT INTO gift_card_ledger (gift_card_id, entry_type, amount, order_id, payment_id, notes)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), NULLIF($6, ''))`
+	if _, err := tx.Exec(query, cardID, entry.Type, entry.Amount, entry.OrderID, entry.PaymentID, entry.Notes); err != nil {
+		return fmt.Errorf("failed to write gift card entry: %v", err)
+	}
+	return nil
+}
+
+// refundToGiftCards зачисляет обратно на карты части возврата, пришедшиеся на оплаты подарочными картами.
+// Истёкшую карту, как и в lockGiftCard, пополнить нельзя: такая часть возвращается
+// наличными и отмечается в refund_payments.refunded_as.
+func refundToGiftCards(tx *sql.Tx, refund models.Refund, payments []models.RefundPayment) error {
+	queryCard := `SELECT c.id, c.expires_at IS NOT NULL AND c.expires_at <= NOW()
+		FROM gift_card_ledger l JOIN gift_cards c ON c.id = l.gift_card_id
+		WHERE l.payment_id = $1 AND l.entry_type = 'redeem'
+		FOR UPDATE OF c`
+	queryRefundedAs := `UPDATE refund_payments SET refunded_as = $3 WHERE refund_id = $1 AND payment_id = $2`
+	for i, payment := range payments {
+		if payment.Method != models.PaymentMethodGiftCard {
+			continue
+		}
+
+		var cardID int
+		var expired bool
+		err := tx.QueryRow(queryCard, payment.PaymentID).Scan(&cardID, &expired)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // оплата принята до появления журнала карт
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find gift card of payment %d: %v", payment.PaymentID, err)
+		}
+		if expired {
+			if _, err := tx.Exec(queryRefundedAs, refund.ID, payment.PaymentID, models.PaymentMethodCash); err != nil {
+				return fmt.Errorf("failed to update refund payment: %v", err)
+			}
+			payments[i].RefundedAs = models.PaymentMethodCash
+			continue
+		}
+		entry := models.GiftCardEntry{
+			Type: models.GiftCardEntryRefund, Amount: payment.Amount, OrderID: refund.OrderID, PaymentID: payment.PaymentID,
+			Notes: fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID),
+		}
+		if err := changeGiftCardBalance(tx, cardID, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
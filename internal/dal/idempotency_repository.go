@@ -0,0 +1,86 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"frappuccino/models"
+)
+
+type IdempotencyRepositoryInterface interface {
+	Lock(ctx context.Context, key string) (func(), error)
+	GetRecord(key, endpoint string, retention time.Duration) (models.IdempotencyRecord, error)
+	SaveRecord(record models.IdempotencyRecord, retention time.Duration) error
+}
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return IdempotencyRepository{db: db}
+}
+
+// Lock берёт advisory-блокировку на ключ в отдельном соединении и держит её
+// до вызова возвращённой функции. Параллельные повторы с тем же ключом ждут
+// завершения первого запроса и затем получают его сохранённый ответ.
+func (r IdempotencyRepository) Lock(ctx context.Context, key string) (func(), error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, key); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock idempotency key: %w", err)
+	}
+
+	release := func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key); err != nil {
+			slog.Error("Failed to unlock idempotency key", "error", err)
+		}
+		conn.Close()
+	}
+	return release, nil
+}
+
+// GetRecord возвращает сохранённый ответ, если он моложе retention
+func (r IdempotencyRepository) GetRecord(key, endpoint string, retention time.Duration) (models.IdempotencyRecord, error) {
+	query := `SELECT idempotency_key, endpoint, request_hash, status_code, response_body, created_at
+		FROM idempotency_keys
+		WHERE idempotency_key = $1 AND endpoint = $2 AND created_at > NOW() - $3 * INTERVAL '1 second'`
+
+	var record models.IdempotencyRecord
+	err := r.db.QueryRow(query, key, endpoint, retention.Seconds()).
+		Scan(&record.Key, &record.Endpoint, &record.RequestHash, &record.StatusCode, &record.ResponseBody, &record.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyRecord{}, fmt.Errorf("%w: idempotency key %q", ErrNotFound, key)
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	return record, nil
+}
+
+// SaveRecord сохраняет ответ (перезаписывая устаревшую запись с тем же ключом)
+// и заодно удаляет ключи старше retention
+func (r IdempotencyRepository) SaveRecord(record models.IdempotencyRecord, retention time.Duration) error {
+	query := `INSERT INTO idempotency_keys (idempotency_key, endpoint, request_hash, status_code, response_body)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (idempotency_key, endpoint) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = EXCLUDED.status_code,
+			response_body = EXCLUDED.response_body, created_at = NOW()`
+	if _, err := r.db.Exec(query, record.Key, record.Endpoint, record.RequestHash, record.StatusCode, record.ResponseBody); err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	queryCleanup := `DELETE FROM idempotency_keys WHERE created_at < NOW() - $1 * INTERVAL '1 second'`
+	if _, err := r.db.Exec(queryCleanup, retention.Seconds()); err != nil {
+		slog.Warn("Failed to clean up expired idempotency keys", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+
+	"github.com/lib/pq"
+)
+
+// maxRecipeDepth — сколько уровней вложенных заготовок раскрывает expandPrepared
+const maxRecipeDepth = 10
+
+// loadInventoryRecipe возвращает рецепт заготовки на единицу; у сырья он пустой
+func loadInventoryRecipe(q querier, preparedID int) ([]models.MenuItemIngredient, error) {
+	query := `SELECT ingredient_id, quantity FROM inventory_recipes WHERE prepared_id = $1 ORDER BY ingredient_id`
+	rows, err := q.Query(query, preparedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prepared ingredient recipe: %w", err)
+	}
+	defer rows.Close()
+
+	var recipe []models.MenuItemIngredient
+	for rows.Next() {
+		var ingredient models.MenuItemIngredient
+		if err := rows.Scan(&ingredient.IngredientID, &ingredient.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		recipe = append(recipe, ingredient)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return recipe, nil
+}
+
+// replaceInventoryRecipe заменяет рецепт заготовки. Рецепт не может (в том числе
+// через другие заготовки) включать саму заготовку.
+func replaceInventoryRecipe(tx *sql.Tx, preparedID int, recipe []models.MenuItemIngredient) error {
+	if len(recipe) > 0 {
+		parts := make([]int64, 0, len(recipe))
+		for _, ingredient := range recipe {
+			parts = append(parts, int64(ingredient.IngredientID))
+		}
+		queryCycle := `WITH RECURSIVE parts(id) AS (
+			SELECT unnest($1::int[])
+			UNION
+			SELECT r.ingredient_id FROM inventory_recipes r JOIN parts p ON r.prepared_id = p.id
+		)
+		SELECT EXISTS(SELECT 1 FROM parts WHERE id = $2)`
+		var cycle bool
+		if err := tx.QueryRow(queryCycle, pq.Array(parts), preparedID).Scan(&cycle); err != nil {
+			return fmt.Errorf("ошибка при проверке рецепта заготовки: %v", err)
+		}
+		if cycle {
+			return fmt.Errorf("%w: recipe of ingredient %d cannot contain the ingredient itself", utils.ErrValidation, preparedID)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM inventory_recipes WHERE prepared_id = $1`, preparedID); err != nil {
+		return fmt.Errorf("ошибка при удалении рецепта заготовки: %v", err)
+	}
+	query := `INSERT INTO inventory_recipes (prepared_id, ingredient_id, quantity) VALUES ($1, $2, $3)`
+	for _, ingredient := range recipe {
+		if _, err := tx.Exec(query, preparedID, ingredient.IngredientID, ingredient.Quantity); err != nil {
+			if strings.Contains(err.Error(), "foreign key") {
+				return fmt.Errorf("%w: ingredient %d not found in inventory", utils.ErrValidation, ingredient.IngredientID)
+			}
+			return fmt.Errorf("ошибка при добавлении ингредиента в рецепт заготовки: %v", err)
+		}
+	}
+	return nil
+}
+
+// expandPrepared раскладывает нехватку заготовок на ингредиенты их рецептов:
+// заготовка берётся со склада, сколько есть, недостающее готовится из рецепта,
+// в котором, в свою очередь, тоже могут быть заготовки. Доступно = остаток минус
+// резервы других заказов (orderID = 0 — минус все резервы).
+func expandPrepared(q querier, requirements map[int]float64, orderID int) error {
+	queryAvailable := `SELECT quantity - COALESCE((SELECT SUM(quantity) FROM inventory_reservations
+			WHERE ingredient_id = $1 AND status = 'held' AND order_id <> $2), 0)
+		FROM inventory WHERE id = $1`
+	return expandRequirements(q, requirements, func(ingredientID int) (float64, error) {
+		var onHand float64
+		err := q.QueryRow(queryAvailable, ingredientID, orderID).Scan(&onHand)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("failed to check inventory: %v", err)
+		}
+		return onHand, nil
+	})
+}
+
+// expandRequirements раскладывает нехватку заготовок на их рецепты; сколько заготовки
+// есть в наличии, сообщает availableOf
+func expandRequirements(q querier, requirements map[int]float64, availableOf func(ingredientID int) (float64, error)) error {
+	recipes := make(map[int][]models.MenuItemIngredient)
+	available := make(map[int]float64)
+	for depth := 0; ; depth++ {
+		expanded := false
+		for _, ingredientID := range sortedIngredientIDs(requirements) {
+			recipe, ok := recipes[ingredientID]
+			if !ok {
+				var err error
+				if recipe, err = loadInventoryRecipe(q, ingredientID); err != nil {
+					return err
+				}
+				recipes[ingredientID] = recipe
+				if len(recipe) > 0 {
+					onHand, err := availableOf(ingredientID)
+					if err != nil {
+						return err
+					}
+					available[ingredientID] = max(onHand, 0)
+				}
+			}
+			if len(recipe) == 0 {
+				continue
+			}
+
+			shortfall := requirements[ingredientID] - available[ingredientID]
+			if shortfall <= 0 {
+				continue
+			}
+			if depth == maxRecipeDepth {
+				return fmt.Errorf("prepared ingredient %d is nested more than %d levels deep", ingredientID, maxRecipeDepth)
+			}
+
+			requirements[ingredientID] -= shortfall
+			if requirements[ingredientID] <= 0 {
+				delete(requirements, ingredientID)
+			}
+			for _, part := range recipe {
+				requirements[part.IngredientID] += part.Quantity * shortfall
+			}
+			expanded = true
+		}
+		if !expanded {
+			return nil
+		}
+	}
+}
+
+// ProduceInventory готовит партию заготовки: списывает ингредиенты её рецепта
+// (нехватку вложенных заготовок — по их рецептам) и увеличивает её остаток.
+// Резервы открытых заказов на сырьё не трогаются.
+func (r InventoryRepositoryPostgres) ProduceInventory(preparedID int, production models.InventoryProduction) (models.ProductionResult, error) {
+	result := models.ProductionResult{IngredientID: preparedID, Produced: production.Quantity, Consumed: []models.InventoryUpdate{}}
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var unit string
+		err := tx.QueryRow(`SELECT ingredient_name, unit FROM inventory WHERE id = $1`, preparedID).Scan(&result.Name, &unit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: inventory item %d", ErrNotFound, preparedID)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при получении элемента: %v", err)
+		}
+
+		recipe, err := loadInventoryRecipe(tx, preparedID)
+		if err != nil {
+			return err
+		}
+		if len(recipe) == 0 {
+			return fmt.Errorf("%w: %s has no recipe and cannot be produced", utils.ErrValidation, result.Name)
+		}
+
+		requirements := make(map[int]float64, len(recipe))
+		for _, ingredient := range recipe {
+			requirements[ingredient.IngredientID] += ingredient.Quantity * production.Quantity
+		}
+		if err := expandPrepared(tx, requirements, 0); err != nil {
+			return err
+		}
+
+		notes := production.Notes
+		if notes == "" {
+			notes = fmt.Sprintf("Produced %g %s of %s", production.Quantity, unit, result.Name)
+		}
+		// Триггер log_inventory_change запишет сырьё как use, а саму партию — как production
+		queryContext := `SELECT set_config('frappuccino.inventory_txn_type', $1, true),
+			set_config('frappuccino.inventory_notes', $2, true)`
+		if _, err := tx.Exec(queryContext, "use", notes); err != nil {
+			return fmt.Errorf("failed to set inventory change context: %v", err)
+		}
+
+		// Строки, включая саму заготовку, блокируются по возрастанию id, как при закрытии заказов
+		ids := append(sortedIngredientIDs(requirements), preparedID)
+		sort.Ints(ids)
+		queryLock := `SELECT ingredient_name, quantity FROM inventory WHERE id = $1 FOR UPDATE`
+		queryReserved := `SELECT COALESCE(SUM(quantity), 0) FROM inventory_reservations
+			WHERE ingredient_id = $1 AND status = 'held'`
+		querySubtract := `UPDATE inventory SET quantity = quantity - $1, updated_at = NOW() WHERE id = $2 RETURNING quantity`
+		for _, ingredientID := range ids {
+			var name string
+			var onHand, reserved float64
+			if err := tx.QueryRow(queryLock, ingredientID).Scan(&name, &onHand); err != nil {
+				return fmt.Errorf("failed to lock inventory: %w", err)
+			}
+			if ingredientID == preparedID {
+				continue
+			}
+			if err := tx.QueryRow(queryReserved, ingredientID).Scan(&reserved); err != nil {
+				return fmt.Errorf("failed to check reservations: %w", err)
+			}
+			if onHand-reserved < requirements[ingredientID] {
+				return &InsufficientStockError{IngredientID: ingredientID, Name: name, Available: onHand - reserved, Required: requirements[ingredientID]}
+			}
+
+			update := models.InventoryUpdate{IngredientID: ingredientID, Name: name, QuantityUsed: requirements[ingredientID]}
+			if err := tx.QueryRow(querySubtract, requirements[ingredientID], ingredientID).Scan(&update.Remaining); err != nil {
+				return fmt.Errorf("failed to update inventory: %v", err)
+			}
+			result.Consumed = append(result.Consumed, update)
+		}
+
+		if _, err := tx.Exec(queryContext, "production", notes); err != nil {
+			return fmt.Errorf("failed to set inventory change context: %v", err)
+		}
+		queryAdd := `UPDATE inventory SET quantity = quantity + $1, updated_at = NOW() WHERE id = $2 RETURNING quantity`
+		if err := tx.QueryRow(queryAdd, production.Quantity, preparedID).Scan(&result.Remaining); err != nil {
+			return fmt.Errorf("failed to update inventory: %v", err)
+		}
+		return nil
+	})
+	if errTransact != nil {
+		return models.ProductionResult{}, errTransact
+	}
+
+	return result, nil
+}
@@ -7,14 +7,17 @@ import (
 
 	"frappuccino/internal/database"
 	"frappuccino/models"
+
+	"github.com/lib/pq"
 )
 
 type InventoryRepositoryInterface interface {
 	AddInventory(inventory models.InventoryItem) (models.InventoryItem, error)
 	LoadInventory() ([]models.InventoryItem, error)
 	GetInventoryItemByID(id int) (models.InventoryItem, error)
-	DeleteInventoryItemByID(id int) error
-	UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem) (models.InventoryItem, error)
+	DeleteInventoryItemByID(id, version int) error
+	UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem, version int) (models.InventoryItem, error)
+	ProduceInventory(preparedID int, production models.InventoryProduction) (models.ProductionResult, error)
 	GetLeftovers(sortBy string, page, pageSize int) ([]models.InventoryItem, int, error)
 }
 
@@ -30,9 +33,9 @@ func (r InventoryRepositoryPostgres) AddInventory(inventory models.InventoryItem
 	var newInventory models.InventoryItem
 
 	query := `INSERT INTO inventory
-	  (ingredient_name, quantity, unit, reorder_threshold)
-	  VALUES ($1, $2, $3, $4)
-	  RETURNING id, ingredient_name, quantity, unit, reorder_threshold`
+	  (ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags)
+	  VALUES ($1, $2, $3, $4, COALESCE($5, '{}'), COALESCE($6, '{}'))
+	  RETURNING id, ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags, version`
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
 		err := tx.QueryRow(
 			query,
@@ -40,11 +43,16 @@ func (r InventoryRepositoryPostgres) AddInventory(inventory models.InventoryItem
 			inventory.Quantity,
 			inventory.Unit,
 			inventory.ReorderThreshold,
-		).Scan(&newInventory.IngredientID, &newInventory.Name, &newInventory.Quantity, &newInventory.Unit, &newInventory.ReorderThreshold)
+			pq.Array(inventory.Allergens),
+			pq.Array(inventory.DietaryTags),
+		).Scan(&newInventory.IngredientID, &newInventory.Name, &newInventory.Quantity, &newInventory.Unit, &newInventory.ReorderThreshold,
+			pq.Array(&newInventory.Allergens), pq.Array(&newInventory.DietaryTags), &newInventory.Version)
 		if err != nil {
 			return fmt.Errorf("ошибка при выполнении запроса: %v", err)
 		}
-		return nil
+
+		newInventory.Recipe = inventory.Recipe
+		return replaceInventoryRecipe(tx, newInventory.IngredientID, inventory.Recipe)
 	})
 	if errTransact != nil {
 		return models.InventoryItem{}, errTransact
@@ -56,7 +64,7 @@ func (r InventoryRepositoryPostgres) AddInventory(inventory models.InventoryItem
 func (r InventoryRepositoryPostgres) LoadInventory() ([]models.InventoryItem, error) {
 	var inventories []models.InventoryItem
 
-	query := `SELECT id, ingredient_name, quantity, unit, reorder_threshold FROM inventory`
+	query := `SELECT id, ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags, version, ` + reservedQuantitySQL + ` FROM inventory`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при выполнении запроса: %v", err)
@@ -65,9 +73,11 @@ func (r InventoryRepositoryPostgres) LoadInventory() ([]models.InventoryItem, er
 
 	for rows.Next() {
 		var inventory models.InventoryItem
-		if err := rows.Scan(&inventory.IngredientID, &inventory.Name, &inventory.Quantity, &inventory.Unit, &inventory.ReorderThreshold); err != nil {
+		if err := rows.Scan(&inventory.IngredientID, &inventory.Name, &inventory.Quantity, &inventory.Unit, &inventory.ReorderThreshold,
+			pq.Array(&inventory.Allergens), pq.Array(&inventory.DietaryTags), &inventory.Version, &inventory.Reserved); err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки: %v", err)
 		}
+		inventory.Available = inventory.Quantity - inventory.Reserved
 		inventories = append(inventories, inventory)
 	}
 
@@ -81,13 +91,19 @@ func (r InventoryRepositoryPostgres) LoadInventory() ([]models.InventoryItem, er
 func (r InventoryRepositoryPostgres) GetInventoryItemByID(id int) (models.InventoryItem, error) {
 	var inventory models.InventoryItem
 
-	query := `SELECT id, ingredient_name, quantity, unit, reorder_threshold FROM inventory WHERE id = $1`
+	query := `SELECT id, ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags, version, updated_at, ` + reservedQuantitySQL + `
+		FROM inventory WHERE id = $1`
 	err := r.db.QueryRow(query, id).Scan(
 		&inventory.IngredientID,
 		&inventory.Name,
 		&inventory.Quantity,
 		&inventory.Unit,
 		&inventory.ReorderThreshold,
+		pq.Array(&inventory.Allergens),
+		pq.Array(&inventory.DietaryTags),
+		&inventory.Version,
+		&inventory.UpdatedAt,
+		&inventory.Reserved,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -95,14 +111,21 @@ func (r InventoryRepositoryPostgres) GetInventoryItemByID(id int) (models.Invent
 		}
 		return models.InventoryItem{}, fmt.Errorf("ошибка при получении элемента: %v", err)
 	}
+	inventory.Available = inventory.Quantity - inventory.Reserved
+
+	inventory.Recipe, err = loadInventoryRecipe(r.db, inventory.IngredientID)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
 
 	return inventory, nil
 }
 
-func (r InventoryRepositoryPostgres) DeleteInventoryItemByID(id int) error {
-	query := `DELETE FROM inventory WHERE id = $1`
+// DeleteInventoryItemByID удаляет ингредиент, если его версия совпадает с version (0 — без проверки)
+func (r InventoryRepositoryPostgres) DeleteInventoryItemByID(id, version int) error {
+	query := `DELETE FROM inventory WHERE id = $1 AND ($2 = 0 OR version = $2)`
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		result, err := tx.Exec(query, id)
+		result, err := tx.Exec(query, id, version)
 		if err != nil {
 			return fmt.Errorf("ошибка при удалении элемента: %v", err)
 		}
@@ -113,7 +136,7 @@ func (r InventoryRepositoryPostgres) DeleteInventoryItemByID(id int) error {
 		}
 
 		if rowsAffected == 0 {
-			return fmt.Errorf("inventory item с ID %d не найден", id)
+			return versionOrNotFound(tx, "inventory", id, fmt.Errorf("inventory item с ID %d не найден", id))
 		}
 		return nil
 	})
@@ -124,7 +147,8 @@ func (r InventoryRepositoryPostgres) DeleteInventoryItemByID(id int) error {
 	return nil
 }
 
-func (r InventoryRepositoryPostgres) UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem) (models.InventoryItem, error) {
+// UpdateInventoryItem обновляет ингредиент; version — ожидаемая версия (0 — без проверки)
+func (r InventoryRepositoryPostgres) UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem, version int) (models.InventoryItem, error) {
 	var existingItem models.InventoryItem
 	query := `SELECT id, ingredient_name, quantity, unit, reorder_threshold FROM inventory WHERE id = $1`
 	err := r.db.QueryRow(query, inventoryItemID).Scan(
@@ -146,7 +170,11 @@ func (r InventoryRepositoryPostgres) UpdateInventoryItem(inventoryItemID int, ch
 	}
 
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		updateQuery := `UPDATE inventory SET ingredient_name = $1, quantity = quantity + $2, unit = $3, reorder_threshold = $4, updated_at = NOW() WHERE id = $5 RETURNING id, ingredient_name, quantity, unit, reorder_threshold, updated_at`
+		// allergens и dietary_tags не переданы — остаются прежними
+		updateQuery := `UPDATE inventory SET ingredient_name = $1, quantity = quantity + $2, unit = $3, reorder_threshold = $4,
+			allergens = COALESCE($7, allergens), dietary_tags = COALESCE($8, dietary_tags), updated_at = NOW()
+			WHERE id = $5 AND ($6 = 0 OR version = $6)
+			RETURNING id, ingredient_name, quantity, unit, reorder_threshold, allergens, dietary_tags, version, updated_at`
 		err = tx.QueryRow(
 			updateQuery,
 			changedInventoryItem.Name,
@@ -154,18 +182,35 @@ func (r InventoryRepositoryPostgres) UpdateInventoryItem(inventoryItemID int, ch
 			changedInventoryItem.Unit,
 			changedInventoryItem.ReorderThreshold,
 			inventoryItemID,
+			version,
+			pq.Array(changedInventoryItem.Allergens),
+			pq.Array(changedInventoryItem.DietaryTags),
 		).Scan(
 			&existingItem.IngredientID,
 			&existingItem.Name,
 			&existingItem.Quantity,
 			&existingItem.Unit,
 			&existingItem.ReorderThreshold,
+			pq.Array(&existingItem.Allergens),
+			pq.Array(&existingItem.DietaryTags),
+			&existingItem.Version,
 			&existingItem.UpdatedAt,
 		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return versionOrNotFound(tx, "inventory", inventoryItemID, fmt.Errorf("inventory item с ID %d не найден", inventoryItemID))
+		}
 		if err != nil {
 			return fmt.Errorf("ошибка при обновлении элемента: %v", err)
 		}
-		return nil
+
+		// recipe не передан — рецепт заготовки не меняется, пустой список его удаляет
+		if changedInventoryItem.Recipe != nil {
+			if err := replaceInventoryRecipe(tx, inventoryItemID, changedInventoryItem.Recipe); err != nil {
+				return err
+			}
+		}
+		existingItem.Recipe, err = loadInventoryRecipe(tx, inventoryItemID)
+		return err
 	})
 	if errTransact != nil {
 		return models.InventoryItem{}, errTransact
@@ -0,0 +1,535 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"frappuccino/models"
+
+	"github.com/lib/pq"
+)
+
+type LoyaltyRepositoryInterface interface {
+	LoadLoyaltyRules() ([]models.LoyaltyRule, error)
+	AddLoyaltyRule(rule models.LoyaltyRule) (models.LoyaltyRule, error)
+	DeleteLoyaltyRule(id int) error
+	LoadLoyalty(customerID int) (models.CustomerLoyalty, error)
+	PointsBalance(customerID int) (int, error)
+}
+
+type LoyaltyRepository struct {
+	db *sql.DB
+}
+
+func NewLoyaltyRepository(db *sql.DB) LoyaltyRepository {
+	return LoyaltyRepository{db: db}
+}
+
+func (r LoyaltyRepository) LoadLoyaltyRules() ([]models.LoyaltyRule, error) {
+	return loadLoyaltyRules(r.db)
+}
+
+func loadLoyaltyRules(q querier) ([]models.LoyaltyRule, error) {
+	rows, err := q.Query(`SELECT id, name, COALESCE(category, ''), points, created_at FROM loyalty_rules ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load loyalty rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.LoyaltyRule{}
+	for rows.Next() {
+		var rule models.LoyaltyRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Category, &rule.Points, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return rules, nil
+}
+
+func (r LoyaltyRepository) AddLoyaltyRule(rule models.LoyaltyRule) (models.LoyaltyRule, error) {
+	query := `INSERT INTO loyalty_rules (name, category, points) VALUES ($1, NULLIF($2, ''), $3) RETURNING id, created_at`
+	if err := r.db.QueryRow(query, rule.Name, rule.Category, rule.Points).Scan(&rule.ID, &rule.CreatedAt); err != nil {
+		return models.LoyaltyRule{}, fmt.Errorf("failed to insert loyalty rule: %w", err)
+	}
+	return rule, nil
+}
+
+// DeleteLoyaltyRule удаляет правило; уже начисленные баллы остаются
+func (r LoyaltyRepository) DeleteLoyaltyRule(id int) error {
+	result, err := r.db.Exec(`DELETE FROM loyalty_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete loyalty rule: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("loyalty rule with ID %d not found", id)
+	}
+	return nil
+}
+
+// LoadLoyalty возвращает баланс клиента с журналом (новые записи первыми). Чтение
+// ничего не пишет: сгоревшие, но ещё не списанные баллы просто не входят в баланс,
+// а запись expire появляется при следующем изменении журнала.
+func (r LoyaltyRepository) LoadLoyalty(customerID int) (models.CustomerLoyalty, error) {
+	loyalty := models.CustomerLoyalty{CustomerID: customerID, Entries: []models.LoyaltyEntry{}}
+
+	var exists bool
+	if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1)`, customerID).Scan(&exists); err != nil {
+		return models.CustomerLoyalty{}, fmt.Errorf("failed to check customer: %v", err)
+	}
+	if !exists {
+		return models.CustomerLoyalty{}, fmt.Errorf("%w: customer %d", ErrNotFound, customerID)
+	}
+
+	var err error
+	loyalty.Balance, err = availablePoints(r.db, customerID)
+	if err != nil {
+		return models.CustomerLoyalty{}, err
+	}
+
+	// Ближайшее сгорание: непотраченные партии с самым ранним ещё не наступившим сроком
+	var nextExpiry sql.NullTime
+	var expiring int
+	queryExpiry := `SELECT expires_at, SUM(remaining) FROM loyalty_ledger
+		WHERE customer_id = $1 AND remaining > 0 AND expires_at > NOW()
+		GROUP BY expires_at ORDER BY expires_at LIMIT 1`
+	err = r.db.QueryRow(queryExpiry, customerID).Scan(&nextExpiry, &expiring)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.CustomerLoyalty{}, fmt.Errorf("failed to get next expiry: %v", err)
+	}
+	if nextExpiry.Valid && loyalty.Balance > 0 {
+		loyalty.NextExpiry = &nextExpiry.Time
+		loyalty.Expiring = min(expiring, loyalty.Balance)
+	}
+
+	query := `SELECT id, COALESCE(order_id, 0), COALESCE(payment_id, 0), entry_type, points, remaining, expires_at,
+			COALESCE(notes, ''), created_at
+		FROM loyalty_ledger WHERE customer_id = $1 ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(query, customerID)
+	if err != nil {
+		return models.CustomerLoyalty{}, fmt.Errorf("failed to load loyalty ledger: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.LoyaltyEntry
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&entry.ID, &entry.OrderID, &entry.PaymentID, &entry.Type, &entry.Points, &entry.Remaining,
+			&expiresAt, &entry.Notes, &entry.CreatedAt); err != nil {
+			return models.CustomerLoyalty{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if expiresAt.Valid {
+			entry.ExpiresAt = &expiresAt.Time
+		}
+		loyalty.Entries = append(loyalty.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return models.CustomerLoyalty{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return loyalty, nil
+}
+
+// PointsBalance — баллы, которые клиент может потратить сейчас (без сгоревших)
+func (r LoyaltyRepository) PointsBalance(customerID int) (int, error) {
+	return availablePoints(r.db, customerID)
+}
+
+// lockLoyaltyCustomer блокирует клиента: записи в его журнал баллов идут по очереди.
+// Под блокировкой сгоревшие баллы списываются записью expire, так что дальше
+// баланс журнала совпадает с тем, что клиент может потратить.
+func lockLoyaltyCustomer(tx *sql.Tx, customerID int) error {
+	var id int
+	err := tx.QueryRow(`SELECT id FROM customers WHERE id = $1 FOR UPDATE`, customerID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: customer %d", ErrNotFound, customerID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock customer: %v", err)
+	}
+	return expirePoints(tx, customerID)
+}
+
+// availablePoints — баланс журнала за вычетом сгоревших, но ещё не списанных баллов.
+// Сгорает не больше баланса — так же, как в expirePoints.
+func availablePoints(q querier, customerID int) (int, error) {
+	var balance, expired int
+	query := `SELECT COALESCE(SUM(points), 0),
+			COALESCE(SUM(remaining) FILTER (WHERE remaining > 0 AND expires_at <= NOW()), 0)
+		FROM loyalty_ledger WHERE customer_id = $1`
+	if err := q.QueryRow(query, customerID).Scan(&balance, &expired); err != nil {
+		return 0, fmt.Errorf("failed to get points balance: %v", err)
+	}
+	return balance - min(expired, max(balance, 0)), nil
+}
+
+func pointsBalance(q querier, customerID int) (int, error) {
+	var balance int
+	err := q.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger WHERE customer_id = $1`, customerID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get points balance: %v", err)
+	}
+	return balance, nil
+}
+
+// expirePoints списывает непотраченный остаток партий с истёкшим сроком.
+// Сгорает не больше текущего баланса: баллы, уже снятые возвратом, второй раз не списываются.
+func expirePoints(tx *sql.Tx, customerID int) error {
+	balance, err := pointsBalance(tx, customerID)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT id, remaining FROM loyalty_ledger
+		WHERE customer_id = $1 AND remaining > 0 AND expires_at <= NOW()
+		ORDER BY expires_at, id`
+	rows, err := tx.Query(query, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to load expired points: %w", err)
+	}
+	type lot struct{ id, remaining int }
+	var expired []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		expired = append(expired, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for _, l := range expired {
+		if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = 0 WHERE id = $1`, l.id); err != nil {
+			return fmt.Errorf("failed to expire points: %v", err)
+		}
+		points := min(l.remaining, max(balance, 0))
+		if points == 0 {
+			continue
+		}
+		entry := models.LoyaltyEntry{
+			Type: models.LoyaltyEntryExpire, Points: -points, Notes: fmt.Sprintf("Points of entry %d expired", l.id),
+		}
+		if err := addLoyaltyEntry(tx, customerID, entry); err != nil {
+			return err
+		}
+		balance -= points
+	}
+	return nil
+}
+
+// addLoyaltyEntry пишет запись в журнал баллов; у начислений remaining — весь их объём
+func addLoyaltyEntry(tx *sql.Tx, customerID int, entry models.LoyaltyEntry) error {
+	var expiresAt sql.NullTime
+	if entry.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *entry.ExpiresAt, Valid: true}
+	}
+	query := `INSERT INTO loyalty_ledger (customer_id, order_id, payment_id, entry_type, points, remaining, expires_at, notes)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5, $6, $7, NULLIF($8, ''))`
+	_, err := tx.Exec(query, customerID, entry.OrderID, entry.PaymentID, entry.Type, entry.Points, entry.Remaining,
+		expiresAt, entry.Notes)
+	if err != nil {
+		return fmt.Errorf("failed to write loyalty entry: %v", err)
+	}
+	return nil
+}
+
+// consumeLots уменьшает остаток партий на points: сначала партии заказа orderID
+// (0 — без предпочтения), затем те, что сгорят раньше
+func consumeLots(tx *sql.Tx, customerID, orderID, points int) error {
+	query := `SELECT id, remaining FROM loyalty_ledger WHERE customer_id = $1 AND remaining > 0
+		ORDER BY CASE WHEN order_id = $2 THEN 0 ELSE 1 END, expires_at NULLS LAST, id`
+	rows, err := tx.Query(query, customerID, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to load loyalty lots: %w", err)
+	}
+	type lot struct{ id, remaining int }
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for _, l := range lots {
+		if points <= 0 {
+			break
+		}
+		part := min(l.remaining, points)
+		if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = remaining - $2 WHERE id = $1`, l.id, part); err != nil {
+			return fmt.Errorf("failed to update loyalty lot: %v", err)
+		}
+		points -= part
+	}
+	return nil
+}
+
+// expiryFrom — срок партии, начисленной сейчас; ttl 0 — баллы не сгорают
+func expiryFrom(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(ttl)
+	return &expiresAt
+}
+
+// earnPoints начисляет клиенту заказа баллы по правилам лояльности. Сумма считается
+// без части, оплаченной баллами; у заказа без клиента баллов нет.
+func earnPoints(tx *sql.Tx, orderID int, ttl time.Duration) error {
+	var customerID sql.NullInt64
+	var total, paidWithPoints float64
+	query := `SELECT customer_id, total_amount,
+			COALESCE((SELECT SUM(amount) FROM payments WHERE order_id = $1 AND method = 'loyalty_points'), 0)
+		FROM orders WHERE id = $1`
+	if err := tx.QueryRow(query, orderID).Scan(&customerID, &total, &paidWithPoints); err != nil {
+		return fmt.Errorf("failed to load order for loyalty: %v", err)
+	}
+	if !customerID.Valid {
+		return nil
+	}
+
+	rules, err := loadLoyaltyRules(tx)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	queryItems := `SELECT oi.quantity, COALESCE(mi.categories, '{}') FROM order_items oi
+		JOIN menu_items mi ON mi.id = oi.menu_item_id WHERE oi.order_id = $1`
+	rows, err := tx.Query(queryItems, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to load order items: %w", err)
+	}
+	itemsByCategory := make(map[string]float64)
+	for rows.Next() {
+		var quantity float64
+		var categories []string
+		if err := rows.Scan(&quantity, pq.Array(&categories)); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		for _, category := range categories {
+			itemsByCategory[category] += quantity
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	var earned float64
+	for _, rule := range rules {
+		if rule.Category == "" {
+			earned += rule.Points * math.Max(total-paidWithPoints, 0)
+		} else {
+			earned += rule.Points * itemsByCategory[rule.Category]
+		}
+	}
+	points := int(math.Floor(earned + 1e-9))
+	if points <= 0 {
+		return nil
+	}
+
+	if err := lockLoyaltyCustomer(tx, int(customerID.Int64)); err != nil {
+		return err
+	}
+	entry := models.LoyaltyEntry{
+		OrderID: orderID, Type: models.LoyaltyEntryEarn, Points: points, Remaining: points,
+		ExpiresAt: expiryFrom(ttl), Notes: fmt.Sprintf("Order %d", orderID),
+	}
+	return addLoyaltyEntry(tx, int(customerID.Int64), entry)
+}
+
+// redeemPoints списывает баллы клиента в оплату payment
+func redeemPoints(tx *sql.Tx, customerID int, payment models.Payment) error {
+	entry := models.LoyaltyEntry{
+		OrderID: payment.OrderID, PaymentID: payment.ID, Type: models.LoyaltyEntryRedeem, Points: -payment.Points,
+		Notes: fmt.Sprintf("Payment for order %d", payment.OrderID),
+	}
+	return spendPoints(tx, customerID, entry)
+}
+
+// redeemDiscountPoints списывает баллы, которыми оплачена скидка заказа. При оформлении
+// баланс только проверяется, а списываются баллы при закрытии — здесь их может уже не хватить.
+func redeemDiscountPoints(tx *sql.Tx, orderID int) error {
+	var customerID sql.NullInt64
+	var points int
+	query := `SELECT customer_id, COALESCE((SELECT SUM(points) FROM order_discounts WHERE order_id = $1), 0)
+		FROM orders WHERE id = $1`
+	if err := tx.QueryRow(query, orderID).Scan(&customerID, &points); err != nil {
+		return fmt.Errorf("failed to load order for loyalty: %v", err)
+	}
+	if points == 0 || !customerID.Valid {
+		return nil // клиент удалён вместе с журналом баллов
+	}
+
+	entry := models.LoyaltyEntry{
+		OrderID: orderID, Type: models.LoyaltyEntryRedeem, Points: -points, Notes: fmt.Sprintf("Discount on order %d", orderID),
+	}
+	return spendPoints(tx, int(customerID.Int64), entry)
+}
+
+// spendPoints пишет списание entry (points < 0). Сгоревшие баллы сначала списываются
+// при блокировке клиента, поэтому потратить их нельзя.
+func spendPoints(tx *sql.Tx, customerID int, entry models.LoyaltyEntry) error {
+	if err := lockLoyaltyCustomer(tx, customerID); err != nil {
+		return err
+	}
+	balance, err := pointsBalance(tx, customerID)
+	if err != nil {
+		return err
+	}
+	if balance < -entry.Points {
+		return fmt.Errorf("%w: customer %d has %d points, %d needed", ErrInsufficientPoints, customerID, balance, -entry.Points)
+	}
+
+	if err := addLoyaltyEntry(tx, customerID, entry); err != nil {
+		return err
+	}
+	return consumeLots(tx, customerID, 0, -entry.Points)
+}
+
+// reverseEarnedPoints снимает баллы, начисленные за заказ, в доле share возвращённой суммы;
+// последний возврат (complete) снимает весь остаток. Возвращает число снятых баллов.
+// Уже потраченные баллы тоже снимаются: баланс клиента может уйти в минус.
+func reverseEarnedPoints(tx *sql.Tx, refund models.Refund, share float64, complete bool) (int, error) {
+	var customerID sql.NullInt64
+	var earned, reversed int
+	query := `SELECT customer_id,
+			COALESCE(SUM(points) FILTER (WHERE entry_type = 'earn'), 0),
+			COALESCE(-SUM(points) FILTER (WHERE entry_type = 'reverse'), 0)
+		FROM loyalty_ledger WHERE order_id = $1 GROUP BY customer_id`
+	err := tx.QueryRow(query, refund.OrderID).Scan(&customerID, &earned, &reversed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load earned points: %v", err)
+	}
+
+	points := earned - reversed
+	if !complete {
+		points = min(int(math.Round(float64(earned)*share)), points)
+	}
+	if points <= 0 || !customerID.Valid {
+		return 0, nil
+	}
+
+	if err := lockLoyaltyCustomer(tx, int(customerID.Int64)); err != nil {
+		return 0, err
+	}
+	entry := models.LoyaltyEntry{
+		OrderID: refund.OrderID, Type: models.LoyaltyEntryReverse, Points: -points,
+		Notes: fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID),
+	}
+	if err := addLoyaltyEntry(tx, int(customerID.Int64), entry); err != nil {
+		return 0, err
+	}
+	if err := consumeLots(tx, int(customerID.Int64), refund.OrderID, points); err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// restoreDiscountPoints возвращает клиенту баллы, потраченные на скидку заказа, в доле
+// share возвращённой суммы; последний возврат (complete) возвращает весь остаток.
+// Возвращённые баллы — новая партия со сроком ttl. Возвращает число баллов.
+func restoreDiscountPoints(tx *sql.Tx, refund models.Refund, share float64, complete bool, ttl time.Duration) (int, error) {
+	var customerID sql.NullInt64
+	var redeemed, restored int
+	query := `SELECT customer_id,
+			COALESCE(-SUM(points) FILTER (WHERE entry_type = 'redeem'), 0),
+			COALESCE(SUM(points) FILTER (WHERE entry_type = 'restore'), 0)
+		FROM loyalty_ledger WHERE order_id = $1 AND payment_id IS NULL AND entry_type IN ('redeem', 'restore')
+		GROUP BY customer_id`
+	err := tx.QueryRow(query, refund.OrderID).Scan(&customerID, &redeemed, &restored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load redeemed points: %v", err)
+	}
+
+	points := redeemed - restored
+	if !complete {
+		points = min(int(math.Round(float64(redeemed)*share)), points)
+	}
+	if points <= 0 || !customerID.Valid {
+		return 0, nil
+	}
+
+	if err := lockLoyaltyCustomer(tx, int(customerID.Int64)); err != nil {
+		return 0, err
+	}
+	entry := models.LoyaltyEntry{
+		OrderID: refund.OrderID, Type: models.LoyaltyEntryRestore, Points: points, Remaining: points,
+		ExpiresAt: expiryFrom(ttl), Notes: fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID),
+	}
+	if err := addLoyaltyEntry(tx, int(customerID.Int64), entry); err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// restoreRedeemedPoints возвращает клиенту баллы, которыми оплачены возвращённые
+// части заказа, и проставляет их в payments. Возвращённые баллы — новая партия со сроком ttl.
+func restoreRedeemedPoints(tx *sql.Tx, refund models.Refund, payments []models.RefundPayment, ttl time.Duration) error {
+	queryPayment := `SELECT p.amount, p.points, l.customer_id,
+			COALESCE((SELECT SUM(r.points) FROM loyalty_ledger r WHERE r.payment_id = p.id AND r.entry_type = 'restore'), 0)
+		FROM payments p JOIN loyalty_ledger l ON l.payment_id = p.id AND l.entry_type = 'redeem'
+		WHERE p.id = $1`
+	for i, payment := range payments {
+		if payment.Method != models.PaymentMethodLoyalty {
+			continue
+		}
+
+		var amount float64
+		var redeemed, customerID, restored int
+		err := tx.QueryRow(queryPayment, payment.PaymentID).Scan(&amount, &redeemed, &customerID, &restored)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // клиент удалён вместе с журналом баллов
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load loyalty payment: %v", err)
+		}
+
+		points := min(int(math.Round(float64(redeemed)*payment.Amount/amount)), redeemed-restored)
+		if points <= 0 {
+			continue
+		}
+		if err := lockLoyaltyCustomer(tx, customerID); err != nil {
+			return err
+		}
+		entry := models.LoyaltyEntry{
+			OrderID: refund.OrderID, PaymentID: payment.PaymentID, Type: models.LoyaltyEntryRestore, Points: points,
+			Remaining: points, ExpiresAt: expiryFrom(ttl), Notes: fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID),
+		}
+		if err := addLoyaltyEntry(tx, customerID, entry); err != nil {
+			return err
+		}
+		payments[i].Points = points
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package dal
+
+import (
+	"fmt"
+
+	"frappuccino/models"
+
+	"github.com/lib/pq"
+)
+
+// maxCountedPortions — больше порций одной позиции FillAvailability не считает
+const maxCountedPortions = 10000
+
+// stockSnapshot — свободный остаток склада (минус резервы открытых заказов)
+// и рецепты заготовок на момент чтения меню
+type stockSnapshot struct {
+	available map[int]float64
+	recipes   map[int][]models.MenuItemIngredient
+	soldOut   map[int]bool
+}
+
+func loadStockSnapshot(q querier) (stockSnapshot, error) {
+	snapshot := stockSnapshot{
+		available: make(map[int]float64),
+		recipes:   make(map[int][]models.MenuItemIngredient),
+		soldOut:   make(map[int]bool),
+	}
+
+	rows, err := q.Query(`SELECT id, quantity - ` + reservedQuantitySQL + ` FROM inventory`)
+	if err != nil {
+		return stockSnapshot{}, fmt.Errorf("failed to load inventory: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var available float64
+		if err := rows.Scan(&id, &available); err != nil {
+			return stockSnapshot{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshot.available[id] = max(available, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return stockSnapshot{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	rows.Close()
+
+	recipeRows, err := q.Query(`SELECT prepared_id, ingredient_id, quantity FROM inventory_recipes ORDER BY prepared_id, ingredient_id`)
+	if err != nil {
+		return stockSnapshot{}, fmt.Errorf("failed to load prepared ingredient recipes: %w", err)
+	}
+	defer recipeRows.Close()
+	for recipeRows.Next() {
+		var preparedID int
+		var ingredient models.MenuItemIngredient
+		if err := recipeRows.Scan(&preparedID, &ingredient.IngredientID, &ingredient.Quantity); err != nil {
+			return stockSnapshot{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshot.recipes[preparedID] = append(snapshot.recipes[preparedID], ingredient)
+	}
+	if err := recipeRows.Err(); err != nil {
+		return stockSnapshot{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	recipeRows.Close()
+
+	soldOutRows, err := q.Query(`SELECT id FROM menu_items WHERE sold_out`)
+	if err != nil {
+		return stockSnapshot{}, fmt.Errorf("failed to load sold out menu items: %w", err)
+	}
+	defer soldOutRows.Close()
+	for soldOutRows.Next() {
+		var id int
+		if err := soldOutRows.Scan(&id); err != nil {
+			return stockSnapshot{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshot.soldOut[id] = true
+	}
+	if err := soldOutRows.Err(); err != nil {
+		return stockSnapshot{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// canMake проверяет, хватит ли склада на portions порций с составом perPortion.
+// Нехватка заготовок раскладывается на их рецепты так же, как в expandPrepared.
+func (s stockSnapshot) canMake(perPortion map[int]float64, portions int) bool {
+	requirements := make(map[int]float64, len(perPortion))
+	for id, quantity := range perPortion {
+		requirements[id] = quantity * float64(portions)
+	}
+
+	for depth := 0; ; depth++ {
+		expanded := false
+		for _, ingredientID := range sortedIngredientIDs(requirements) {
+			recipe := s.recipes[ingredientID]
+			shortfall := requirements[ingredientID] - s.available[ingredientID]
+			if len(recipe) == 0 || shortfall <= 1e-9 {
+				continue
+			}
+			if depth == maxRecipeDepth {
+				return false
+			}
+
+			requirements[ingredientID] -= shortfall
+			for _, part := range recipe {
+				requirements[part.IngredientID] += part.Quantity * shortfall
+			}
+			expanded = true
+		}
+		if !expanded {
+			break
+		}
+	}
+
+	for ingredientID, quantity := range requirements {
+		if quantity > s.available[ingredientID]+1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxPortions — наибольшее число порций, которое можно приготовить сейчас
+func (s stockSnapshot) maxPortions(perPortion map[int]float64) int {
+	if !s.canMake(perPortion, 1) {
+		return 0
+	}
+	low, high := 1, 2
+	for s.canMake(perPortion, high) {
+		if high >= maxCountedPortions {
+			return maxCountedPortions
+		}
+		low, high = high, high*2
+	}
+	// canMake(low) выполняется, canMake(high) — нет
+	for high-low > 1 {
+		middle := (low + high) / 2
+		if s.canMake(perPortion, middle) {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return low
+}
+
+// FillAvailability заполняет available и max_portions позиций по текущему складу.
+// Набор считается по компонентам по умолчанию и недоступен, если в каком-то
+// слоте все варианты сняты с продажи.
+func (r MenuRepository) FillAvailability(menuItems []models.MenuItem) error {
+	snapshot, err := loadStockSnapshot(r.db)
+	if err != nil {
+		return err
+	}
+
+	for i := range menuItems {
+		item := &menuItems[i]
+		perPortion := make(map[int]float64)
+		if err := addLineRequirements(r.db, models.OrderItem{ProductID: item.ID, Quantity: 1}, perPortion); err != nil {
+			return err
+		}
+
+		slots := item.BundleSlots
+		if slots == nil {
+			if slots, err = loadBundleSlots(r.db, item.ID); err != nil {
+				return err
+			}
+		}
+		available := !snapshot.soldOut[item.ID]
+		for _, slot := range slots {
+			slotAvailable := !snapshot.soldOut[slot.ProductID]
+			for _, choice := range slot.Choices {
+				slotAvailable = slotAvailable || !snapshot.soldOut[choice.ProductID]
+			}
+			available = available && slotAvailable
+		}
+		if len(perPortion) > 0 {
+			portions := snapshot.maxPortions(perPortion)
+			item.MaxPortions = &portions
+			available = available && portions > 0
+		}
+		item.Available = &available
+	}
+
+	return nil
+}
+
+// SetSoldOut вручную снимает позицию с продажи («86») или возвращает её
+func (r MenuRepository) SetSoldOut(id int, soldOut bool) error {
+	query := `UPDATE menu_items SET sold_out = $1, updated_at = NOW() WHERE id = $2`
+	result, err := r.db.Exec(query, soldOut, id)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении элемента: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("не удалось получить количество затронутых строк: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: menu item %d", ErrNotFound, id)
+	}
+
+	return nil
+}
+
+// SoldOutProducts возвращает те из productIDs, что сняты с продажи вручную
+func (r MenuRepository) SoldOutProducts(productIDs []int) ([]int, error) {
+	ids := make([]int64, 0, len(productIDs))
+	for _, id := range productIDs {
+		ids = append(ids, int64(id))
+	}
+
+	rows, err := r.db.Query(`SELECT id FROM menu_items WHERE sold_out AND id = ANY($1) ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sold out menu items: %w", err)
+	}
+	defer rows.Close()
+
+	var soldOut []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		soldOut = append(soldOut, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return soldOut, nil
+}
@@ -0,0 +1,169 @@
+package dal
+
+import (
+	"fmt"
+	"slices"
+
+	"frappuccino/models"
+
+	"github.com/lib/pq"
+)
+
+// ingredientTags — аллергены и диеты ингредиента
+type ingredientTags struct {
+	allergens []string
+	diets     []string
+}
+
+// dietarySnapshot — аллергены и диеты всех ингредиентов с учётом рецептов заготовок
+type dietarySnapshot struct {
+	own      map[int]ingredientTags
+	recipes  map[int][]int
+	resolved map[int]ingredientTags
+}
+
+func loadDietarySnapshot(q querier) (dietarySnapshot, error) {
+	snapshot := dietarySnapshot{
+		own:      make(map[int]ingredientTags),
+		recipes:  make(map[int][]int),
+		resolved: make(map[int]ingredientTags),
+	}
+
+	rows, err := q.Query(`SELECT id, allergens, dietary_tags FROM inventory`)
+	if err != nil {
+		return dietarySnapshot{}, fmt.Errorf("failed to load ingredient allergens: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var tags ingredientTags
+		if err := rows.Scan(&id, pq.Array(&tags.allergens), pq.Array(&tags.diets)); err != nil {
+			return dietarySnapshot{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshot.own[id] = tags
+	}
+	if err := rows.Err(); err != nil {
+		return dietarySnapshot{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	rows.Close()
+
+	recipeRows, err := q.Query(`SELECT prepared_id, ingredient_id FROM inventory_recipes`)
+	if err != nil {
+		return dietarySnapshot{}, fmt.Errorf("failed to load prepared ingredient recipes: %w", err)
+	}
+	defer recipeRows.Close()
+	for recipeRows.Next() {
+		var preparedID, ingredientID int
+		if err := recipeRows.Scan(&preparedID, &ingredientID); err != nil {
+			return dietarySnapshot{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshot.recipes[preparedID] = append(snapshot.recipes[preparedID], ingredientID)
+	}
+	if err := recipeRows.Err(); err != nil {
+		return dietarySnapshot{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// tags возвращает аллергены и диеты ингредиента. У заготовки аллергены — её собственные
+// и всех ингредиентов рецепта, а диеты — общие для всех ингредиентов рецепта; заданные
+// у самой заготовки диеты сужают этот список.
+func (s dietarySnapshot) tags(ingredientID, depth int) ingredientTags {
+	if tags, ok := s.resolved[ingredientID]; ok {
+		return tags
+	}
+	recipe := s.recipes[ingredientID]
+	if len(recipe) == 0 || depth == maxRecipeDepth {
+		return s.own[ingredientID]
+	}
+
+	var parts []ingredientTags
+	for _, partID := range recipe {
+		parts = append(parts, s.tags(partID, depth+1))
+	}
+	tags := combineTags(append(parts, ingredientTags{allergens: s.own[ingredientID].allergens}))
+	dietParts := parts
+	if own := s.own[ingredientID].diets; len(own) > 0 {
+		dietParts = append(slices.Clone(parts), ingredientTags{diets: own})
+	}
+	tags.diets = combineTags(dietParts).diets
+	s.resolved[ingredientID] = tags
+	return tags
+}
+
+// combineTags сводит состав: аллергены — объединение, диеты — пересечение.
+// У пустого состава нет ни аллергенов, ни диет.
+func combineTags(parts []ingredientTags) ingredientTags {
+	var combined ingredientTags
+	for i, part := range parts {
+		for _, allergen := range part.allergens {
+			if !slices.Contains(combined.allergens, allergen) {
+				combined.allergens = append(combined.allergens, allergen)
+			}
+		}
+		if i == 0 {
+			combined.diets = slices.Clone(part.diets)
+			continue
+		}
+		combined.diets = slices.DeleteFunc(combined.diets, func(diet string) bool {
+			return !slices.Contains(part.diets, diet)
+		})
+	}
+	return combined
+}
+
+// sortedTags упорядочивает теги как в справочнике (models.Allergens, models.DietaryTags)
+func sortedTags(tags, order []string) []string {
+	sorted := make([]string, 0, len(tags))
+	for _, tag := range order {
+		if slices.Contains(tags, tag) {
+			sorted = append(sorted, tag)
+		}
+	}
+	return sorted
+}
+
+// FillDietary сводит аллергены и диеты позиций из ингредиентов их рецепта.
+// У набора учитываются компоненты по умолчанию и все замены, так что аллерген
+// любой из них попадает в набор. Размерные варианты, модификаторы и добавки не учитываются.
+func (r MenuRepository) FillDietary(menuItems []models.MenuItem) error {
+	snapshot, err := loadDietarySnapshot(r.db)
+	if err != nil {
+		return err
+	}
+
+	for i := range menuItems {
+		item := &menuItems[i]
+		products := []int{item.ID}
+		slots := item.BundleSlots
+		if slots == nil {
+			if slots, err = loadBundleSlots(r.db, item.ID); err != nil {
+				return err
+			}
+		}
+		for _, slot := range slots {
+			products = append(products, slot.ProductID)
+			for _, choice := range slot.Choices {
+				products = append(products, choice.ProductID)
+			}
+		}
+
+		var parts []ingredientTags
+		for _, productID := range products {
+			recipe, err := loadRecipe(r.db, productID)
+			if err != nil {
+				return err
+			}
+			for _, ingredient := range recipe {
+				parts = append(parts, snapshot.tags(ingredient.IngredientID, 0))
+			}
+		}
+
+		tags := combineTags(parts)
+		item.Allergens = sortedTags(tags.allergens, models.Allergens)
+		item.DietaryTags = sortedTags(tags.diets, models.DietaryTags)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package dal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCombineTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []ingredientTags
+		want  ingredientTags
+	}{
+		{name: "empty", parts: nil, want: ingredientTags{}},
+		{
+			name:  "single",
+			parts: []ingredientTags{{allergens: []string{"milk"}, diets: []string{"vegetarian"}}},
+			want:  ingredientTags{allergens: []string{"milk"}, diets: []string{"vegetarian"}},
+		},
+		{
+			name: "allergens union, diets intersection",
+			parts: []ingredientTags{
+				{allergens: []string{"milk"}, diets: []string{"vegan", "vegetarian", "gluten_free"}},
+				{allergens: []string{"gluten", "milk"}, diets: []string{"vegetarian", "vegan"}},
+			},
+			want: ingredientTags{allergens: []string{"milk", "gluten"}, diets: []string{"vegan", "vegetarian"}},
+		},
+		{
+			name: "untagged part drops every diet",
+			parts: []ingredientTags{
+				{diets: []string{"vegan"}},
+				{allergens: []string{"nuts"}},
+			},
+			want: ingredientTags{allergens: []string{"nuts"}, diets: []string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := combineTags(tt.parts)
+			if !slices.Equal(got.allergens, tt.want.allergens) {
+				t.Errorf("allergens = %v, want %v", got.allergens, tt.want.allergens)
+			}
+			if !slices.Equal(got.diets, tt.want.diets) {
+				t.Errorf("diets = %v, want %v", got.diets, tt.want.diets)
+			}
+		})
+	}
+}
+
+// Свои диеты заготовки сужают диеты её рецепта, свои аллергены добавляются к ним
+func TestDietarySnapshotPreparedTags(t *testing.T) {
+	tests := []struct {
+		name string
+		own  ingredientTags
+		want ingredientTags
+	}{
+		{
+			name: "no own tags",
+			own:  ingredientTags{},
+			want: ingredientTags{allergens: []string{"milk"}, diets: []string{"vegetarian", "gluten_free"}},
+		},
+		{
+			name: "own tags narrow recipe",
+			own:  ingredientTags{allergens: []string{"sesame"}, diets: []string{"gluten_free", "vegan"}},
+			want: ingredientTags{allergens: []string{"milk", "sesame"}, diets: []string{"gluten_free"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := dietarySnapshot{
+				own: map[int]ingredientTags{
+					1: tt.own,
+					2: {allergens: []string{"milk"}, diets: []string{"vegetarian", "gluten_free"}},
+					3: {diets: []string{"vegan", "vegetarian", "gluten_free"}},
+				},
+				recipes:  map[int][]int{1: {2, 3}},
+				resolved: make(map[int]ingredientTags),
+			}
+			got := snapshot.tags(1, 0)
+			if !slices.Equal(got.allergens, tt.want.allergens) {
+				t.Errorf("allergens = %v, want %v", got.allergens, tt.want.allergens)
+			}
+			if !slices.Equal(got.diets, tt.want.diets) {
+				t.Errorf("diets = %v, want %v", got.diets, tt.want.diets)
+			}
+		})
+	}
+}
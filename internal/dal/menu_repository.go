@@ -16,8 +16,23 @@ type MenuRepositoryInterface interface {
 	AddMenuItem(menuItem models.MenuItem) (models.MenuItem, error)
 	LoadMenuItems() ([]models.MenuItem, error)
 	GetMenuItemByID(id int) (models.MenuItem, error)
-	DeleteMenuItemByID(id int) error
-	UpdateMenu(id int, changeMenu models.MenuItem) (models.MenuItem, error)
+	DeleteMenuItemByID(id, version int) error
+	UpdateMenu(id int, changeMenu models.MenuItem, version int) (models.MenuItem, error)
+	AddVariant(variant models.MenuItemVariant) (models.MenuItemVariant, error)
+	LoadVariants(menuItemID int) ([]models.MenuItemVariant, error)
+	GetVariant(menuItemID, variantID int) (models.MenuItemVariant, error)
+	UpdateVariant(variant models.MenuItemVariant) (models.MenuItemVariant, error)
+	DeleteVariant(menuItemID, variantID int) error
+	AddModifierGroup(group models.ModifierGroup) (models.ModifierGroup, error)
+	LoadModifierGroups(menuItemID int) ([]models.ModifierGroup, error)
+	DeleteModifierGroup(menuItemID, groupID int) error
+	AddBundleSlot(slot models.BundleSlot) (models.BundleSlot, error)
+	LoadBundleSlots(bundleID int) ([]models.BundleSlot, error)
+	DeleteBundleSlot(bundleID, slotID int) error
+	FillAvailability(menuItems []models.MenuItem) error
+	FillDietary(menuItems []models.MenuItem) error
+	SetSoldOut(id int, soldOut bool) error
+	SoldOutProducts(productIDs []int) ([]int, error)
 }
 
 type MenuRepository struct {
@@ -32,10 +47,10 @@ func (r MenuRepository) AddMenuItem(menuItem models.MenuItem) (models.MenuItem,
 	categories := "{" + strings.Join(menuItem.Categories, ",") + "}"
 
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		query := `INSERT INTO menu_items (name, description, price, categories) 
-			  VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-		err := tx.QueryRow(query, menuItem.Name, menuItem.Description, menuItem.Price, categories).
-			Scan(&menuItem.ID, &menuItem.CreatedAt)
+		query := `INSERT INTO menu_items (name, description, price, categories, tax_category) 
+			  VALUES ($1, $2, $3, $4, $5) RETURNING id, version, created_at`
+		err := tx.QueryRow(query, menuItem.Name, menuItem.Description, menuItem.Price, categories, menuItem.TaxCategory).
+			Scan(&menuItem.ID, &menuItem.Version, &menuItem.CreatedAt)
 		if err != nil {
 			return err
 		}
@@ -60,6 +75,13 @@ func (r MenuRepository) AddMenuItem(menuItem models.MenuItem) (models.MenuItem,
 				return err
 			}
 		}
+
+		for i := range menuItem.BundleSlots {
+			menuItem.BundleSlots[i].BundleID = menuItem.ID
+			if err := insertBundleSlot(tx, &menuItem.BundleSlots[i]); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 	if errTransact != nil {
@@ -72,8 +94,8 @@ func (r MenuRepository) AddMenuItem(menuItem models.MenuItem) (models.MenuItem,
 func (r MenuRepository) LoadMenuItems() ([]models.MenuItem, error) {
 	var menuItems []models.MenuItem
 
-	query := `SELECT id, name, description, price, categories, created_at
-		FROM menu_items`
+	query := `SELECT id, name, description, price, categories, tax_category, sold_out, version, created_at
+		FROM menu_items ORDER BY id`
 
 	rows, err := r.db.Query(query)
 	if err != nil {
@@ -85,7 +107,7 @@ func (r MenuRepository) LoadMenuItems() ([]models.MenuItem, error) {
 		var menuItem models.MenuItem
 
 		if err := rows.Scan(&menuItem.ID, &menuItem.Name, &menuItem.Description, &menuItem.Price,
-			pq.Array(&menuItem.Categories), &menuItem.CreatedAt); err != nil {
+			pq.Array(&menuItem.Categories), &menuItem.TaxCategory, &menuItem.SoldOut, &menuItem.Version, &menuItem.CreatedAt); err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки меню: %v", err)
 		}
 
@@ -103,17 +125,6 @@ func (r MenuRepository) LoadMenuItems() ([]models.MenuItem, error) {
 				return nil, fmt.Errorf("ошибка при сканировании ингредиента: %v", err)
 			}
 
-			var inventoryQuantity float64
-			inventoryQuery := `SELECT quantity FROM inventory WHERE id = $1`
-			err := r.db.QueryRow(inventoryQuery, ingredient.IngredientID).Scan(&inventoryQuantity)
-			if err != nil {
-				return nil, fmt.Errorf("ошибка при проверке наличия ингредиента в инвентаре: %v", err)
-			}
-
-			if inventoryQuantity < ingredient.Quantity {
-				return nil, fmt.Errorf("недостаточно ингредиентов %d в инвентаре", ingredient.IngredientID)
-			}
-
 			ingredients = append(ingredients, ingredient)
 		}
 
@@ -131,7 +142,7 @@ func (r MenuRepository) LoadMenuItems() ([]models.MenuItem, error) {
 func (r MenuRepository) GetMenuItemByID(id int) (models.MenuItem, error) {
 	var menuItem models.MenuItem
 
-	query := `SELECT id, name, description, price, categories, created_at, updated_at
+	query := `SELECT id, name, description, price, categories, tax_category, sold_out, version, created_at, updated_at
 		FROM menu_items WHERE id = $1`
 	err := r.db.QueryRow(query, id).Scan(
 		&menuItem.ID,
@@ -139,6 +150,9 @@ func (r MenuRepository) GetMenuItemByID(id int) (models.MenuItem, error) {
 		&menuItem.Description,
 		&menuItem.Price,
 		pq.Array(&menuItem.Categories),
+		&menuItem.TaxCategory,
+		&menuItem.SoldOut,
+		&menuItem.Version,
 		&menuItem.CreatedAt,
 		&menuItem.UpdatedAt,
 	)
@@ -172,6 +186,21 @@ func (r MenuRepository) GetMenuItemByID(id int) (models.MenuItem, error) {
 		return models.MenuItem{}, fmt.Errorf("ошибка при итерации ингредиентов: %v", err)
 	}
 
+	menuItem.Variants, err = r.LoadVariants(menuItem.ID)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+
+	menuItem.ModifierGroups, err = r.LoadModifierGroups(menuItem.ID)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+
+	menuItem.BundleSlots, err = r.LoadBundleSlots(menuItem.ID)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+
 	return menuItem, nil
 }
 
@@ -189,11 +218,61 @@ func (r MenuRepository) GetProductPrice(productID int) (float64, error) {
 	return price, err
 }
 
-func (r MenuRepository) DeleteMenuItemByID(id int) error {
+// GetProductTaxCategory возвращает налоговую категорию позиции меню
+func (r MenuRepository) GetProductTaxCategory(productID int) (string, error) {
+	query := `SELECT tax_category FROM menu_items WHERE id = $1`
+	var taxCategory string
+	err := r.db.QueryRow(query, productID).Scan(&taxCategory)
+	return taxCategory, err
+}
+
+// GetProductCategories возвращает категории позиции меню (для акций и правил цены по категории)
+func (r MenuRepository) GetProductCategories(productID int) ([]string, error) {
+	query := `SELECT COALESCE(categories, '{}') FROM menu_items WHERE id = $1`
+	var categories []string
+	err := r.db.QueryRow(query, productID).Scan(pq.Array(&categories))
+	return categories, err
+}
+
+func (r MenuRepository) GetIngredientSubstitute(ingredientID, substituteID int) (models.IngredientSubstitute, error) {
+	query := `SELECT ingredient_id, substitute_id, price_delta FROM ingredient_substitutes
+		WHERE ingredient_id = $1 AND substitute_id = $2`
+	var substitute models.IngredientSubstitute
+	err := r.db.QueryRow(query, ingredientID, substituteID).Scan(&substitute.IngredientID, &substitute.SubstituteID, &substitute.PriceDelta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IngredientSubstitute{}, fmt.Errorf("%w: ingredient %d cannot be replaced with %d", ErrNotFound, ingredientID, substituteID)
+	}
+	return substitute, err
+}
+
+func (r MenuRepository) GetMenuExtra(code string) (models.MenuExtra, error) {
+	query := `SELECT code, name, ingredient_id, quantity, price_delta FROM menu_extras WHERE code = $1`
+	var extra models.MenuExtra
+	err := r.db.QueryRow(query, code).Scan(&extra.Code, &extra.Name, &extra.IngredientID, &extra.Quantity, &extra.PriceDelta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.MenuExtra{}, fmt.Errorf("%w: extra %q", ErrNotFound, code)
+	}
+	return extra, err
+}
+
+// touchMenuItem увеличивает версию позиции меню (триггер bump_version), когда меняются
+// её варианты, группы модификаторов или слоты набора: они входят в GET /menu/{id}
+func touchMenuItem(tx *sql.Tx, menuItemID int) error {
+	if _, err := tx.Exec(`UPDATE menu_items SET updated_at = NOW() WHERE id = $1`, menuItemID); err != nil {
+		return fmt.Errorf("failed to bump menu item version: %w", err)
+	}
+	return nil
+}
+
+// DeleteMenuItemByID удаляет позицию меню, если её версия совпадает с version (0 — без проверки)
+func (r MenuRepository) DeleteMenuItemByID(id, version int) error {
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		query := `DELETE FROM menu_items WHERE id = $1`
-		res, err := tx.Exec(query, id)
+		query := `DELETE FROM menu_items WHERE id = $1 AND ($2 = 0 OR version = $2)`
+		res, err := tx.Exec(query, id, version)
 		if err != nil {
+			if strings.Contains(err.Error(), "foreign key") {
+				return fmt.Errorf("%w: menu item %d is part of a bundle", ErrMenuItemInBundle, id)
+			}
 			return fmt.Errorf("ошибка при удалении элемента: %v", err)
 		}
 
@@ -203,11 +282,7 @@ func (r MenuRepository) DeleteMenuItemByID(id int) error {
 		}
 
 		if rowsAffected == 0 {
-			return fmt.Errorf("inventory item с ID %d не найден", id)
-		}
-
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("ошибка при коммите транзакции: %v", err)
+			return versionOrNotFound(tx, "menu_items", id, fmt.Errorf("menu item с ID %d не найден", id))
 		}
 		return nil
 	})
@@ -218,7 +293,8 @@ func (r MenuRepository) DeleteMenuItemByID(id int) error {
 	return nil
 }
 
-func (r MenuRepository) UpdateMenu(id int, changeMenu models.MenuItem) (models.MenuItem, error) {
+// UpdateMenu обновляет позицию меню; version — ожидаемая версия (0 — без проверки)
+func (r MenuRepository) UpdateMenu(id int, changeMenu models.MenuItem, version int) (models.MenuItem, error) {
 	var existingItem models.MenuItem
 
 	query := `SELECT id, name, description, price, categories FROM menu_items WHERE id = $1`
@@ -241,7 +317,11 @@ func (r MenuRepository) UpdateMenu(id int, changeMenu models.MenuItem) (models.M
 	}
 
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		updateQuery := `UPDATE menu_items SET name = $1, description = $2, price = $3, categories = $4, updated_at = NOW() WHERE id = $5 RETURNING id, name, description, price, categories, created_at, updated_at`
+		// Пустая tax_category оставляет текущую налоговую категорию
+		updateQuery := `UPDATE menu_items SET name = $1, description = $2, price = $3, categories = $4,
+			tax_category = COALESCE(NULLIF($7, ''), tax_category), updated_at = NOW()
+			WHERE id = $5 AND ($6 = 0 OR version = $6)
+			RETURNING id, name, description, price, categories, tax_category, sold_out, version, created_at, updated_at`
 		err = tx.QueryRow(
 			updateQuery,
 			changeMenu.Name,
@@ -249,15 +329,23 @@ func (r MenuRepository) UpdateMenu(id int, changeMenu models.MenuItem) (models.M
 			changeMenu.Price,
 			pq.Array(&changeMenu.Categories),
 			id,
+			version,
+			changeMenu.TaxCategory,
 		).Scan(
 			&existingItem.ID,
 			&existingItem.Name,
 			&existingItem.Description,
 			&existingItem.Price,
 			pq.Array(&existingItem.Categories),
+			&existingItem.TaxCategory,
+			&existingItem.SoldOut,
+			&existingItem.Version,
 			&existingItem.CreatedAt,
 			&existingItem.UpdatedAt,
 		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return versionOrNotFound(tx, "menu_items", id, fmt.Errorf("menu item с ID %d не найден", id))
+		}
 
 		for _, ingredient := range changeMenu.Ingredients {
 			queryUpdateIngredients := `UPDATE menu_item_ingredients 
@@ -0,0 +1,173 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+)
+
+func (r MenuRepository) AddVariant(variant models.MenuItemVariant) (models.MenuItemVariant, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO menu_item_variants (menu_item_id, size, price)
+			VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`
+		err := tx.QueryRow(query, variant.MenuItemID, variant.Size, variant.Price).
+			Scan(&variant.ID, &variant.CreatedAt, &variant.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := insertVariantIngredients(tx, variant.ID, variant.Ingredients); err != nil {
+			return err
+		}
+		return touchMenuItem(tx, variant.MenuItemID)
+	})
+	if errTransact != nil {
+		return models.MenuItemVariant{}, errTransact
+	}
+
+	return variant, nil
+}
+
+func (r MenuRepository) LoadVariants(menuItemID int) ([]models.MenuItemVariant, error) {
+	query := `SELECT id, menu_item_id, size, price, created_at, updated_at
+		FROM menu_item_variants WHERE menu_item_id = $1 ORDER BY price`
+
+	rows, err := r.db.Query(query, menuItemID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса для вариантов: %v", err)
+	}
+	defer rows.Close()
+
+	var variants []models.MenuItemVariant
+	for rows.Next() {
+		var variant models.MenuItemVariant
+		if err := rows.Scan(&variant.ID, &variant.MenuItemID, &variant.Size, &variant.Price, &variant.CreatedAt, &variant.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании варианта: %v", err)
+		}
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации вариантов: %v", err)
+	}
+
+	for i := range variants {
+		if variants[i].Ingredients, err = loadVariantRecipe(r.db, variants[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return variants, nil
+}
+
+func (r MenuRepository) GetVariant(menuItemID, variantID int) (models.MenuItemVariant, error) {
+	var variant models.MenuItemVariant
+
+	query := `SELECT id, menu_item_id, size, price, created_at, updated_at
+		FROM menu_item_variants WHERE id = $1 AND menu_item_id = $2`
+	err := r.db.QueryRow(query, variantID, menuItemID).
+		Scan(&variant.ID, &variant.MenuItemID, &variant.Size, &variant.Price, &variant.CreatedAt, &variant.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MenuItemVariant{}, fmt.Errorf("%w: variant %d of menu item %d", ErrNotFound, variantID, menuItemID)
+		}
+		return models.MenuItemVariant{}, fmt.Errorf("ошибка при получении варианта: %v", err)
+	}
+
+	variant.Ingredients, err = loadVariantRecipe(r.db, variant.ID)
+	if err != nil {
+		return models.MenuItemVariant{}, err
+	}
+
+	return variant, nil
+}
+
+// UpdateVariant меняет размер, цену и полностью заменяет рецепт варианта
+func (r MenuRepository) UpdateVariant(variant models.MenuItemVariant) (models.MenuItemVariant, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `UPDATE menu_item_variants SET size = $3, price = $4, updated_at = NOW()
+			WHERE id = $1 AND menu_item_id = $2 RETURNING created_at, updated_at`
+		err := tx.QueryRow(query, variant.ID, variant.MenuItemID, variant.Size, variant.Price).
+			Scan(&variant.CreatedAt, &variant.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: variant %d of menu item %d", ErrNotFound, variant.ID, variant.MenuItemID)
+			}
+			return fmt.Errorf("ошибка при обновлении варианта: %v", err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM menu_item_variant_ingredients WHERE variant_id = $1`, variant.ID); err != nil {
+			return fmt.Errorf("ошибка при обновлении ингредиентов варианта: %v", err)
+		}
+		if err := insertVariantIngredients(tx, variant.ID, variant.Ingredients); err != nil {
+			return err
+		}
+		return touchMenuItem(tx, variant.MenuItemID)
+	})
+	if errTransact != nil {
+		return models.MenuItemVariant{}, errTransact
+	}
+
+	return variant, nil
+}
+
+func (r MenuRepository) DeleteVariant(menuItemID, variantID int) error {
+	return database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `DELETE FROM menu_item_variants WHERE id = $1 AND menu_item_id = $2`
+		result, err := tx.Exec(query, variantID, menuItemID)
+		if err != nil {
+			if strings.Contains(err.Error(), "foreign key") {
+				return fmt.Errorf("%w: variant %d of menu item %d", ErrVariantInUse, variantID, menuItemID)
+			}
+			return fmt.Errorf("ошибка при удалении варианта: %v", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("не удалось получить количество затронутых строк: %v", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("%w: variant %d of menu item %d", ErrNotFound, variantID, menuItemID)
+		}
+
+		return touchMenuItem(tx, menuItemID)
+	})
+}
+
+func insertVariantIngredients(tx *sql.Tx, variantID int, ingredients []models.MenuItemIngredient) error {
+	query := `INSERT INTO menu_item_variant_ingredients (variant_id, ingredient_id, quantity) VALUES ($1, $2, $3)`
+	for _, ingredient := range ingredients {
+		if _, err := tx.Exec(query, variantID, ingredient.IngredientID, ingredient.Quantity); err != nil {
+			return fmt.Errorf("ошибка при добавлении ингредиента варианта: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadVariantRecipe возвращает ингредиенты размерного варианта
+func loadVariantRecipe(q querier, variantID int) ([]models.MenuItemIngredient, error) {
+	query := `SELECT ingredient_id, quantity FROM menu_item_variant_ingredients WHERE variant_id = $1`
+	rows, err := q.Query(query, variantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load variant recipe: %w", err)
+	}
+	defer rows.Close()
+
+	var recipe []models.MenuItemIngredient
+	for rows.Next() {
+		var ingredient models.MenuItemIngredient
+		if err := rows.Scan(&ingredient.IngredientID, &ingredient.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		recipe = append(recipe, ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return recipe, nil
+}
@@ -0,0 +1,109 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+)
+
+func (r MenuRepository) AddModifierGroup(group models.ModifierGroup) (models.ModifierGroup, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO modifier_groups (menu_item_id, name, required, min_selections, max_selections)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		err := tx.QueryRow(query, group.MenuItemID, group.Name, group.Required, group.MinSelections, group.MaxSelections).
+			Scan(&group.ID)
+		if err != nil {
+			return err
+		}
+
+		queryModifier := `INSERT INTO modifiers (group_id, name, price_delta, ingredient_id, quantity)
+			VALUES ($1, $2, $3, NULLIF($4, 0), $5) RETURNING id`
+		for i := range group.Modifiers {
+			group.Modifiers[i].GroupID = group.ID
+			modifier := group.Modifiers[i]
+			err := tx.QueryRow(queryModifier, group.ID, modifier.Name, modifier.PriceDelta, modifier.IngredientID, modifier.Quantity).
+				Scan(&group.Modifiers[i].ID)
+			if err != nil {
+				return err
+			}
+		}
+		return touchMenuItem(tx, group.MenuItemID)
+	})
+	if errTransact != nil {
+		return models.ModifierGroup{}, errTransact
+	}
+
+	return group, nil
+}
+
+// LoadModifierGroups возвращает группы модификаторов позиции меню вместе с модификаторами
+func (r MenuRepository) LoadModifierGroups(menuItemID int) ([]models.ModifierGroup, error) {
+	query := `SELECT id, menu_item_id, name, required, min_selections, max_selections
+		FROM modifier_groups WHERE menu_item_id = $1 ORDER BY id`
+
+	rows, err := r.db.Query(query, menuItemID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса для групп модификаторов: %v", err)
+	}
+	defer rows.Close()
+
+	var groups []models.ModifierGroup
+	for rows.Next() {
+		var group models.ModifierGroup
+		if err := rows.Scan(&group.ID, &group.MenuItemID, &group.Name, &group.Required, &group.MinSelections, &group.MaxSelections); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании группы модификаторов: %v", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации групп модификаторов: %v", err)
+	}
+
+	queryModifiers := `SELECT id, group_id, name, price_delta, COALESCE(ingredient_id, 0), quantity
+		FROM modifiers WHERE group_id = $1 ORDER BY id`
+	for i := range groups {
+		modifierRows, err := r.db.Query(queryModifiers, groups[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при выполнении запроса для модификаторов: %v", err)
+		}
+
+		groups[i].Modifiers = []models.Modifier{}
+		for modifierRows.Next() {
+			var modifier models.Modifier
+			if err := modifierRows.Scan(&modifier.ID, &modifier.GroupID, &modifier.Name, &modifier.PriceDelta, &modifier.IngredientID, &modifier.Quantity); err != nil {
+				modifierRows.Close()
+				return nil, fmt.Errorf("ошибка при сканировании модификатора: %v", err)
+			}
+			groups[i].Modifiers = append(groups[i].Modifiers, modifier)
+		}
+		err = modifierRows.Err()
+		modifierRows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при итерации модификаторов: %v", err)
+		}
+	}
+
+	return groups, nil
+}
+
+func (r MenuRepository) DeleteModifierGroup(menuItemID, groupID int) error {
+	return database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		query := `DELETE FROM modifier_groups WHERE id = $1 AND menu_item_id = $2`
+		result, err := tx.Exec(query, groupID, menuItemID)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении группы модификаторов: %v", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("не удалось получить количество затронутых строк: %v", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("%w: modifier group %d of menu item %d", ErrNotFound, groupID, menuItemID)
+		}
+
+		return touchMenuItem(tx, menuItemID)
+	})
+}
@@ -7,26 +7,29 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"frappuccino/internal/database"
 	"frappuccino/models"
 	"frappuccino/utils"
+
+	"github.com/lib/pq"
 )
 
 type OrderRepositoryInterface interface {
 	AddOrder(order models.Order) (models.Order, error)
 	LoadOrders() ([]models.Order, error)
+	LoadCustomerOrders(customerID int) ([]models.Order, error)
 	LoadOrder(id int) (models.Order, error)
-	DeleteOrderByID(id int) error
-	UpdateOrder(id int) (models.Order, error)
-	CloseOrder(id int) (models.Order, []struct {
-		IngredientID int     `json:"ingredient_id"`
-		Name         string  `json:"name"`
-		QuantityUsed float64 `json:"quantity_used"`
-		Remaining    float64 `json:"remaining"`
-	}, error)
+	DeleteOrderByID(id, version int) error
+	UpdateOrder(id int, changeOrder models.Order, version int) (models.Order, error)
+	UpdateOrderStatus(id int, from, to string, change models.OrderStatusChange) (models.Order, error)
+	ReplaceOrderItems(id int, from string, order models.Order) (models.Order, error)
+	CloseOrder(id int, from string, change models.OrderStatusChange, requirePaid bool, pointsTTL time.Duration) (models.Order, []models.InventoryUpdate, error)
+	ProcessBatch(orders []models.Order, mode string, change models.OrderStatusChange, requirePaid bool, pointsTTL time.Duration) ([]BatchOrderOutcome, bool, error)
 	GetOrderedItemsCount(start, end time.Time) (map[string]int, error)
+	LoadStatusHistory(orderID int) ([]models.OrderStatusHistoryEntry, error)
 }
 
 type OrderRepository struct {
@@ -39,77 +42,102 @@ func NewOrderRepository(db *sql.DB) OrderRepository {
 
 // Method for adding a new order to the database
 func (r OrderRepository) AddOrder(order models.Order) (models.Order, error) {
-	query := `INSERT INTO orders (name, total_amount, special_instructions)
-			VALUES ($1, $2, $3)
-			RETURNING id, name, status, total_amount, special_instructions, created_at, updated_at`
-
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		specialInstructionsByte, err := json.Marshal(order.SpecialInstructions)
-		if err != nil {
-			return err
-		}
-		var specialInstructionsData []byte
-		if err := tx.QueryRow(
-			query,
-			order.CustomerName,
-			order.TotalAmount,
-			specialInstructionsByte,
-		).Scan(&order.ID, &order.CustomerName, &order.Status, &order.TotalAmount, &specialInstructionsData, &order.CreatedAt, &order.UpdatedAt); err != nil {
-			log.Printf("Error inserting order: %v", err)
-			return err
-		}
-		// Декодируем JSONB в map[string]string
-		if err := json.Unmarshal(specialInstructionsData, &order.SpecialInstructions); err != nil {
-			return err
-		}
-
-		queryPrice := `SELECT price FROM menu_items WHERE id = $1`
-		for i := range order.Items {
-			err := tx.QueryRow(queryPrice, order.Items[i].ProductID).Scan(&order.Items[i].Price)
-			if err != nil {
-				return err
-			}
-
-			query := `INSERT INTO order_items (order_id, menu_item_id, quantity, price)
-				  VALUES ($1, $2, $3, $4)
-				  ON CONFLICT (order_id, menu_item_id) DO NOTHING`
-			_, err = tx.Exec(query, order.ID, order.Items[i].ProductID, order.Items[i].Quantity, order.Items[i].Price)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		var err error
+		order, err = insertOrder(tx, order)
+		return err
 	})
 	if errTransact != nil {
 		return models.Order{}, errTransact
 	}
 
-	queryItems := `SELECT menu_item_id, quantity, price FROM order_items WHERE order_id = $1`
-	rows, err := r.db.Query(queryItems, order.ID)
+	items, err := loadOrderItems(r.db, order.ID)
 	if err != nil {
-		return models.Order{}, fmt.Errorf("error getting list of order items: %w", err)
+		return models.Order{}, err
 	}
-	defer rows.Close()
+	order.Items = items
 
-	var items []models.OrderItem
-	for rows.Next() {
-		var item models.OrderItem
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-			return models.Order{}, fmt.Errorf("error scanning items: %w", err)
+	return order, nil
+}
+
+// insertOrder создаёт заказ с позициями и резервирует под него ингредиенты
+func insertOrder(tx *sql.Tx, order models.Order) (models.Order, error) {
+	query := `INSERT INTO orders (name, order_type, subtotal, promo_code, discount_amount, tax_amount, tax_inclusive,
+				total_amount, special_instructions, customer_id)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, NULLIF($10, 0))
+			RETURNING id, name, COALESCE(customer_id, 0), status, order_type, subtotal, COALESCE(promo_code, ''), discount_amount,
+				tax_amount, tax_inclusive, total_amount, special_instructions, version, created_at, updated_at`
+
+	specialInstructionsByte, err := json.Marshal(order.SpecialInstructions)
+	if err != nil {
+		return models.Order{}, err
+	}
+	var specialInstructionsData []byte
+	if err := tx.QueryRow(
+		query,
+		order.CustomerName,
+		order.OrderType,
+		order.Subtotal,
+		order.PromoCode,
+		order.DiscountAmount,
+		order.TaxAmount,
+		order.TaxInclusive,
+		order.TotalAmount,
+		specialInstructionsByte,
+		order.CustomerID,
+	).Scan(&order.ID, &order.CustomerName, &order.CustomerID, &order.Status, &order.OrderType, &order.Subtotal, &order.PromoCode, &order.DiscountAmount,
+		&order.TaxAmount, &order.TaxInclusive, &order.TotalAmount, &specialInstructionsData, &order.Version, &order.CreatedAt, &order.UpdatedAt); err != nil {
+		log.Printf("Error inserting order: %v", err)
+		return models.Order{}, err
+	}
+	// Декодируем JSONB в map[string]string
+	if err := json.Unmarshal(specialInstructionsData, &order.SpecialInstructions); err != nil {
+		return models.Order{}, err
+	}
+
+	// Триггер пишет историю только на UPDATE, поэтому первый статус фиксируем сами
+	queryHistory := `INSERT INTO order_status_history (order_id, status, notes) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(queryHistory, order.ID, order.Status, "Order received"); err != nil {
+		return models.Order{}, err
+	}
+
+	for i := range order.Items {
+		if order.Items[i].ID, err = insertOrderItem(tx, order.ID, order.Items[i]); err != nil {
+			return models.Order{}, err
 		}
-		items = append(items, item)
 	}
-	order.Items = items
 
+	if err := saveOrderDiscounts(tx, order.ID, order.Discounts); err != nil {
+		return models.Order{}, err
+	}
+	if err := saveOrderTaxes(tx, order.ID, order.Taxes); err != nil {
+		return models.Order{}, err
+	}
+
+	// Резервируем ингредиенты сразу, чтобы не принять заказ, который не из чего приготовить
+	if err := reserveIngredients(tx, order.ID); err != nil {
+		return models.Order{}, err
+	}
 	return order, nil
 }
 
 func (r OrderRepository) LoadOrders() ([]models.Order, error) {
+	return r.queryOrders(``)
+}
+
+// LoadCustomerOrders возвращает заказы клиента, новые первыми
+func (r OrderRepository) LoadCustomerOrders(customerID int) ([]models.Order, error) {
+	return r.queryOrders(` WHERE customer_id = $1 ORDER BY created_at DESC, id DESC`, customerID)
+}
+
+// queryOrders загружает заказы с позициями, скидками и налогами; filter — условие и порядок выборки
+func (r OrderRepository) queryOrders(filter string, args ...any) ([]models.Order, error) {
 	var orders []models.Order
 
-	// Получаем все заказы
-	query := `SELECT id, name, status, total_amount, special_instructions, created_at, updated_at FROM orders`
-	rows, err := r.db.Query(query)
+	query := `SELECT id, name, COALESCE(customer_id, 0), status, order_type, ` + subtotalSQL + `, COALESCE(promo_code, ''),
+		discount_amount, tax_amount, tax_inclusive, total_amount,
+		special_instructions, version, created_at, updated_at FROM orders` + filter
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("Query execution error: %v", err)
 	}
@@ -120,7 +148,9 @@ func (r OrderRepository) LoadOrders() ([]models.Order, error) {
 		var specialInstructionsStr string
 
 		// Сканируем данные заказа
-		if err := rows.Scan(&order.ID, &order.CustomerName, &order.Status, &order.TotalAmount, &specialInstructionsStr, &order.CreatedAt, &order.UpdatedAt); err != nil {
+		if err := rows.Scan(&order.ID, &order.CustomerName, &order.CustomerID, &order.Status, &order.OrderType, &order.Subtotal, &order.PromoCode,
+			&order.DiscountAmount, &order.TaxAmount, &order.TaxInclusive, &order.TotalAmount, &specialInstructionsStr,
+			&order.Version, &order.CreatedAt, &order.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("line scan error: %v", err)
 		}
 
@@ -130,22 +160,19 @@ func (r OrderRepository) LoadOrders() ([]models.Order, error) {
 		}
 
 		// Загружаем товары для этого заказа
-		queryItems := `SELECT menu_item_id, quantity, price FROM order_items WHERE order_id = $1`
-		itemRows, err := r.db.Query(queryItems, order.ID)
+		items, err := loadOrderItems(r.db, order.ID)
 		if err != nil {
-			return nil, fmt.Errorf("error getting list of order items: %w", err)
+			return nil, err
 		}
-		defer itemRows.Close() // Отдельный `defer` для товаров
+		order.Items = items
 
-		var items []models.OrderItem
-		for itemRows.Next() {
-			var item models.OrderItem
-			if err := itemRows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-				return nil, fmt.Errorf("error scanning items: %w", err)
-			}
-			items = append(items, item)
+		if order.Discounts, err = loadOrderDiscounts(r.db, order.ID); err != nil {
+			return nil, err
+		}
+		order.RedeemPoints = redeemedPoints(order.Discounts)
+		if order.Taxes, err = loadOrderTaxes(r.db, order.ID); err != nil {
+			return nil, err
 		}
-		order.Items = items
 
 		orders = append(orders, order)
 	}
@@ -161,19 +188,29 @@ func (r OrderRepository) LoadOrders() ([]models.Order, error) {
 func (r OrderRepository) LoadOrder(id int) (models.Order, error) {
 	var order models.Order
 	var specialInstructionsStr string
-	query := `SELECT id, name, status, total_amount, special_instructions, created_at, updated_at FROM orders WHERE id = $1`
+	query := `SELECT id, name, COALESCE(customer_id, 0), status, order_type, ` + subtotalSQL + `, COALESCE(promo_code, ''),
+		discount_amount, tax_amount, tax_inclusive, total_amount,
+		special_instructions, version, created_at, updated_at FROM orders WHERE id = $1`
 	err := r.db.QueryRow(query, id).Scan(
 		&order.ID,
 		&order.CustomerName,
+		&order.CustomerID,
 		&order.Status,
+		&order.OrderType,
+		&order.Subtotal,
+		&order.PromoCode,
+		&order.DiscountAmount,
+		&order.TaxAmount,
+		&order.TaxInclusive,
 		&order.TotalAmount,
 		&specialInstructionsStr,
+		&order.Version,
 		&order.CreatedAt,
 		&order.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Order{}, fmt.Errorf("order with ID %d not found", id)
+			return models.Order{}, fmt.Errorf("order with ID %d %w", id, ErrNotFound)
 		}
 		return models.Order{}, fmt.Errorf("error getting element: %v", err)
 	}
@@ -185,30 +222,172 @@ func (r OrderRepository) LoadOrder(id int) (models.Order, error) {
 	order.SpecialInstructions = specialInstructions
 
 	// Загружаем товары для этого заказа
-	queryItems := `SELECT menu_item_id, quantity, price FROM order_items WHERE order_id = $1`
-	itemRows, err := r.db.Query(queryItems, order.ID)
+	items, err := loadOrderItems(r.db, order.ID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order.Items = items
+
+	if order.Discounts, err = loadOrderDiscounts(r.db, order.ID); err != nil {
+		return models.Order{}, err
+	}
+	order.RedeemPoints = redeemedPoints(order.Discounts)
+	if order.Taxes, err = loadOrderTaxes(r.db, order.ID); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// subtotalSQL — сумма позиций; у заказов, созданных до учёта налогов, она равна итогу
+const subtotalSQL = `COALESCE(subtotal, total_amount)`
+
+// loadOrderTaxes загружает налоги заказа
+func loadOrderTaxes(q querier, orderID int) ([]models.OrderTax, error) {
+	query := `SELECT name, rate, taxable_amount, amount FROM order_taxes WHERE order_id = $1 ORDER BY id`
+	rows, err := q.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting order taxes: %w", err)
+	}
+	defer rows.Close()
+
+	taxes := []models.OrderTax{}
+	for rows.Next() {
+		var tax models.OrderTax
+		if err := rows.Scan(&tax.Name, &tax.Rate, &tax.TaxableAmount, &tax.Amount); err != nil {
+			return nil, fmt.Errorf("error scanning taxes: %w", err)
+		}
+		taxes = append(taxes, tax)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating taxes: %w", err)
+	}
+	return taxes, nil
+}
+
+// saveOrderTaxes заменяет налоги заказа пересчитанными сервисом
+func saveOrderTaxes(tx *sql.Tx, orderID int, taxes []models.OrderTax) error {
+	if _, err := tx.Exec(`DELETE FROM order_taxes WHERE order_id = $1`, orderID); err != nil {
+		return fmt.Errorf("failed to delete order taxes: %w", err)
+	}
+
+	query := `INSERT INTO order_taxes (order_id, name, rate, taxable_amount, amount) VALUES ($1, $2, $3, $4, $5)`
+	for _, tax := range taxes {
+		if _, err := tx.Exec(query, orderID, tax.Name, tax.Rate, tax.TaxableAmount, tax.Amount); err != nil {
+			return fmt.Errorf("failed to insert order tax: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadOrderItems загружает позиции заказа. Строки вычитываются полностью до
+// возврата, поэтому функцию можно вызывать и внутри транзакции.
+func loadOrderItems(q querier, orderID int) ([]models.OrderItem, error) {
+	queryItems := `SELECT id, menu_item_id, COALESCE(variant_id, 0), quantity, price, customizations,
+			COALESCE(pricing_rule_id, 0), COALESCE(pricing_rule_name, ''),
+			COALESCE(priced_at, (SELECT created_at FROM orders WHERE id = order_id))
+		FROM order_items WHERE order_id = $1 ORDER BY id`
+	rows, err := q.Query(queryItems, orderID)
 	if err != nil {
-		return models.Order{}, fmt.Errorf("error getting list of order items: %w", err)
+		return nil, fmt.Errorf("error getting list of order items: %w", err)
 	}
-	defer itemRows.Close() // Отдельный `defer` для товаров
+	defer rows.Close()
 
 	var items []models.OrderItem
-	for itemRows.Next() {
+	for rows.Next() {
 		var item models.OrderItem
-		if err := itemRows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-			return models.Order{}, fmt.Errorf("ошибка при сканировании товаров: %w", err)
+		var customizations []byte
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.VariantID, &item.Quantity, &item.Price, &customizations,
+			&item.PricingRuleID, &item.PricingRule, &item.PricedAt); err != nil {
+			return nil, fmt.Errorf("error scanning items: %w", err)
+		}
+		if err := json.Unmarshal(customizations, &item.Customizations); err != nil {
+			return nil, fmt.Errorf("error decoding customizations: %w", err)
 		}
 		items = append(items, item)
 	}
-	order.Items = items
 
-	return order, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating items: %w", err)
+	}
+
+	return items, nil
+}
+
+func insertOrderItem(tx *sql.Tx, orderID int, item models.OrderItem) (int, error) {
+	customizations, err := json.Marshal(item.Customizations)
+	if err != nil {
+		return 0, fmt.Errorf("JSON marshaling error: %w", err)
+	}
+
+	query := `INSERT INTO order_items (order_id, menu_item_id, variant_id, quantity, price, customizations,
+			pricing_rule_id, pricing_rule_name, priced_at)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), COALESCE($9, NOW())) RETURNING id`
+	var id int
+	if err := tx.QueryRow(query, orderID, item.ProductID, item.VariantID, item.Quantity, item.Price, customizations,
+		item.PricingRuleID, item.PricingRule, pricedAt(item)).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert order item: %w", err)
+	}
+	return id, nil
+}
+
+// pricedAt — время расчёта цены позиции; без него берётся текущее
+func pricedAt(item models.OrderItem) sql.NullTime {
+	return sql.NullTime{Time: item.PricedAt, Valid: !item.PricedAt.IsZero()}
 }
 
-func (r OrderRepository) DeleteOrderByID(id int) error {
+// syncOrderItems приводит позиции заказа к переданному списку: позиции с ID
+// обновляются, без ID — добавляются, не попавшие в список удаляются
+func syncOrderItems(tx *sql.Tx, orderID int, items []models.OrderItem) error {
+	keep := make([]int64, 0, len(items))
+	for _, item := range items {
+		if item.ID != 0 {
+			keep = append(keep, int64(item.ID))
+		}
+	}
+
+	queryDelete := `DELETE FROM order_items WHERE order_id = $1 AND NOT (id = ANY($2))`
+	if _, err := tx.Exec(queryDelete, orderID, pq.Array(keep)); err != nil {
+		return fmt.Errorf("failed to remove order items: %w", err)
+	}
+
+	queryUpdate := `UPDATE order_items SET menu_item_id = $3, variant_id = NULLIF($4, 0), quantity = $5, price = $6, customizations = $7,
+			pricing_rule_id = NULLIF($8, 0), pricing_rule_name = NULLIF($9, ''), priced_at = COALESCE($10, priced_at, NOW())
+		WHERE id = $1 AND order_id = $2`
+	for _, item := range items {
+		if item.ID == 0 {
+			if _, err := insertOrderItem(tx, orderID, item); err != nil {
+				return err
+			}
+			continue
+		}
+
+		customizations, err := json.Marshal(item.Customizations)
+		if err != nil {
+			return fmt.Errorf("JSON marshaling error: %w", err)
+		}
+
+		result, err := tx.Exec(queryUpdate, item.ID, orderID, item.ProductID, item.VariantID, item.Quantity, item.Price, customizations,
+			item.PricingRuleID, item.PricingRule, pricedAt(item))
+		if err != nil {
+			return fmt.Errorf("order Item Update Error: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get number of affected rows: %v", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("item %d not found in order %d", item.ID, orderID)
+		}
+	}
+
+	return nil
+}
+
+// DeleteOrderByID удаляет заказ, если его версия совпадает с version (0 — без проверки)
+func (r OrderRepository) DeleteOrderByID(id, version int) error {
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		queryDelete := `DELETE FROM orders WHERE id = $1`
-		result, err := tx.Exec(queryDelete, id)
+		queryDelete := `DELETE FROM orders WHERE id = $1 AND ($2 = 0 OR version = $2)`
+		result, err := tx.Exec(queryDelete, id, version)
 		if err != nil {
 			return fmt.Errorf("error while deleting element: %v", err)
 		}
@@ -219,11 +398,7 @@ func (r OrderRepository) DeleteOrderByID(id int) error {
 		}
 
 		if rowsAffected == 0 {
-			return fmt.Errorf("order with ID %d not found", id)
-		}
-
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("error committing transaction: %v", err)
+			return versionOrNotFound(tx, "orders", id, fmt.Errorf("order with ID %d %w", id, ErrNotFound))
 		}
 		return nil
 	})
@@ -234,16 +409,10 @@ func (r OrderRepository) DeleteOrderByID(id int) error {
 	return nil
 }
 
-// Обновление заказа
-func (r OrderRepository) UpdateOrder(id int, changeOrder models.Order) (models.Order, error) {
-	order, errLoad := r.LoadOrder(id)
-	if errLoad != nil {
-		return order, errLoad
-	}
-	if order.Status == "closed" {
-		return models.Order{}, fmt.Errorf("this order with %d is closed", id)
-	}
-
+// Обновление заказа. version — ожидаемая версия заказа (0 — без проверки).
+// Статус и версия проверяются под блокировкой заказа, поэтому параллельное
+// закрытие не будет перезаписано.
+func (r OrderRepository) UpdateOrder(id int, changeOrder models.Order, version int) (models.Order, error) {
 	var orderUpdated models.Order
 	var specialInstructionsJSON []byte
 
@@ -254,13 +423,41 @@ func (r OrderRepository) UpdateOrder(id int, changeOrder models.Order) (models.O
 
 	queryUpdate := `
         UPDATE orders 
-        SET name = $2, status = $3, total_amount = $4, special_instructions = $5::jsonb, updated_at = NOW() 
-        WHERE id = $1 
-        RETURNING *`
+        SET name = $2, order_type = $3, subtotal = $4, promo_code = NULLIF($5, ''), discount_amount = $6, tax_amount = $7,
+            tax_inclusive = $8, total_amount = $9, special_instructions = $10::jsonb, customer_id = NULLIF($12, 0), updated_at = NOW() 
+        WHERE id = $1 AND ($11 = 0 OR version = $11)
+        RETURNING id, name, COALESCE(customer_id, 0), status, order_type, subtotal, COALESCE(promo_code, ''), discount_amount,
+            tax_amount, tax_inclusive, total_amount, special_instructions, version, created_at, updated_at`
 
 	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		err = tx.QueryRow(queryUpdate, id, changeOrder.CustomerName, "updated", changeOrder.TotalAmount, specialInstructionsBytes).
-			Scan(&orderUpdated.ID, &orderUpdated.CustomerName, &orderUpdated.Status, &orderUpdated.TotalAmount, &specialInstructionsJSON, &orderUpdated.CreatedAt, &orderUpdated.UpdatedAt)
+		var status string
+		var current int
+		err := tx.QueryRow(`SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status, &current)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("order with ID %d %w", id, ErrNotFound)
+			}
+			return fmt.Errorf("error getting element: %v", err)
+		}
+		if version != 0 && current != version {
+			return fmt.Errorf("%w: order %d is at version %d", ErrVersionMismatch, id, current)
+		}
+		if status == models.OrderStatusClosed || status == models.OrderStatusCancelled || status == models.OrderStatusRefunded {
+			return fmt.Errorf("%w: order %d is %s", ErrOrderNotEditable, id, status)
+		}
+		if err := checkTotalCoversPaid(tx, id, changeOrder.TotalAmount); err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(queryUpdate, id, changeOrder.CustomerName, changeOrder.OrderType, changeOrder.Subtotal, changeOrder.PromoCode,
+			changeOrder.DiscountAmount, changeOrder.TaxAmount, changeOrder.TaxInclusive, changeOrder.TotalAmount, specialInstructionsBytes, version,
+			changeOrder.CustomerID).
+			Scan(&orderUpdated.ID, &orderUpdated.CustomerName, &orderUpdated.CustomerID, &orderUpdated.Status, &orderUpdated.OrderType, &orderUpdated.Subtotal,
+				&orderUpdated.PromoCode, &orderUpdated.DiscountAmount, &orderUpdated.TaxAmount, &orderUpdated.TaxInclusive,
+				&orderUpdated.TotalAmount, &specialInstructionsJSON, &orderUpdated.Version, &orderUpdated.CreatedAt, &orderUpdated.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return versionOrNotFound(tx, "orders", id, fmt.Errorf("order with ID %d %w", id, ErrNotFound))
+		}
 		if err != nil {
 			return fmt.Errorf("request execution error: %w", err)
 		}
@@ -270,211 +467,299 @@ func (r OrderRepository) UpdateOrder(id int, changeOrder models.Order) (models.O
 			return fmt.Errorf("JSON unmarshaling error: %w", err)
 		}
 
-		// Обновление позиций заказа
-		queryPrice := `SELECT price FROM menu_items WHERE id = $1`
-		queryUpdateItems := `UPDATE order_items SET quantity = $3, price = $4 WHERE order_id = $1 AND menu_item_id = $2`
-		for _, item := range changeOrder.Items {
-			err := tx.QueryRow(queryPrice, item.ProductID).Scan(&item.Price)
-			if err != nil {
-				return fmt.Errorf("error getting a price: %w", err)
-			}
+		// Обновление позиций заказа (цены уже посчитаны сервисом)
+		if err := syncOrderItems(tx, orderUpdated.ID, changeOrder.Items); err != nil {
+			return err
+		}
 
-			_, err = tx.Exec(queryUpdateItems, orderUpdated.ID, item.ProductID, item.Quantity, item.Price)
-			if err != nil {
-				return fmt.Errorf("order Item Update Error: %w", err)
-			}
+		if err := saveOrderDiscounts(tx, orderUpdated.ID, changeOrder.Discounts); err != nil {
+			return err
 		}
-		return nil
+		if err := saveOrderTaxes(tx, orderUpdated.ID, changeOrder.Taxes); err != nil {
+			return err
+		}
+
+		return reserveIngredients(tx, orderUpdated.ID)
 	})
 	if errTransact != nil {
 		return models.Order{}, errTransact
 	}
 
 	// Получение актуальных позиций заказа
-	queryItems := `SELECT menu_item_id, quantity, price FROM order_items WHERE order_id = $1`
-	rows, err := r.db.Query(queryItems, orderUpdated.ID)
+	items, err := loadOrderItems(r.db, orderUpdated.ID)
 	if err != nil {
-		return models.Order{}, fmt.Errorf("error receiving the list of items of the order: %w", err)
-	}
-	defer rows.Close()
-
-	var items []models.OrderItem
-	for rows.Next() {
-		var item models.OrderItem
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-			return models.Order{}, fmt.Errorf("error when scanning products: %w", err)
-		}
-		items = append(items, item)
+		return models.Order{}, err
 	}
 	orderUpdated.Items = items
+	orderUpdated.Discounts = changeOrder.Discounts
+	orderUpdated.Taxes = changeOrder.Taxes
 
 	return orderUpdated, nil
 }
 
-func (r OrderRepository) CloseOrder(id int) (models.Order, []struct {
-	IngredientID int     `json:"ingredient_id"`
-	Name         string  `json:"name"`
-	QuantityUsed float64 `json:"quantity_used"`
-	Remaining    float64 `json:"remaining"`
-}, error,
-) {
-	order, errLoad := r.LoadOrder(id)
-	if errLoad != nil {
-		return order, nil, errLoad
-	}
-	if order.Status == "closed" {
-		return models.Order{}, nil, fmt.Errorf("this order with %d is already closed", id)
-	}
+// UpdateOrderStatus переводит заказ из статуса from в статус to.
+// Допустимость перехода проверяет сервис, здесь только защита от гонки:
+// если статус успел поменяться, обновление не произойдёт.
+func (r OrderRepository) UpdateOrderStatus(id int, from, to string, change models.OrderStatusChange) (models.Order, error) {
+	queryUpdate := `UPDATE orders SET status = $3, updated_at = NOW() WHERE id = $1 AND status = $2`
 
-	// Шаг 1: Загружаем все позиции заказа
-	var orderItems []models.OrderItem
-	queryItems := `SELECT menu_item_id, quantity, price FROM order_items WHERE order_id = $1`
-	rows, errItem := r.db.Query(queryItems, id)
-	if errItem != nil {
-		return models.Order{}, nil, errItem
-	}
-	defer rows.Close()
-	var item models.OrderItem
-	for rows.Next() {
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-			return models.Order{}, nil, err
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		if err := setStatusChange(tx, change); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(queryUpdate, id, from, to)
+		if err != nil {
+			return fmt.Errorf("error while changing order status: %v", err)
 		}
-		orderItems = append(orderItems, item)
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get number of affected rows: %v", err)
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("%w: order with ID %d is no longer %s", ErrOrderStatusChanged, id, from)
+		}
+
+		switch to {
+		case models.OrderStatusCancelled:
+			return releaseReservations(tx, id)
+		case models.OrderStatusOpen:
+			// Заказ открыт повторно — ингредиенты нужно зарезервировать заново
+			return reserveIngredients(tx, id)
+		}
+		return nil
+	})
+	if errTransact != nil {
+		return models.Order{}, errTransact
 	}
 
-	if err := rows.Err(); err != nil {
-		return models.Order{}, nil, err
-	}
-
-	// Загружаем все ингридиенты которые есть в позициях заказа
-	var ingredients []models.MenuItemIngredient
-	for _, item := range orderItems {
-		queryIngredients := `SELECT ingredient_id, quantity FROM menu_item_ingredients WHERE menu_item_id = $1`
-		rows2, errIngredient := r.db.Query(queryIngredients, item.ProductID)
-		if errIngredient != nil {
-			return models.Order{}, nil, errIngredient
-		}
-		defer rows2.Close()
-		var ingredient models.MenuItemIngredient
-		for rows2.Next() {
-			if err := rows2.Scan(&ingredient.IngredientID, &ingredient.Quantity); err != nil {
-				return models.Order{}, nil, err
+	return r.LoadOrder(id)
+}
+
+// ReplaceOrderItems сохраняет новый состав заказа (order.Items) с пересчитанными суммами и налогами.
+// from и order.Version — статус и версия, в которых сервис прочитал заказ; если заказ
+// успел измениться, изменения отклоняются.
+func (r OrderRepository) ReplaceOrderItems(id int, from string, order models.Order) (models.Order, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var status string
+		var version int
+		err := tx.QueryRow(`SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status, &version)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("order with ID %d %w", id, ErrNotFound)
 			}
-			ingredient.Quantity *= item.Quantity // Умножаем на количество предметов в заказе
-			ingredients = append(ingredients, ingredient)
+			return fmt.Errorf("error getting element: %v", err)
+		}
+		if status != from {
+			return fmt.Errorf("%w: order %d is now %s", ErrOrderNotEditable, id, status)
+		}
+		if version != order.Version {
+			return fmt.Errorf("%w: order %d is at version %d", ErrVersionMismatch, id, version)
+		}
+		if err := checkTotalCoversPaid(tx, id, order.TotalAmount); err != nil {
+			return err
+		}
+
+		if err := syncOrderItems(tx, id, order.Items); err != nil {
+			return err
+		}
+
+		queryTotal := `UPDATE orders SET subtotal = $2, discount_amount = $3, tax_amount = $4, tax_inclusive = $5, total_amount = $6,
+			updated_at = NOW() WHERE id = $1`
+		if _, err := tx.Exec(queryTotal, id, order.Subtotal, order.DiscountAmount, order.TaxAmount, order.TaxInclusive, order.TotalAmount); err != nil {
+			return fmt.Errorf("failed to update order total: %w", err)
 		}
 
-		if err := rows2.Err(); err != nil {
-			return models.Order{}, nil, err
+		if err := saveOrderDiscounts(tx, id, order.Discounts); err != nil {
+			return err
 		}
+		if err := saveOrderTaxes(tx, id, order.Taxes); err != nil {
+			return err
+		}
+
+		return reserveIngredients(tx, id)
+	})
+	if errTransact != nil {
+		return models.Order{}, errTransact
+	}
+
+	return r.LoadOrder(id)
+}
+
+// setStatusChange передаёт автора и примечание в триггер log_order_status_change
+// (действует до конца текущей транзакции)
+func setStatusChange(tx *sql.Tx, change models.OrderStatusChange) error {
+	query := `SELECT set_config('frappuccino.status_notes', $1, true), set_config('frappuccino.status_actor', $2, true)`
+	if _, err := tx.Exec(query, change.Notes, change.Actor); err != nil {
+		return fmt.Errorf("failed to set status change context: %v", err)
 	}
+	return nil
+}
 
-	// Суммируем количество каждого ингредиента по ID
-	ingredientQuantities := make(map[int]float64)
-	for _, ing := range ingredients {
-		ingredientQuantities[ing.IngredientID] += ing.Quantity
+// setInventoryOrder передаёт триггеру log_inventory_change заказ следующих изменений склада (0 — без заказа)
+func setInventoryOrder(tx *sql.Tx, orderID int) error {
+	value := ""
+	if orderID != 0 {
+		value = strconv.Itoa(orderID)
 	}
+	if _, err := tx.Exec(`SELECT set_config('frappuccino.inventory_order_id', $1, true)`, value); err != nil {
+		return fmt.Errorf("failed to set inventory change context: %v", err)
+	}
+	return nil
+}
 
-	// Проверяем хватает ли в инвентаре ингридиентов для закрытия текущего заказа
-	// и собираем информацию о текущих количествах
-	queryCheck := `SELECT id, ingredient_name, quantity FROM inventory WHERE id = $1`
+// CloseOrder закрывает заказ и списывает ингредиенты. Проверка остатков, списание
+// и смена статуса идут в одной транзакции: строки inventory блокируются через
+// SELECT ... FOR UPDATE в порядке id, поэтому параллельные закрытия не могут
+// одновременно пройти проверку и уйти в минус.
+func (r OrderRepository) CloseOrder(id int, from string, change models.OrderStatusChange, requirePaid bool, pointsTTL time.Duration,
+) (models.Order, []models.InventoryUpdate, error) {
+	var inventoryUpdates []models.InventoryUpdate
 
-	type inventoryItem struct {
-		ID       int
-		Name     string
-		Quantity float64
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var err error
+		inventoryUpdates, err = closeOrder(tx, id, from, change, requirePaid, pointsTTL)
+		return err
+	})
+	if errTransact != nil {
+		return models.Order{}, nil, errTransact
 	}
 
-	inventoryItems := make(map[int]inventoryItem)
+	order, errLoad := r.LoadOrder(id)
+	if errLoad != nil {
+		return models.Order{}, nil, errLoad
+	}
 
-	for ingredientID, requiredQuantity := range ingredientQuantities {
-		var item inventoryItem
-		err := r.db.QueryRow(queryCheck, ingredientID).Scan(&item.ID, &item.Name, &item.Quantity)
+	return order, inventoryUpdates, nil
+}
+
+// closeOrder закрывает заказ внутри транзакции: списывает ингредиенты и баллы,
+// потраченные на скидку (ErrInsufficientPoints, если их уже не хватает), начисляет
+// клиенту баллы лояльности (со сроком pointsTTL) и возвращает расход с остатками
+// после списания. При requirePaid неоплаченный заказ не закрывается (ErrOrderNotPaid).
+func closeOrder(tx *sql.Tx, id int, from string, change models.OrderStatusChange, requirePaid bool, pointsTTL time.Duration,
+) ([]models.InventoryUpdate, error) {
+	// Создаем слайс для отслеживания обновлений инвентаря
+	var inventoryUpdates []models.InventoryUpdate
+
+	// Блокируем сам заказ: второе закрытие того же заказа дождётся первого
+	var status string
+	err := tx.QueryRow(`SELECT status FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("order with ID %d %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting element: %v", err)
+	}
+	if status != from {
+		return nil, fmt.Errorf("%w: order with ID %d is no longer %s", ErrOrderStatusChanged, id, from)
+	}
+
+	// Оплаты тоже блокируют заказ, поэтому остаток здесь не изменится до конца транзакции
+	if requirePaid {
+		balance, err := orderBalance(tx, id)
 		if err != nil {
-			return models.Order{}, nil, fmt.Errorf("failed to check inventory: %v", err)
+			return nil, err
 		}
-		if item.Quantity < requiredQuantity {
-			return models.Order{}, nil, fmt.Errorf("insufficient inventory for ingredient ID %d (available: %f, required: %f)",
-				ingredientID, item.Quantity, requiredQuantity)
+		if balance > 0 {
+			return nil, fmt.Errorf("%w: order %d has an outstanding balance of %.2f", ErrOrderNotPaid, id, balance)
 		}
-		inventoryItems[ingredientID] = item
 	}
 
-	// Создаем слайс для отслеживания обновлений инвентаря
-	var inventoryUpdates []struct {
-		IngredientID int     `json:"ingredient_id"`
-		Name         string  `json:"name"`
-		QuantityUsed float64 `json:"quantity_used"`
-		Remaining    float64 `json:"remaining"`
+	// Суммарная потребность в ингредиентах по всем позициям заказа
+	ingredientQuantities, err := orderRequirements(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Недостающие заготовки готовятся из их рецептов
+	if err := expandPrepared(tx, ingredientQuantities, id); err != nil {
+		return nil, err
 	}
+	ingredientIDs := sortedIngredientIDs(ingredientQuantities)
 
-	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
-		// Обновление инвентаря
-		querySubsctruct := `UPDATE inventory SET quantity = quantity - $1 WHERE id = $2 RETURNING quantity`
-		for ingredientID, requiredQuantity := range ingredientQuantities {
-			// Используем QueryRow вместо Exec, чтобы получить оставшееся количество
-			var reorderThreshold float64
-			var remaining float64
-			err := tx.QueryRow(querySubsctruct, requiredQuantity, ingredientID).Scan(&remaining)
-			if err != nil {
-				return fmt.Errorf("failed to update inventory: %v", err)
-			}
+	// Шаг 1: блокируем и проверяем все ингредиенты, резервы других заказов не трогаем
+	queryLock := `SELECT ingredient_name, quantity FROM inventory WHERE id = $1 FOR UPDATE`
+	queryReservedByOthers := `SELECT COALESCE(SUM(quantity), 0) FROM inventory_reservations
+		WHERE ingredient_id = $1 AND status = 'held' AND order_id <> $2`
 
-			// порог перезаказа:
-			reorderThresholdQuery := `SELECT quantity, reorder_threshold FROM inventory WHERE id = $1`
-			err = tx.QueryRow(reorderThresholdQuery, ingredientID).Scan(&remaining, &reorderThreshold)
-			if err != nil {
-				return fmt.Errorf("failed to check inventory: %v", err)
-			}
+	names := make(map[int]string, len(ingredientIDs))
+	for _, ingredientID := range ingredientIDs {
+		var onHand, reservedByOthers float64
+		var name string
+		if err := tx.QueryRow(queryLock, ingredientID).Scan(&name, &onHand); err != nil {
+			return nil, fmt.Errorf("failed to check inventory: %v", err)
+		}
+		if err := tx.QueryRow(queryReservedByOthers, ingredientID, id).Scan(&reservedByOthers); err != nil {
+			return nil, fmt.Errorf("failed to check reservations: %v", err)
+		}
 
-			if remaining <= reorderThreshold {
-				slog.Warn("⚠️ Warning!")
-				slog.Warn("⚠️ Ingredient %d is below reorder threshold (%f left)\n", ingredientID, remaining)
-				// Тут можно добавить логику создания заказа поставщику
+		available := onHand - reservedByOthers
+		if available < ingredientQuantities[ingredientID] {
+			return nil, &InsufficientStockError{
+				IngredientID: ingredientID, Name: name, Available: available, Required: ingredientQuantities[ingredientID],
 			}
-
-			// Добавляем информацию об обновлении в слайс
-			inventoryUpdates = append(inventoryUpdates, struct {
-				IngredientID int     `json:"ingredient_id"`
-				Name         string  `json:"name"`
-				QuantityUsed float64 `json:"quantity_used"`
-				Remaining    float64 `json:"remaining"`
-			}{
-				IngredientID: ingredientID,
-				Name:         inventoryItems[ingredientID].Name,
-				QuantityUsed: requiredQuantity,
-				Remaining:    remaining,
-			})
-		}
-
-		queryClosing := `UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1`
-		result, err := tx.Exec(queryClosing, id, "closed")
-		if err != nil {
-			return fmt.Errorf("error while closing order: %v", err)
 		}
+		names[ingredientID] = name
+	}
 
-		rowsAffected, err := result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("failed to get number of affected rows: %v", err)
+	// Шаг 2: списываем; триггер запишет списания с номером заказа
+	if err := setInventoryOrder(tx, id); err != nil {
+		return nil, err
+	}
+	querySubtract := `UPDATE inventory SET quantity = quantity - $1, updated_at = NOW() WHERE id = $2
+		RETURNING quantity, reorder_threshold`
+	for _, ingredientID := range ingredientIDs {
+		requiredQuantity := ingredientQuantities[ingredientID]
+
+		var remaining float64
+		var reorderThreshold sql.NullFloat64
+		if err := tx.QueryRow(querySubtract, requiredQuantity, ingredientID).Scan(&remaining, &reorderThreshold); err != nil {
+			return nil, fmt.Errorf("failed to update inventory: %v", err)
 		}
 
-		if rowsAffected == 0 {
-			return fmt.Errorf("order with ID %d not found", id)
+		// порог перезаказа:
+		if reorderThreshold.Valid && remaining <= reorderThreshold.Float64 {
+			slog.Warn("⚠️ Ingredient is below reorder threshold", "ingredientID", ingredientID, "remaining", remaining)
+			// Тут можно добавить логику создания заказа поставщику
 		}
 
-		return nil
-	})
+		// Добавляем информацию об обновлении в слайс
+		inventoryUpdates = append(inventoryUpdates, models.InventoryUpdate{
+			IngredientID: ingredientID,
+			Name:         names[ingredientID],
+			QuantityUsed: requiredQuantity,
+			Remaining:    remaining,
+		})
+	}
 
-	if errTransact != nil {
-		return models.Order{}, nil, errTransact
+	if err := setInventoryOrder(tx, 0); err != nil {
+		return nil, err
 	}
 
-	order, errLoad = r.LoadOrder(id)
-	if errLoad != nil {
-		return models.Order{}, nil, errLoad
+	// Резерв превратился в фактическое списание
+	if err := consumeReservations(tx, id); err != nil {
+		return nil, err
 	}
 
-	return order, inventoryUpdates, nil
+	if err := setStatusChange(tx, change); err != nil {
+		return nil, err
+	}
+
+	queryClosing := `UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(queryClosing, id, models.OrderStatusClosed); err != nil {
+		return nil, fmt.Errorf("error while closing order: %v", err)
+	}
+
+	if err := redeemDiscountPoints(tx, id); err != nil {
+		return nil, err
+	}
+	if err := earnPoints(tx, id, pointsTTL); err != nil {
+		return nil, err
+	}
+
+	return inventoryUpdates, nil
 }
 
 func (r OrderRepository) GetOrderedItemsCount(start, end time.Time) (map[string]int, error) {
@@ -509,3 +794,35 @@ func (r OrderRepository) GetOrderedItemsCount(start, end time.Time) (map[string]
 
 	return orderedItems, nil
 }
+
+// LoadStatusHistory возвращает все переходы статусов заказа в хронологическом порядке
+func (r OrderRepository) LoadStatusHistory(orderID int) ([]models.OrderStatusHistoryEntry, error) {
+	query := `SELECT id, status, notes, changed_by, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order status history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusHistoryEntry
+	for rows.Next() {
+		var entry models.OrderStatusHistoryEntry
+		var notes, changedBy sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Status, &notes, &changedBy, &entry.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.Notes = notes.String
+		entry.ChangedBy = changedBy.String
+		history = append(history, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return history, nil
+}
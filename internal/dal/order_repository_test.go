@@ -0,0 +1,217 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"frappuccino/models"
+)
+
+// testDB подключается к тестовой базе FRAPPUCCINO_TEST_DSN со схемой из init.sql.
+// Без переменной тесты с базой пропускаются.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("FRAPPUCCINO_TEST_DSN")
+	if dsn == "" {
+		t.Skip("FRAPPUCCINO_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// addTestProduct создаёт ингредиент с остатком stock и позицию меню, на порцию которой
+// уходит одна его единица. После теста удаляет их вместе с заказами этой позиции.
+func addTestProduct(t *testing.T, db *sql.DB, stock float64) (productID, ingredientID int) {
+	t.Helper()
+	suffix := time.Now().UnixNano()
+
+	if err := db.QueryRow(`INSERT INTO inventory (ingredient_name, quantity, unit) VALUES ($1, $2, 'pcs') RETURNING id`,
+		fmt.Sprintf("test ingredient %d", suffix), stock).Scan(&ingredientID); err != nil {
+		t.Fatalf("add ingredient: %v", err)
+	}
+	if err := db.QueryRow(`INSERT INTO menu_items (name, price) VALUES ($1, 1) RETURNING id`,
+		fmt.Sprintf("test product %d", suffix)).Scan(&productID); err != nil {
+		t.Fatalf("add menu item: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO menu_item_ingredients (menu_item_id, ingredient_id, quantity) VALUES ($1, $2, 1)`,
+		productID, ingredientID); err != nil {
+		t.Fatalf("add recipe: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE id IN (SELECT order_id FROM order_items WHERE menu_item_id = $1)`, productID)
+		db.Exec(`DELETE FROM menu_items WHERE id = $1`, productID)
+		db.Exec(`DELETE FROM inventory WHERE id = $1`, ingredientID)
+	})
+	return productID, ingredientID
+}
+
+func stockOf(t *testing.T, db *sql.DB, ingredientID int) float64 {
+	t.Helper()
+	var quantity float64
+	if err := db.QueryRow(`SELECT quantity FROM inventory WHERE id = $1`, ingredientID).Scan(&quantity); err != nil {
+		t.Fatalf("load stock: %v", err)
+	}
+	return quantity
+}
+
+// Параллельные закрытия борются за последнюю единицу ингредиента: проходит ровно одно,
+// склад не уходит в минус
+func TestCloseOrderConcurrentLastUnit(t *testing.T) {
+	const closes = 20
+	db := testDB(t)
+	productID, ingredientID := addTestProduct(t, db, 1)
+
+	// заказы создаются без резервов, чтобы все дошли до списания
+	orderIDs := make([]int, closes)
+	for i := range orderIDs {
+		if err := db.QueryRow(`INSERT INTO orders (name, total_amount) VALUES ('test', 1) RETURNING id`).Scan(&orderIDs[i]); err != nil {
+			t.Fatalf("add order: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO order_items (order_id, menu_item_id, quantity, price) VALUES ($1, $2, 1, 1)`,
+			orderIDs[i], productID); err != nil {
+			t.Fatalf("add order item: %v", err)
+		}
+	}
+
+	repo := NewOrderRepository(db)
+	start := make(chan struct{})
+	errs := make([]error, closes)
+	var wg sync.WaitGroup
+	for i, id := range orderIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, _, errs[i] = repo.CloseOrder(id, models.OrderStatusOpen, models.OrderStatusChange{}, false, 0)
+		}()
+	}
+
+	// пока закрытия идут, следим, что остаток не уходит в минус
+	finished := make(chan struct{})
+	polled := make(chan float64)
+	go func() {
+		minStock := 1.0
+		for {
+			select {
+			case <-finished:
+				polled <- minStock
+				return
+			default:
+			}
+			var stock float64
+			if err := db.QueryRow(`SELECT quantity FROM inventory WHERE id = $1`, ingredientID).Scan(&stock); err == nil {
+				minStock = min(minStock, stock)
+			}
+		}
+	}()
+	close(start)
+	wg.Wait()
+	close(finished)
+	minStock := <-polled
+
+	closed := 0
+	for _, err := range errs {
+		var stockErr *InsufficientStockError
+		switch {
+		case err == nil:
+			closed++
+		case !errors.As(err, &stockErr):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("closed orders = %d, want 1", closed)
+	}
+	if minStock < 0 {
+		t.Errorf("stock went negative: %v", minStock)
+	}
+	if stock := stockOf(t, db, ingredientID); stock != 0 {
+		t.Errorf("stock = %v, want 0", stock)
+	}
+}
+
+// Пакет из трёх заказов при остатке 2: второму (2 порции) после первого не хватает.
+// С requirePaid принимаются только заказы с оплатой в самом пакете.
+func TestProcessBatchModes(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		requirePaid   bool
+		unpaid        []bool // заказ приходит без оплаты
+		wantOutcomes  []bool // принят ли заказ
+		wantCommitted bool
+		wantStock     float64
+	}{
+		{name: "best_effort", mode: models.BatchModeBestEffort, wantOutcomes: []bool{true, false, true}, wantCommitted: true, wantStock: 0},
+		{name: "all_or_nothing", mode: models.BatchModeAllOrNothing, wantOutcomes: []bool{true, false}, wantCommitted: false, wantStock: 2},
+		{name: "dry_run", mode: models.BatchModeDryRun, wantOutcomes: []bool{true, false, true}, wantCommitted: false, wantStock: 2},
+		{
+			name: "best_effort paid", mode: models.BatchModeBestEffort, requirePaid: true,
+			wantOutcomes: []bool{true, false, true}, wantCommitted: true, wantStock: 0,
+		},
+		{
+			name: "best_effort unpaid", mode: models.BatchModeBestEffort, requirePaid: true, unpaid: []bool{false, false, true},
+			wantOutcomes: []bool{true, false, false}, wantCommitted: true, wantStock: 1,
+		},
+		{
+			name: "all_or_nothing paid", mode: models.BatchModeAllOrNothing, requirePaid: true,
+			wantOutcomes: []bool{true, false}, wantCommitted: false, wantStock: 2,
+		},
+	}
+
+	db := testDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			productID, ingredientID := addTestProduct(t, db, 2)
+			var orders []models.Order
+			for i, quantity := range []float64{1, 2, 1} {
+				order := models.Order{
+					CustomerName: "test",
+					OrderType:    models.OrderTypeTakeaway,
+					Items:        []models.OrderItem{{ProductID: productID, Quantity: quantity, Price: 1}},
+					TotalAmount:  quantity,
+				}
+				if i >= len(tt.unpaid) || !tt.unpaid[i] {
+					order.Payments = []models.Payment{{Method: models.PaymentMethodCard, Amount: quantity}}
+				}
+				orders = append(orders, order)
+			}
+
+			outcomes, committed, err := NewOrderRepository(db).ProcessBatch(orders, tt.mode, models.OrderStatusChange{}, tt.requirePaid, 0)
+			if err != nil {
+				t.Fatalf("ProcessBatch: %v", err)
+			}
+			if committed != tt.wantCommitted {
+				t.Errorf("committed = %v, want %v", committed, tt.wantCommitted)
+			}
+			if len(outcomes) != len(tt.wantOutcomes) {
+				t.Fatalf("outcomes = %d, want %d", len(outcomes), len(tt.wantOutcomes))
+			}
+			for i, outcome := range outcomes {
+				if accepted := outcome.Err == nil; accepted != tt.wantOutcomes[i] {
+					t.Errorf("order %d accepted = %v, want %v (err: %v)", i, accepted, tt.wantOutcomes[i], outcome.Err)
+				}
+			}
+			if tt.requirePaid && len(tt.unpaid) > 2 && tt.unpaid[2] && !errors.Is(outcomes[2].Err, ErrOrderNotPaid) {
+				t.Errorf("unpaid order error = %v, want ErrOrderNotPaid", outcomes[2].Err)
+			}
+			if stock := stockOf(t, db, ingredientID); stock != tt.wantStock {
+				t.Errorf("stock = %v, want %v", stock, tt.wantStock)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PaymentRepositoryInterface interface {
+	AddPayment(orderID int, payment models.Payment) (models.Payment, error)
+	LoadPayments(orderID int) (models.OrderPayments, error)
+	RefundOrder(orderID int, request models.RefundRequest, pointsTTL time.Duration) (models.Refund, error)
+}
+
+type PaymentRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentRepository(db *sql.DB) PaymentRepository {
+	return PaymentRepository{db: db}
+}
+
+// paidAmountSQL — сумма, зачтённая в оплату заказа $1
+const paidAmountSQL = `COALESCE((SELECT SUM(amount) FROM payments WHERE order_id = $1), 0)`
+
+// AddPayment принимает оплату (частичную или полную). Заказ блокируется, поэтому
+// параллельные оплаты одного заказа считают остаток по очереди.
+func (r PaymentRepository) AddPayment(orderID int, payment models.Payment) (models.Payment, error) {
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		var err error
+		payment, err = insertPayment(tx, orderID, payment)
+		return err
+	})
+	if errTransact != nil {
+		return models.Payment{}, errTransact
+	}
+
+	return payment, nil
+}
+
+// insertPayment записывает оплату заказа внутри транзакции. Наличные сверх
+// остатка превращаются в сдачу, остальные способы не могут превышать остаток.
+// Оплата баллами (payment.Points уже посчитаны) списывает их с клиента заказа.
+// Подарочная карта (код в reference) платит не больше своего остатка, остаток карты
+// и оплата заказа фиксируются одной транзакцией.
+func insertPayment(tx *sql.Tx, orderID int, payment models.Payment) (models.Payment, error) {
+	var status string
+	var total float64
+	var customerID sql.NullInt64
+	err := tx.QueryRow(`SELECT status, total_amount, customer_id FROM orders WHERE id = $1 FOR UPDATE`, orderID).
+		Scan(&status, &total, &customerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Payment{}, fmt.Errorf("order with ID %d not found", orderID)
+		}
+		return models.Payment{}, fmt.Errorf("error getting element: %v", err)
+	}
+	if status == models.OrderStatusCancelled || status == models.OrderStatusRefunded {
+		return models.Payment{}, fmt.Errorf("%w: order %d is %s", ErrOrderNotPayable, orderID, status)
+	}
+	if payment.Method == models.PaymentMethodLoyalty && !customerID.Valid {
+		return models.Payment{}, fmt.Errorf("%w: order %d has no customer to pay with points", utils.ErrValidation, orderID)
+	}
+
+	var paid float64
+	if err := tx.QueryRow(`SELECT `+paidAmountSQL, orderID).Scan(&paid); err != nil {
+		return models.Payment{}, fmt.Errorf("failed to get paid amount: %v", err)
+	}
+	balance := utils.RoundMoney(total - paid)
+	if balance <= 0 {
+		return models.Payment{}, fmt.Errorf("%w: order %d is already paid", ErrOrderNotPayable, orderID)
+	}
+
+	var giftCardID int
+	if payment.Method == models.PaymentMethodGiftCard {
+		var available float64
+		giftCardID, available, err = lockGiftCard(tx, payment.Reference)
+		if err != nil {
+			return models.Payment{}, err
+		}
+		if available <= 0 {
+			return models.Payment{}, fmt.Errorf("%w: gift card %s has no balance left", ErrGiftCardNotUsable, payment.Reference)
+		}
+		// Частичное списание: остаток заказа доплачивается другим способом
+		payment.Amount = math.Min(payment.Amount, available)
+	}
+
+	if payment.Method == models.PaymentMethodCash {
+		if payment.Tendered == 0 {
+			payment.Tendered = payment.Amount
+		}
+		payment.Amount = math.Min(payment.Tendered, balance)
+		payment.Change = utils.RoundMoney(payment.Tendered - payment.Amount)
+	} else if payment.Amount > balance {
+		return models.Payment{}, fmt.Errorf("%w: payment %.2f exceeds the balance %.2f", utils.ErrValidation, payment.Amount, balance)
+	}
+
+	query := `INSERT INTO payments (order_id, method, amount, tendered, change_due, reference, points)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, NULLIF($6, ''), NULLIF($7, 0))
+		RETURNING id, order_id, created_at`
+	err = tx.QueryRow(query, orderID, payment.Method, payment.Amount, payment.Tendered, payment.Change, payment.Reference,
+		payment.Points).Scan(&payment.ID, &payment.OrderID, &payment.CreatedAt)
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("failed to insert payment: %v", err)
+	}
+
+	switch payment.Method {
+	case models.PaymentMethodLoyalty:
+		err = redeemPoints(tx, int(customerID.Int64), payment)
+	case models.PaymentMethodGiftCard:
+		err = changeGiftCardBalance(tx, giftCardID, models.GiftCardEntry{
+			Type: models.GiftCardEntryRedeem, Amount: -payment.Amount, OrderID: orderID, PaymentID: payment.ID,
+			Notes: fmt.Sprintf("Payment for order %d", orderID),
+		})
+	}
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return payment, nil
+}
+
+func (r PaymentRepository) LoadPayments(orderID int) (models.OrderPayments, error) {
+	result := models.OrderPayments{OrderID: orderID, Payments: []models.Payment{}}
+
+	err := r.db.QueryRow(`SELECT total_amount, `+refundedAmountSQL+` FROM orders WHERE id = $1`, orderID).
+		Scan(&result.TotalAmount, &result.Refunded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OrderPayments{}, fmt.Errorf("order with ID %d not found", orderID)
+		}
+		return models.OrderPayments{}, fmt.Errorf("error getting element: %v", err)
+	}
+
+	query := `SELECT id, order_id, method, amount, COALESCE(tendered, 0), change_due, COALESCE(reference, ''),
+			COALESCE(points, 0), created_at
+		FROM payments WHERE order_id = $1 ORDER BY created_at, id`
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return models.OrderPayments{}, fmt.Errorf("failed to load payments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payment models.Payment
+		if err := rows.Scan(&payment.ID, &payment.OrderID, &payment.Method, &payment.Amount, &payment.Tendered,
+			&payment.Change, &payment.Reference, &payment.Points, &payment.CreatedAt); err != nil {
+			return models.OrderPayments{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result.Paid += payment.Amount
+		result.Payments = append(result.Payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return models.OrderPayments{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	result.Paid = utils.RoundMoney(result.Paid)
+	result.Balance = utils.RoundMoney(result.TotalAmount - result.Paid)
+	result.FullyPaid = result.Balance <= 0
+	return result, nil
+}
+
+// orderBalance возвращает неоплаченный остаток заказа
+func orderBalance(q querier, orderID int) (float64, error) {
+	var balance float64
+	err := q.QueryRow(`SELECT total_amount - `+paidAmountSQL+` FROM orders WHERE id = $1`, orderID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get order balance: %v", err)
+	}
+	return utils.RoundMoney(balance), nil
+}
+
+// checkTotalCoversPaid отклоняет правку заказа, после которой его итог меньше уже оплаченного
+func checkTotalCoversPaid(tx *sql.Tx, orderID int, total float64) error {
+	var paid float64
+	if err := tx.QueryRow(`SELECT `+paidAmountSQL, orderID).Scan(&paid); err != nil {
+		return fmt.Errorf("failed to get paid amount: %v", err)
+	}
+	if utils.RoundMoney(total) < utils.RoundMoney(paid) {
+		return fmt.Errorf("%w: order %d total %.2f would be below the %.2f already paid", ErrOrderNotEditable, orderID, total, paid)
+	}
+	return nil
+}
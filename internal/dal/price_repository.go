@@ -0,0 +1,205 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+)
+
+type PriceRepositoryInterface interface {
+	SchedulePriceChange(change models.ScheduledPriceChange) (models.ScheduledPriceChange, error)
+	LoadPriceHistory(menuItemID int) (models.PriceHistory, error)
+	ApplyDuePriceChanges() ([]models.ScheduledPriceChange, error)
+	NextPriceChangeAt() (time.Time, bool, error)
+	GetPriceAt(menuItemID, variantID int, at time.Time) (models.PriceAtTime, error)
+}
+
+type PriceRepository struct {
+	db *sql.DB
+}
+
+func NewPriceRepository(db *sql.DB) PriceRepository {
+	return PriceRepository{db: db}
+}
+
+func (r PriceRepository) SchedulePriceChange(change models.ScheduledPriceChange) (models.ScheduledPriceChange, error) {
+	if err := r.checkMenuItem(change.ProductID); err != nil {
+		return models.ScheduledPriceChange{}, err
+	}
+
+	query := `INSERT INTO scheduled_price_changes (menu_item_id, price, effective_at, reason)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := r.db.QueryRow(query, change.ProductID, change.Price, change.EffectiveAt, change.Reason).
+		Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return models.ScheduledPriceChange{}, fmt.Errorf("failed to schedule price change: %w", err)
+	}
+	return change, nil
+}
+
+// LoadPriceHistory возвращает историю цен позиции (базовой цены и вариантов)
+// и ещё не применённые изменения в порядке их вступления в силу
+func (r PriceRepository) LoadPriceHistory(menuItemID int) (models.PriceHistory, error) {
+	if err := r.checkMenuItem(menuItemID); err != nil {
+		return models.PriceHistory{}, err
+	}
+	history := models.PriceHistory{
+		ProductID: menuItemID,
+		History:   []models.PriceHistoryEntry{},
+		Pending:   []models.ScheduledPriceChange{},
+	}
+
+	queryHistory := `SELECT COALESCE(variant_id, 0), price, effective_from, effective_to, COALESCE(change_reason, '')
+		FROM price_history WHERE menu_item_id = $1 ORDER BY effective_from, id`
+	rows, err := r.db.Query(queryHistory, menuItemID)
+	if err != nil {
+		return models.PriceHistory{}, fmt.Errorf("failed to load price history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.PriceHistoryEntry
+		var effectiveTo sql.NullTime
+		if err := rows.Scan(&entry.VariantID, &entry.Price, &entry.EffectiveFrom, &effectiveTo, &entry.Reason); err != nil {
+			return models.PriceHistory{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if effectiveTo.Valid {
+			entry.EffectiveTo = &effectiveTo.Time
+		}
+		history.History = append(history.History, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return models.PriceHistory{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	queryPending := `SELECT id, menu_item_id, price, effective_at, reason, created_at FROM scheduled_price_changes
+		WHERE menu_item_id = $1 AND applied_at IS NULL ORDER BY effective_at, id`
+	pendingRows, err := r.db.Query(queryPending, menuItemID)
+	if err != nil {
+		return models.PriceHistory{}, fmt.Errorf("failed to load scheduled price changes: %w", err)
+	}
+	defer pendingRows.Close()
+
+	for pendingRows.Next() {
+		var change models.ScheduledPriceChange
+		if err := pendingRows.Scan(&change.ID, &change.ProductID, &change.Price, &change.EffectiveAt, &change.Reason,
+			&change.CreatedAt); err != nil {
+			return models.PriceHistory{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		history.Pending = append(history.Pending, change)
+	}
+	if err := pendingRows.Err(); err != nil {
+		return models.PriceHistory{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return history, nil
+}
+
+// ApplyDuePriceChanges применяет наступившие изменения цены в одной транзакции.
+// Триггер log_price_change записывает их в price_history с причиной из изменения.
+// SKIP LOCKED не даёт нескольким экземплярам сервера применить изменение дважды.
+func (r PriceRepository) ApplyDuePriceChanges() ([]models.ScheduledPriceChange, error) {
+	var applied []models.ScheduledPriceChange
+	err := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		queryDue := `SELECT id, menu_item_id, price, effective_at, reason, created_at FROM scheduled_price_changes
+			WHERE applied_at IS NULL AND effective_at <= NOW() ORDER BY effective_at, id FOR UPDATE SKIP LOCKED`
+		rows, err := tx.Query(queryDue)
+		if err != nil {
+			return fmt.Errorf("failed to load due price changes: %w", err)
+		}
+		var due []models.ScheduledPriceChange
+		for rows.Next() {
+			var change models.ScheduledPriceChange
+			if err := rows.Scan(&change.ID, &change.ProductID, &change.Price, &change.EffectiveAt, &change.Reason,
+				&change.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			due = append(due, change)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rows: %w", err)
+		}
+
+		queryContext := `SELECT set_config('frappuccino.price_change_reason', $1, true)`
+		queryPrice := `UPDATE menu_items SET price = $1, updated_at = NOW() WHERE id = $2`
+		queryApplied := `UPDATE scheduled_price_changes SET applied_at = NOW() WHERE id = $1 RETURNING applied_at`
+		for _, change := range due {
+			if _, err := tx.Exec(queryContext, change.Reason); err != nil {
+				return fmt.Errorf("failed to set price change context: %w", err)
+			}
+			if _, err := tx.Exec(queryPrice, change.Price, change.ProductID); err != nil {
+				return fmt.Errorf("failed to update menu item price: %w", err)
+			}
+			var appliedAt time.Time
+			if err := tx.QueryRow(queryApplied, change.ID).Scan(&appliedAt); err != nil {
+				return fmt.Errorf("failed to mark price change as applied: %w", err)
+			}
+			change.AppliedAt = &appliedAt
+			applied = append(applied, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// NextPriceChangeAt возвращает время ближайшего неприменённого изменения цены
+func (r PriceRepository) NextPriceChangeAt() (time.Time, bool, error) {
+	var next sql.NullTime
+	err := r.db.QueryRow(`SELECT MIN(effective_at) FROM scheduled_price_changes WHERE applied_at IS NULL`).Scan(&next)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get next price change: %w", err)
+	}
+	return next.Time, next.Valid, nil
+}
+
+// priceAtSQL — выражение с ценой позиции menuItemID (или её варианта variantID, NULL —
+// базовая цена) в момент at по price_history. Если истории базовой цены нет совсем,
+// берётся текущая цена, при условии что позиция уже существовала в момент at.
+// NULL — цена на тот момент неизвестна.
+func priceAtSQL(menuItemID, variantID, at string) string {
+	return `COALESCE(
+		(SELECT ph.price FROM price_history ph
+			WHERE ph.menu_item_id = ` + menuItemID + ` AND ph.variant_id IS NOT DISTINCT FROM ` + variantID + `
+				AND ph.effective_from <= ` + at + ` AND (ph.effective_to IS NULL OR ph.effective_to > ` + at + `)
+			ORDER BY ph.effective_from DESC, ph.id DESC LIMIT 1),
+		(SELECT mi.price FROM menu_items mi
+			WHERE mi.id = ` + menuItemID + ` AND ` + variantID + ` IS NULL AND mi.created_at <= ` + at + `
+				AND NOT EXISTS (SELECT 1 FROM price_history ph WHERE ph.menu_item_id = mi.id AND ph.variant_id IS NULL)))`
+}
+
+// GetPriceAt возвращает цену позиции (variantID = 0 — базовую) в момент at
+func (r PriceRepository) GetPriceAt(menuItemID, variantID int, at time.Time) (models.PriceAtTime, error) {
+	if err := r.checkMenuItem(menuItemID); err != nil {
+		return models.PriceAtTime{}, err
+	}
+
+	query := `SELECT ` + priceAtSQL("$1", "NULLIF($2::int, 0)", "$3::timestamptz")
+	var price sql.NullFloat64
+	if err := r.db.QueryRow(query, menuItemID, variantID, at).Scan(&price); err != nil {
+		return models.PriceAtTime{}, fmt.Errorf("failed to get price: %w", err)
+	}
+	if !price.Valid {
+		return models.PriceAtTime{}, fmt.Errorf("%w: no price for menu item %d at %s", ErrNotFound, menuItemID, at.Format(time.RFC3339))
+	}
+	return models.PriceAtTime{ProductID: menuItemID, VariantID: variantID, At: at, Price: price.Float64}, nil
+}
+
+func (r PriceRepository) checkMenuItem(menuItemID int) error {
+	var id int
+	err := r.db.QueryRow(`SELECT id FROM menu_items WHERE id = $1`, menuItemID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: menu item %d", ErrNotFound, menuItemID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get menu item: %w", err)
+	}
+	return nil
+}
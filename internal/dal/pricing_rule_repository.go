@@ -0,0 +1,96 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"frappuccino/models"
+	"frappuccino/utils"
+
+	"github.com/lib/pq"
+)
+
+type PricingRuleRepositoryInterface interface {
+	LoadPricingRules() ([]models.PricingRule, error)
+	AddPricingRule(rule models.PricingRule) (models.PricingRule, error)
+	DeletePricingRule(id int) error
+}
+
+type PricingRuleRepository struct {
+	db *sql.DB
+}
+
+func NewPricingRuleRepository(db *sql.DB) PricingRuleRepository {
+	return PricingRuleRepository{db: db}
+}
+
+func (r PricingRuleRepository) LoadPricingRules() ([]models.PricingRule, error) {
+	query := `SELECT id, name, COALESCE(menu_item_id, 0), COALESCE(category, ''), days_of_week,
+			to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'),
+			COALESCE(percent_off, 0), COALESCE(fixed_price, 0), created_at
+		FROM pricing_rules ORDER BY id`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pricing rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.PricingRule{}
+	for rows.Next() {
+		var rule models.PricingRule
+		var days pq.Int64Array
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.MenuItemID, &rule.Category, &days, &rule.StartTime, &rule.EndTime,
+			&rule.PercentOff, &rule.FixedPrice, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rule.DaysOfWeek = make([]int, len(days))
+		for i, day := range days {
+			rule.DaysOfWeek[i] = int(day)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return rules, nil
+}
+
+func (r PricingRuleRepository) AddPricingRule(rule models.PricingRule) (models.PricingRule, error) {
+	days := make(pq.Int64Array, len(rule.DaysOfWeek))
+	for i, day := range rule.DaysOfWeek {
+		days[i] = int64(day)
+	}
+
+	query := `INSERT INTO pricing_rules (name, menu_item_id, category, days_of_week, start_time, end_time, percent_off, fixed_price)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5::time, $6::time, NULLIF($7, 0), NULLIF($8, 0))
+		RETURNING id, created_at`
+	err := r.db.QueryRow(query, rule.Name, rule.MenuItemID, rule.Category, days, rule.StartTime, rule.EndTime,
+		rule.PercentOff, rule.FixedPrice).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.PricingRule{}, fmt.Errorf("%w: product %d not found", utils.ErrValidation, rule.MenuItemID)
+		}
+		return models.PricingRule{}, fmt.Errorf("failed to insert pricing rule: %w", err)
+	}
+	if rule.DaysOfWeek == nil {
+		rule.DaysOfWeek = []int{}
+	}
+	return rule, nil
+}
+
+// DeletePricingRule удаляет правило; позиции уже оформленных заказов сохраняют его название
+func (r PricingRuleRepository) DeletePricingRule(id int) error {
+	result, err := r.db.Exec(`DELETE FROM pricing_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete pricing rule: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("pricing rule with ID %d not found", id)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PromotionRepositoryInterface interface {
+	LoadPromotions() ([]models.Promotion, error)
+	LoadAutomaticPromotions() ([]models.Promotion, error)
+	GetPromotionByCode(code string) (models.Promotion, error)
+	AddPromotion(promotion models.Promotion) (models.Promotion, error)
+	DeletePromotion(id int) error
+}
+
+type PromotionRepository struct {
+	db *sql.DB
+}
+
+func NewPromotionRepository(db *sql.DB) PromotionRepository {
+	return PromotionRepository{db: db}
+}
+
+// timesUsedSQL — число заказов (кроме отменённых), получивших скидку по акции p
+const timesUsedSQL = `(SELECT COUNT(DISTINCT d.order_id) FROM order_discounts d
+	JOIN orders o ON o.id = d.order_id WHERE d.promotion_id = p.id AND o.status <> 'cancelled')`
+
+const selectPromotionSQL = `SELECT p.id, p.name, p.type, p.value, COALESCE(p.menu_item_id, 0), COALESCE(p.category, ''),
+	COALESCE(p.buy_quantity, 0), COALESCE(p.get_quantity, 0), COALESCE(p.code, ''), COALESCE(p.usage_limit, 0),
+	` + timesUsedSQL + `, p.valid_from, p.valid_to, p.created_at, p.deleted_at
+	FROM promotions p`
+
+func (r PromotionRepository) LoadPromotions() ([]models.Promotion, error) {
+	return r.queryPromotions(selectPromotionSQL + ` WHERE p.deleted_at IS NULL ORDER BY p.id`)
+}
+
+// LoadAutomaticPromotions возвращает акции без кода; срок действия проверяет сервис
+func (r PromotionRepository) LoadAutomaticPromotions() ([]models.Promotion, error) {
+	return r.queryPromotions(selectPromotionSQL + ` WHERE p.code IS NULL AND p.deleted_at IS NULL ORDER BY p.id`)
+}
+
+// GetPromotionByCode возвращает купон, в том числе удалённый (DeletedAt): его
+// продолжают применять заказы, которые приняли купон до удаления
+func (r PromotionRepository) GetPromotionByCode(code string) (models.Promotion, error) {
+	promotions, err := r.queryPromotions(selectPromotionSQL+` WHERE UPPER(p.code) = UPPER($1)`, code)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+	if len(promotions) == 0 {
+		return models.Promotion{}, fmt.Errorf("%w: promo code %q", ErrNotFound, code)
+	}
+	return promotions[0], nil
+}
+
+func (r PromotionRepository) queryPromotions(query string, args ...any) ([]models.Promotion, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load promotions: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		var promotion models.Promotion
+		var validFrom, validTo, deletedAt sql.NullTime
+		if err := rows.Scan(&promotion.ID, &promotion.Name, &promotion.Type, &promotion.Value, &promotion.MenuItemID,
+			&promotion.Category, &promotion.BuyQuantity, &promotion.GetQuantity, &promotion.Code, &promotion.UsageLimit,
+			&promotion.TimesUsed, &validFrom, &validTo, &promotion.CreatedAt, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if validFrom.Valid {
+			promotion.ValidFrom = &validFrom.Time
+		}
+		if validTo.Valid {
+			promotion.ValidTo = &validTo.Time
+		}
+		if deletedAt.Valid {
+			promotion.DeletedAt = &deletedAt.Time
+		}
+		promotions = append(promotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return promotions, nil
+}
+
+func (r PromotionRepository) AddPromotion(promotion models.Promotion) (models.Promotion, error) {
+	query := `INSERT INTO promotions (name, type, value, menu_item_id, category, buy_quantity, get_quantity, code,
+			usage_limit, valid_from, valid_to)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, 0), $10, $11)
+		RETURNING id, created_at`
+	err := r.db.QueryRow(query, promotion.Name, promotion.Type, promotion.Value, promotion.MenuItemID, promotion.Category,
+		promotion.BuyQuantity, promotion.GetQuantity, promotion.Code, promotion.UsageLimit, promotion.ValidFrom, promotion.ValidTo).
+		Scan(&promotion.ID, &promotion.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "duplicate key value"):
+			return models.Promotion{}, fmt.Errorf("%w: promo code %q already exists", utils.ErrValidation, promotion.Code)
+		case strings.Contains(err.Error(), "foreign key"):
+			return models.Promotion{}, fmt.Errorf("%w: product %d not found", utils.ErrValidation, promotion.MenuItemID)
+		}
+		return models.Promotion{}, fmt.Errorf("failed to insert promotion: %w", err)
+	}
+	return promotion, nil
+}
+
+// DeletePromotion помечает акцию удалённой: новые заказы её не получают, а скидки
+// в уже оформленных заказах и принятые ими купоны остаются
+func (r PromotionRepository) DeletePromotion(id int) error {
+	result, err := r.db.Exec(`UPDATE promotions SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete promotion: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("promotion with ID %d not found", id)
+	}
+	return nil
+}
+
+// loadOrderDiscounts загружает скидки заказа
+func loadOrderDiscounts(q querier, orderID int) ([]models.OrderDiscount, error) {
+	query := `SELECT COALESCE(promotion_id, 0), name, COALESCE(code, ''), amount, COALESCE(points, 0) FROM order_discounts
+		WHERE order_id = $1 ORDER BY id`
+	rows, err := q.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting order discounts: %w", err)
+	}
+	defer rows.Close()
+
+	discounts := []models.OrderDiscount{}
+	for rows.Next() {
+		var discount models.OrderDiscount
+		if err := rows.Scan(&discount.PromotionID, &discount.Name, &discount.Code, &discount.Amount, &discount.Points); err != nil {
+			return nil, fmt.Errorf("error scanning discounts: %w", err)
+		}
+		discounts = append(discounts, discount)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating discounts: %w", err)
+	}
+	return discounts, nil
+}
+
+// redeemedPoints — баллы, которые заказ тратит на скидку (nil — без скидки баллами)
+func redeemedPoints(discounts []models.OrderDiscount) *int {
+	var points int
+	for _, discount := range discounts {
+		points += discount.Points
+	}
+	if points == 0 {
+		return nil
+	}
+	return &points
+}
+
+// saveOrderDiscounts заменяет скидки заказа. Лимит использования акции проверяется
+// повторно под блокировкой её строки, чтобы параллельные заказы не превысили его.
+// Скидка баллами акции не имеет, её баллы списываются при закрытии заказа.
+func saveOrderDiscounts(tx *sql.Tx, orderID int, discounts []models.OrderDiscount) error {
+	if _, err := tx.Exec(`DELETE FROM order_discounts WHERE order_id = $1`, orderID); err != nil {
+		return fmt.Errorf("failed to delete order discounts: %w", err)
+	}
+
+	queryLimit := `SELECT COALESCE(usage_limit, 0) FROM promotions WHERE id = $1 FOR UPDATE`
+	queryUsed := `SELECT COUNT(DISTINCT d.order_id) FROM order_discounts d JOIN orders o ON o.id = d.order_id
+		WHERE d.promotion_id = $1 AND d.order_id <> $2 AND o.status <> 'cancelled'`
+	queryInsert := `INSERT INTO order_discounts (order_id, promotion_id, name, code, amount, points)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), $5, NULLIF($6, 0))`
+
+	for _, discount := range discounts {
+		if discount.Points > 0 {
+			if _, err := tx.Exec(queryInsert, orderID, 0, discount.Name, "", discount.Amount, discount.Points); err != nil {
+				return fmt.Errorf("failed to insert order discount: %w", err)
+			}
+			continue
+		}
+
+		var limit int
+		err := tx.QueryRow(queryLimit, discount.PromotionID).Scan(&limit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: promotion %d no longer exists", utils.ErrValidation, discount.PromotionID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock promotion: %w", err)
+		}
+		if limit > 0 {
+			var used int
+			if err := tx.QueryRow(queryUsed, discount.PromotionID, orderID).Scan(&used); err != nil {
+				return fmt.Errorf("failed to count promotion usage: %w", err)
+			}
+			if used >= limit {
+				return fmt.Errorf("%w: promotion %q has reached its usage limit", utils.ErrValidation, discount.Name)
+			}
+		}
+
+		if _, err := tx.Exec(queryInsert, orderID, discount.PromotionID, discount.Name, discount.Code, discount.Amount, 0); err != nil {
+			return fmt.Errorf("failed to insert order discount: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"frappuccino/internal/database"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// refundedAmountSQL — сумма, уже возвращённая гостю по оплатам заказа $1
+const refundedAmountSQL = `COALESCE((SELECT SUM(rp.amount) FROM refund_payments rp
+	JOIN payments p ON p.id = rp.payment_id WHERE p.order_id = $1), 0)`
+
+// RefundOrder оформляет полный или частичный возврат закрытого заказа.
+// Стоимость возвращаемых позиций считается от итоговой суммы заказа, деньги
+// возвращаются по исходным оплатам (начиная с последней), но не больше, чем было
+// оплачено. Ингредиенты возвращаются на склад (adjustment) или списываются в отходы
+// (waste). Когда возвращено всё, заказ переходит в статус refunded.
+// Оплаты подарочными картами возвращаются на те же карты.
+// Баллы, начисленные за заказ, снимаются в доле возвращённой суммы; баллы, которыми
+// платили, возвращаются клиенту новой партией со сроком pointsTTL.
+func (r PaymentRepository) RefundOrder(orderID int, request models.RefundRequest, pointsTTL time.Duration) (models.Refund, error) {
+	refund := models.Refund{
+		OrderID: orderID, Restock: request.Restock, Reason: request.Reason, Actor: request.Actor,
+		Items: []models.RefundItem{}, Payments: []models.RefundPayment{}, OrderStatus: models.OrderStatusClosed,
+	}
+
+	errTransact := database.WithTransaction(r.db, func(tx *sql.Tx) error {
+		// Блокируем заказ: параллельные возвраты и оплаты идут по очереди
+		var status string
+		var total float64
+		err := tx.QueryRow(`SELECT status, total_amount FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status, &total)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("order with ID %d not found", orderID)
+			}
+			return fmt.Errorf("error getting element: %v", err)
+		}
+		if status != models.OrderStatusClosed {
+			return fmt.Errorf("%w: order %d is %s", ErrOrderNotRefundable, orderID, status)
+		}
+
+		items, err := loadOrderItems(tx, orderID)
+		if err != nil {
+			return err
+		}
+		refundedQuantities, err := refundedItemQuantities(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		byID := make(map[int]models.OrderItem, len(items))
+		remaining := make(map[int]float64, len(items))
+		var itemsValue float64
+		for _, item := range items {
+			byID[item.ID] = item
+			remaining[item.ID] = item.Quantity - refundedQuantities[item.ID]
+			itemsValue += item.Price * item.Quantity
+		}
+
+		lines := request.Items
+		if len(lines) == 0 {
+			for _, item := range items {
+				if remaining[item.ID] > 0 {
+					lines = append(lines, models.RefundItem{OrderItemID: item.ID, Quantity: remaining[item.ID]})
+				}
+			}
+			if len(lines) == 0 {
+				return fmt.Errorf("%w: nothing left to refund in order %d", ErrOrderNotRefundable, orderID)
+			}
+		}
+
+		requested := make(map[int]float64, len(lines))
+		for _, line := range lines {
+			if _, ok := byID[line.OrderItemID]; !ok {
+				return fmt.Errorf("%w: item %d does not belong to order %d", utils.ErrValidation, line.OrderItemID, orderID)
+			}
+			requested[line.OrderItemID] += line.Quantity
+			if requested[line.OrderItemID] > remaining[line.OrderItemID] {
+				return fmt.Errorf("%w: only %g of item %d left to refund", utils.ErrValidation, remaining[line.OrderItemID], line.OrderItemID)
+			}
+		}
+
+		complete := true
+		for id, left := range remaining {
+			if left-requested[id] > 0 {
+				complete = false
+				break
+			}
+		}
+
+		// Стоимость позиций — доля итоговой суммы заказа (с учётом всех надбавок)
+		ratio := 0.0
+		if itemsValue > 0 {
+			ratio = total / itemsValue
+		}
+		var value float64
+		for i := range lines {
+			lines[i].Amount = utils.RoundMoney(byID[lines[i].OrderItemID].Price * lines[i].Quantity * ratio)
+			value += lines[i].Amount
+		}
+		// Последний возврат забирает копейки, оставшиеся от округления
+		if complete {
+			var valueBefore float64
+			queryValue := `SELECT COALESCE(SUM(ri.amount), 0) FROM refund_items ri
+				JOIN refunds rf ON rf.id = ri.refund_id WHERE rf.order_id = $1`
+			if err := tx.QueryRow(queryValue, orderID).Scan(&valueBefore); err != nil {
+				return fmt.Errorf("failed to get refunded value: %v", err)
+			}
+			lines[len(lines)-1].Amount = utils.RoundMoney(lines[len(lines)-1].Amount + total - valueBefore - value)
+		}
+
+		// Вернуть можно не больше, чем гость заплатил и ещё не получил обратно
+		var paid, returned float64
+		if err := tx.QueryRow(`SELECT `+paidAmountSQL+`, `+refundedAmountSQL, orderID).Scan(&paid, &returned); err != nil {
+			return fmt.Errorf("failed to get paid amount: %v", err)
+		}
+		refund.Amount = utils.RoundMoney(math.Max(paid-returned, 0))
+		if !complete {
+			refund.Amount = math.Min(refund.Amount, utils.RoundMoney(value))
+		}
+
+		queryRefund := `INSERT INTO refunds (order_id, amount, restock, reason, actor)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, '')) RETURNING id, created_at`
+		if err := tx.QueryRow(queryRefund, orderID, refund.Amount, refund.Restock, refund.Reason, refund.Actor).
+			Scan(&refund.ID, &refund.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert refund: %v", err)
+		}
+
+		queryItem := `INSERT INTO refund_items (refund_id, order_item_id, quantity, amount) VALUES ($1, $2, $3, $4)`
+		for _, line := range lines {
+			if _, err := tx.Exec(queryItem, refund.ID, line.OrderItemID, line.Quantity, line.Amount); err != nil {
+				return fmt.Errorf("failed to insert refund item: %v", err)
+			}
+		}
+		refund.Items = lines
+
+		refund.Payments, err = allocateRefund(tx, orderID, refund.ID, refund.Amount)
+		if err != nil {
+			return err
+		}
+		if err := refundToGiftCards(tx, refund, refund.Payments); err != nil {
+			return err
+		}
+		if err := restoreRedeemedPoints(tx, refund, refund.Payments, pointsTTL); err != nil {
+			return err
+		}
+		share := 0.0
+		if total > 0 {
+			share = value / total
+		}
+		refund.ReversedPoints, err = reverseEarnedPoints(tx, refund, share, complete)
+		if err != nil {
+			return err
+		}
+		refund.RestoredPoints, err = restoreDiscountPoints(tx, refund, share, complete, pointsTTL)
+		if err != nil {
+			return err
+		}
+
+		if err := returnIngredients(tx, refund, byID); err != nil {
+			return err
+		}
+
+		if !complete {
+			return nil
+		}
+
+		notes := refund.Reason
+		if notes == "" {
+			notes = "Order refunded"
+		}
+		if err := setStatusChange(tx, models.OrderStatusChange{Actor: refund.Actor, Notes: notes}); err != nil {
+			return err
+		}
+		queryStatus := `UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1`
+		if _, err := tx.Exec(queryStatus, orderID, models.OrderStatusRefunded); err != nil {
+			return fmt.Errorf("error while refunding order: %v", err)
+		}
+		refund.OrderStatus = models.OrderStatusRefunded
+		return nil
+	})
+	if errTransact != nil {
+		return models.Refund{}, errTransact
+	}
+
+	return refund, nil
+}
+
+// refundedItemQuantities возвращает уже возвращённое количество по каждой позиции заказа
+func refundedItemQuantities(q querier, orderID int) (map[int]float64, error) {
+	query := `SELECT ri.order_item_id, SUM(ri.quantity) FROM refund_items ri
+		JOIN refunds rf ON rf.id = ri.refund_id
+		WHERE rf.order_id = $1 GROUP BY ri.order_item_id`
+	rows, err := q.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load refunded items: %w", err)
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]float64)
+	for rows.Next() {
+		var itemID int
+		var quantity float64
+		if err := rows.Scan(&itemID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		quantities[itemID] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return quantities, nil
+}
+
+// allocateRefund раскладывает сумму возврата по оплатам заказа, начиная с последней:
+// с каждой оплаты возвращается не больше, чем по ней ещё не вернули
+func allocateRefund(tx *sql.Tx, orderID, refundID int, amount float64) ([]models.RefundPayment, error) {
+	query := `SELECT p.id, p.method, p.amount - COALESCE((SELECT SUM(rp.amount) FROM refund_payments rp
+			WHERE rp.payment_id = p.id), 0)
+		FROM payments p WHERE p.order_id = $1 ORDER BY p.created_at DESC, p.id DESC`
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments: %w", err)
+	}
+
+	var available []models.RefundPayment
+	for rows.Next() {
+		var payment models.RefundPayment
+		if err := rows.Scan(&payment.PaymentID, &payment.Method, &payment.Amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		available = append(available, payment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	allocated := []models.RefundPayment{}
+	queryInsert := `INSERT INTO refund_payments (refund_id, payment_id, amount) VALUES ($1, $2, $3)`
+	for _, payment := range available {
+		if amount <= 0 {
+			break
+		}
+		part := utils.RoundMoney(math.Min(payment.Amount, amount))
+		if part <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(queryInsert, refundID, payment.PaymentID, part); err != nil {
+			return nil, fmt.Errorf("failed to insert refund payment: %v", err)
+		}
+		payment.Amount = part
+		allocated = append(allocated, payment)
+		amount = utils.RoundMoney(amount - part)
+	}
+
+	return allocated, nil
+}
+
+// returnIngredients отменяет списания склада, сделанные при закрытии заказа, в части
+// позиций возврата: возвращает их на склад (adjustment) или записывает в
+// inventory_transaction как отходы (waste)
+func returnIngredients(tx *sql.Tx, refund models.Refund, items map[int]models.OrderItem) error {
+	requirements := make(map[int]float64)
+	for _, line := range refund.Items {
+		item := items[line.OrderItemID]
+		item.Quantity = line.Quantity
+		if err := addLineRequirements(tx, item, requirements); err != nil {
+			return err
+		}
+	}
+	requirements, err := takenByOrder(tx, refund.OrderID, requirements)
+	if err != nil {
+		return err
+	}
+
+	notes := fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID)
+
+	if !refund.Restock {
+		query := `INSERT INTO inventory_transaction (inventory_id, transaction_type, quantity, notes, order_id)
+			VALUES ($1, 'waste', $2, $3, $4)`
+		for _, ingredientID := range sortedIngredientIDs(requirements) {
+			if _, err := tx.Exec(query, ingredientID, requirements[ingredientID], notes, refund.OrderID); err != nil {
+				return fmt.Errorf("failed to log waste: %v", err)
+			}
+		}
+		return nil
+	}
+
+	// Триггер log_inventory_change запишет возврат как adjustment, а не restock, с номером заказа
+	queryContext := `SELECT set_config('frappuccino.inventory_txn_type', 'adjustment', true),
+		set_config('frappuccino.inventory_notes', $1, true)`
+	if _, err := tx.Exec(queryContext, notes); err != nil {
+		return fmt.Errorf("failed to set inventory change context: %v", err)
+	}
+	if err := setInventoryOrder(tx, refund.OrderID); err != nil {
+		return err
+	}
+
+	queryRestock := `UPDATE inventory SET quantity = quantity + $1, updated_at = NOW() WHERE id = $2`
+	for _, ingredientID := range sortedIngredientIDs(requirements) {
+		if _, err := tx.Exec(queryRestock, requirements[ingredientID], ingredientID); err != nil {
+			return fmt.Errorf("failed to restock inventory: %v", err)
+		}
+	}
+	return setInventoryOrder(tx, 0)
+}
+
+// takenByOrder переводит потребность позиций возврата (по рецептам) в то, что заказ
+// действительно взял со склада при закрытии и что ещё не возвращено. Заготовка
+// возвращается не больше, чем её было списано, остальное — ингредиентами её рецепта,
+// как в expandPrepared при закрытии. У заказа без записанных списаний (закрыт до
+// их учёта) остаётся потребность по рецептам.
+func takenByOrder(tx *sql.Tx, orderID int, requirements map[int]float64) (map[int]float64, error) {
+	query := `SELECT inventory_id, SUM(CASE WHEN transaction_type = 'use' THEN quantity ELSE -quantity END)
+		FROM inventory_transaction
+		WHERE order_id = $1 AND transaction_type IN ('use', 'adjustment', 'waste')
+		GROUP BY inventory_id`
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order inventory usage: %w", err)
+	}
+	taken := make(map[int]float64)
+	for rows.Next() {
+		var ingredientID int
+		var quantity float64
+		if err := rows.Scan(&ingredientID, &quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		taken[ingredientID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if len(taken) == 0 {
+		return requirements, nil
+	}
+
+	err = expandRequirements(tx, requirements, func(ingredientID int) (float64, error) {
+		return taken[ingredientID], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	returned := make(map[int]float64, len(requirements))
+	for ingredientID, quantity := range requirements {
+		if quantity = min(quantity, taken[ingredientID]); quantity > 1e-9 {
+			returned[ingredientID] = quantity
+		}
+	}
+	return returned, nil
+}
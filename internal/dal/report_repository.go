@@ -3,16 +3,23 @@ package dal
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"frappuccino/models"
+	"frappuccino/utils"
 
 	"github.com/lib/pq"
 )
 
 type ReportRepositoryInterface interface {
 	TotalSales() (float64, error)
+	TaxTotals() (models.TaxReport, error)
+	DiscountTotals() (models.DiscountReport, error)
+	PriceConsistency() (models.PriceConsistencyReport, error)
+	GiftCardLiability() (models.GiftCardLiability, error)
+	ItemRevenue() (models.ItemRevenueReport, error)
 	GetPopularItems() ([]models.MenuItem, error)
 	GetOrderedItemsByDay(month string) ([]models.OrderItemReport, error)
 	GetOrderedItemsByMonth(year int) ([]models.OrderItemReport, error)
@@ -28,30 +35,307 @@ func NewReportRepository(_db *sql.DB) ReportRepository {
 	return ReportRepository{db: _db}
 }
 
+// TotalSales — выручка закрытых заказов за вычетом возвратов. Возвращённые
+// позиции вычитаются по их стоимости в refund_items, полностью возвращённые
+// заказы (refunded) в итоге дают ноль.
 func (r ReportRepository) TotalSales() (float64, error) {
-	var orderClosed models.Order
 	var totalSales float64
-	queryTotalSales := `SELECT total_amount
+	queryTotalSales := `SELECT COALESCE(SUM(total_amount), 0) - COALESCE((SELECT SUM(amount) FROM refund_items), 0)
 	FROM orders
-	WHERE status = 'closed'`
+	WHERE status IN ('closed', 'refunded')`
 
-	rows, err := r.db.Query(queryTotalSales)
-	if err != nil {
+	if err := r.db.QueryRow(queryTotalSales).Scan(&totalSales); err != nil {
 		return 0, err
 	}
+	return totalSales, nil
+}
+
+// TaxTotals суммирует налоги закрытых заказов по названию и ставке. Налог заказа
+// уменьшается в той же доле, в какой возвращена его стоимость (refund_items).
+func (r ReportRepository) TaxTotals() (models.TaxReport, error) {
+	query := `SELECT t.name, t.rate, SUM(t.taxable_amount * f.kept), SUM(t.amount * f.kept)
+	FROM order_taxes t
+	JOIN orders o ON o.id = t.order_id
+	CROSS JOIN LATERAL (
+		SELECT 1 - COALESCE((SELECT SUM(ri.amount) FROM refund_items ri
+			JOIN refunds rf ON rf.id = ri.refund_id WHERE rf.order_id = o.id), 0) / NULLIF(o.total_amount, 0) AS kept
+	) f
+	WHERE o.status IN ('closed', 'refunded') AND o.total_amount > 0
+	GROUP BY t.name, t.rate
+	ORDER BY t.name, t.rate`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return models.TaxReport{}, err
+	}
 	defer rows.Close()
 
+	report := models.TaxReport{Taxes: []models.OrderTax{}}
 	for rows.Next() {
-		if err := rows.Scan(&orderClosed.TotalAmount); err != nil {
-			return 0, err
+		var tax models.OrderTax
+		if err := rows.Scan(&tax.Name, &tax.Rate, &tax.TaxableAmount, &tax.Amount); err != nil {
+			return models.TaxReport{}, err
 		}
-		totalSales += orderClosed.TotalAmount
+		tax.TaxableAmount = utils.RoundMoney(tax.TaxableAmount)
+		tax.Amount = utils.RoundMoney(tax.Amount)
+		report.TotalTax += tax.Amount
+		report.Taxes = append(report.Taxes, tax)
+	}
+	if err := rows.Err(); err != nil {
+		return models.TaxReport{}, err
 	}
 
+	report.TotalTax = utils.RoundMoney(report.TotalTax)
+	return report, nil
+}
+
+// DiscountTotals суммирует скидки закрытых заказов по акциям, за вычетом той доли,
+// в которой заказ возвращён (как и в TaxTotals)
+func (r ReportRepository) DiscountTotals() (models.DiscountReport, error) {
+	query := `SELECT COALESCE(d.promotion_id, 0), d.name, COALESCE(d.code, ''), COUNT(DISTINCT d.order_id), SUM(d.amount * f.kept)
+	FROM order_discounts d
+	JOIN orders o ON o.id = d.order_id
+	CROSS JOIN LATERAL (
+		SELECT 1 - COALESCE((SELECT SUM(ri.amount) FROM refund_items ri
+			JOIN refunds rf ON rf.id = ri.refund_id WHERE rf.order_id = o.id), 0) / NULLIF(o.total_amount, 0) AS kept
+	) f
+	WHERE o.status IN ('closed', 'refunded') AND o.total_amount > 0
+	GROUP BY COALESCE(d.promotion_id, 0), d.name, COALESCE(d.code, '')
+	ORDER BY 5 DESC, 2`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return models.DiscountReport{}, err
+	}
+	defer rows.Close()
+
+	report := models.DiscountReport{Discounts: []models.DiscountTotal{}}
+	for rows.Next() {
+		var discount models.DiscountTotal
+		if err := rows.Scan(&discount.PromotionID, &discount.Name, &discount.Code, &discount.Orders, &discount.Amount); err != nil {
+			return models.DiscountReport{}, err
+		}
+		discount.Amount = utils.RoundMoney(discount.Amount)
+		report.TotalDiscount += discount.Amount
+		report.Discounts = append(report.Discounts, discount)
+	}
 	if err := rows.Err(); err != nil {
-		return 0, err
+		return models.DiscountReport{}, err
 	}
-	return totalSales, nil
+
+	report.TotalDiscount = utils.RoundMoney(report.TotalDiscount)
+	return report, nil
+}
+
+// PriceConsistency сверяет цену каждой позиции заказа с ценой меню, действовавшей
+// в момент последнего расчёта позиции (priced_at, а без него — создание заказа):
+// правка заказа пересчитывает изменённые позиции по текущим ценам. Позиции
+// с кастомизациями или правилом цены пропускаются: их цена законно отличается от цены меню.
+func (r ReportRepository) PriceConsistency() (models.PriceConsistencyReport, error) {
+	query := `SELECT o.id, oi.id, oi.menu_item_id, COALESCE(oi.variant_id, 0), o.created_at, p.priced_at, oi.price,
+		` + priceAtSQL("oi.menu_item_id", "oi.variant_id", "p.priced_at") + `
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	CROSS JOIN LATERAL (SELECT COALESCE(oi.priced_at, o.created_at) AS priced_at) p
+	WHERE oi.customizations = '{}'::JSONB AND oi.pricing_rule_name IS NULL
+	ORDER BY o.id, oi.id`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return models.PriceConsistencyReport{}, err
+	}
+	defer rows.Close()
+
+	report := models.PriceConsistencyReport{Mismatches: []models.PriceMismatch{}}
+	for rows.Next() {
+		var item models.PriceMismatch
+		var expected sql.NullFloat64
+		if err := rows.Scan(&item.OrderID, &item.ItemID, &item.ProductID, &item.VariantID, &item.OrderedAt, &item.PricedAt, &item.Price,
+			&expected); err != nil {
+			return models.PriceConsistencyReport{}, err
+		}
+		report.CheckedItems++
+		if expected.Valid && utils.RoundMoney(expected.Float64) == utils.RoundMoney(item.Price) {
+			continue
+		}
+		if expected.Valid {
+			item.ExpectedPrice = &expected.Float64
+		}
+		report.Mismatches = append(report.Mismatches, item)
+	}
+	if err := rows.Err(); err != nil {
+		return models.PriceConsistencyReport{}, err
+	}
+
+	querySkipped := `SELECT COUNT(*) FROM order_items
+		WHERE customizations <> '{}'::JSONB OR pricing_rule_name IS NOT NULL`
+	if err := r.db.QueryRow(querySkipped).Scan(&report.SkippedItems); err != nil {
+		return models.PriceConsistencyReport{}, err
+	}
+	return report, nil
+}
+
+// GiftCardLiability — непотраченные остатки подарочных карт: действующие карты
+// (обязательство перед гостями) и остатки, сгоревшие вместе с просроченными картами
+func (r ReportRepository) GiftCardLiability() (models.GiftCardLiability, error) {
+	report := models.GiftCardLiability{Cards: []models.GiftCard{}}
+
+	queryTotals := `SELECT
+		COUNT(*) FILTER (WHERE NOT expired), COALESCE(SUM(balance) FILTER (WHERE NOT expired), 0),
+		COUNT(*) FILTER (WHERE expired), COALESCE(SUM(balance) FILTER (WHERE expired), 0)
+	FROM (SELECT balance, expires_at IS NOT NULL AND expires_at <= NOW() AS expired
+		FROM gift_cards WHERE balance > 0) c`
+	if err := r.db.QueryRow(queryTotals).Scan(&report.OutstandingCards, &report.OutstandingBalance,
+		&report.ExpiredCards, &report.ExpiredBalance); err != nil {
+		return models.GiftCardLiability{}, err
+	}
+
+	query := `SELECT ` + giftCardColumns + ` FROM gift_cards
+	WHERE balance > 0 AND (expires_at IS NULL OR expires_at > NOW())
+	ORDER BY balance DESC, id`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return models.GiftCardLiability{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		card, err := scanGiftCard(rows)
+		if err != nil {
+			return models.GiftCardLiability{}, err
+		}
+		report.Cards = append(report.Cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return models.GiftCardLiability{}, err
+	}
+
+	report.OutstandingBalance = utils.RoundMoney(report.OutstandingBalance)
+	report.ExpiredBalance = utils.RoundMoney(report.ExpiredBalance)
+	return report, nil
+}
+
+// ItemRevenue — выручка закрытых заказов по позициям меню за вычетом возвратов.
+// Выручка строки — цена позиции без налога и скидок на невозвращённое количество:
+// refund_items.amount включает налог и скидки, поэтому вычитается количество, а не сумма.
+// Выручка строки комбо-набора делится между компонентами, сохранёнными при расчёте
+// позиции (customizations.bundle_components), пропорционально их ценам и количеству.
+// Одна строка запроса — позиция заказа или компонент набора.
+func (r ReportRepository) ItemRevenue() (models.ItemRevenueReport, error) {
+	query := `SELECT oi.id, COALESCE(c.product_id, oi.menu_item_id), COALESCE(mi.name, ''), oi.quantity,
+		COALESCE(c.quantity, 0), COALESCE(c.price, 0),
+		oi.price * (oi.quantity - COALESCE((SELECT SUM(ri.quantity) FROM refund_items ri WHERE ri.order_item_id = oi.id), 0))
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	LEFT JOIN LATERAL jsonb_array_elements(COALESCE(oi.customizations->'bundle_components', '[]'::JSONB))
+		WITH ORDINALITY AS bc(component, n) ON true
+	CROSS JOIN LATERAL (SELECT (bc.component->>'product_id')::INT AS product_id, (bc.component->>'quantity')::INT AS quantity,
+		(bc.component->>'price')::NUMERIC AS price) c
+	LEFT JOIN menu_items mi ON mi.id = COALESCE(c.product_id, oi.menu_item_id)
+	WHERE o.status IN ('closed', 'refunded')
+	ORDER BY oi.id, bc.n`
+
+	// soldLine — позиция заказа; у набора — по строке на компонент
+	type soldLine struct {
+		productID int
+		name      string
+		quantity  int
+		units     int // штук компонента в одном наборе; 0 — обычная позиция
+		weight    float64
+		amount    float64
+	}
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return models.ItemRevenueReport{}, err
+	}
+	defer rows.Close()
+
+	var orderItemIDs []int
+	byOrderItem := make(map[int][]soldLine)
+	for rows.Next() {
+		var orderItemID int
+		var line soldLine
+		var price float64
+		if err := rows.Scan(&orderItemID, &line.productID, &line.name, &line.quantity, &line.units, &price, &line.amount); err != nil {
+			return models.ItemRevenueReport{}, err
+		}
+		line.weight = price * float64(line.units)
+		if byOrderItem[orderItemID] == nil {
+			orderItemIDs = append(orderItemIDs, orderItemID)
+		}
+		byOrderItem[orderItemID] = append(byOrderItem[orderItemID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return models.ItemRevenueReport{}, err
+	}
+
+	revenue := make(map[int]*models.ItemRevenue)
+	itemOf := func(line soldLine) *models.ItemRevenue {
+		if revenue[line.productID] == nil {
+			revenue[line.productID] = &models.ItemRevenue{ProductID: line.productID, Name: line.name}
+		}
+		return revenue[line.productID]
+	}
+
+	for _, orderItemID := range orderItemIDs {
+		components := byOrderItem[orderItemID]
+
+		// Обычная позиция
+		if components[0].units == 0 {
+			item := itemOf(components[0])
+			item.Quantity += components[0].quantity
+			item.DirectRevenue += components[0].amount
+			continue
+		}
+
+		// Компоненты без цены делят выручку по количеству
+		var totalWeight float64
+		for _, component := range components {
+			totalWeight += component.weight
+		}
+		if totalWeight <= 0 {
+			for i := range components {
+				components[i].weight = float64(components[i].units)
+				totalWeight += components[i].weight
+			}
+		}
+
+		// Последний компонент получает остаток, чтобы доли в сумме давали выручку строки
+		amount := components[0].amount
+		rest := amount
+		for i, component := range components {
+			share := rest
+			if i < len(components)-1 {
+				share = utils.RoundMoney(amount * component.weight / totalWeight)
+			}
+			rest -= share
+
+			item := itemOf(component)
+			units := component.units * component.quantity
+			item.Quantity += units
+			item.BundleUnits += units
+			item.BundleRevenue += share
+		}
+	}
+
+	report := models.ItemRevenueReport{Items: []models.ItemRevenue{}}
+	for _, item := range revenue {
+		item.DirectRevenue = utils.RoundMoney(item.DirectRevenue)
+		item.BundleRevenue = utils.RoundMoney(item.BundleRevenue)
+		item.TotalRevenue = utils.RoundMoney(item.DirectRevenue + item.BundleRevenue)
+		report.TotalRevenue += item.TotalRevenue
+		report.Items = append(report.Items, *item)
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		if report.Items[i].TotalRevenue != report.Items[j].TotalRevenue {
+			return report.Items[i].TotalRevenue > report.Items[j].TotalRevenue
+		}
+		return report.Items[i].ProductID < report.Items[j].ProductID
+	})
+
+	report.TotalRevenue = utils.RoundMoney(report.TotalRevenue)
+	return report, nil
 }
 
 func (r ReportRepository) GetPopularItems() ([]models.MenuItem, error) {
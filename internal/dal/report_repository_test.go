@@ -0,0 +1,58 @@
+package dal
+
+import (
+	"testing"
+
+	"frappuccino/models"
+)
+
+// Полностью возвращённый заказ с налогом сверху цены не даёт выручки (и не уходит в минус)
+func TestItemRevenueFullyRefundedTaxExclusiveOrder(t *testing.T) {
+	db := testDB(t)
+	productID, _ := addTestProduct(t, db, 5)
+
+	orders := NewOrderRepository(db)
+	order, err := orders.AddOrder(models.Order{
+		CustomerName: "test",
+		OrderType:    models.OrderTypeTakeaway,
+		Items:        []models.OrderItem{{ProductID: productID, Quantity: 2, Price: 1}},
+		Subtotal:     2,
+		Taxes:        []models.OrderTax{{Name: "VAT", Rate: 0.1, TaxableAmount: 2, Amount: 0.2}},
+		TaxAmount:    0.2,
+		TotalAmount:  2.2,
+	})
+	if err != nil {
+		t.Fatalf("add order: %v", err)
+	}
+	payments := NewPaymentRepository(db)
+	if _, err := payments.AddPayment(order.ID, models.Payment{Method: models.PaymentMethodCard, Amount: 2.2}); err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	if _, _, err := orders.CloseOrder(order.ID, models.OrderStatusOpen, models.OrderStatusChange{}, true, 0); err != nil {
+		t.Fatalf("close order: %v", err)
+	}
+
+	revenueOf := func() float64 {
+		t.Helper()
+		report, err := NewReportRepository(db).ItemRevenue()
+		if err != nil {
+			t.Fatalf("ItemRevenue: %v", err)
+		}
+		for _, item := range report.Items {
+			if item.ProductID == productID {
+				return item.TotalRevenue
+			}
+		}
+		return 0
+	}
+	if revenue := revenueOf(); revenue != 2 {
+		t.Errorf("revenue before refund = %v, want 2", revenue)
+	}
+
+	if _, err := payments.RefundOrder(order.ID, models.RefundRequest{}, 0); err != nil {
+		t.Fatalf("refund order: %v", err)
+	}
+	if revenue := revenueOf(); revenue != 0 {
+		t.Errorf("revenue after full refund = %v, want 0", revenue)
+	}
+}
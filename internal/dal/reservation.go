@@ -0,0 +1,217 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"frappuccino/models"
+)
+
+// querier — общие методы *sql.DB и *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Зарезервированное количество для строки inventory (используется в SELECT ... FROM inventory)
+const reservedQuantitySQL = `COALESCE((SELECT SUM(r.quantity) FROM inventory_reservations r
+	WHERE r.ingredient_id = inventory.id AND r.status = 'held'), 0)`
+
+// orderRequirements считает, сколько каждого ингредиента нужно на все позиции заказа
+func orderRequirements(q querier, orderID int) (map[int]float64, error) {
+	items, err := loadOrderItems(q, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements := make(map[int]float64)
+	for _, item := range items {
+		if err := addLineRequirements(q, item, requirements); err != nil {
+			return nil, err
+		}
+	}
+
+	return requirements, nil
+}
+
+// addLineRequirements добавляет в requirements ингредиенты одной позиции заказа
+// с учётом размерного варианта, замен ингредиентов, добавок, модификаторов
+// и компонентов комбо-набора
+func addLineRequirements(q querier, item models.OrderItem, requirements map[int]float64) error {
+	custom := item.Customizations
+
+	substitutes := make(map[int]int, len(custom.Substitutions))
+	for _, substitution := range custom.Substitutions {
+		substitutes[substitution.IngredientID] = substitution.SubstituteID
+	}
+
+	// У размерного варианта свой рецепт
+	var recipe []models.MenuItemIngredient
+	var err error
+	if item.VariantID != 0 {
+		recipe, err = loadVariantRecipe(q, item.VariantID)
+	} else {
+		recipe, err = loadRecipe(q, item.ProductID)
+	}
+	if err != nil {
+		return err
+	}
+	for _, ingredient := range recipe {
+		ingredientID := ingredient.IngredientID
+		if substituteID, ok := substitutes[ingredientID]; ok {
+			ingredientID = substituteID
+		}
+		requirements[ingredientID] += ingredient.Quantity * item.Quantity
+	}
+
+	queryExtra := `SELECT ingredient_id, quantity FROM menu_extras WHERE code = $1`
+	for code, count := range custom.Extras {
+		var ingredientID int
+		var quantity float64
+		if err := q.QueryRow(queryExtra, code).Scan(&ingredientID, &quantity); err != nil {
+			return fmt.Errorf("failed to get extra %s: %w", code, err)
+		}
+		requirements[ingredientID] += quantity * float64(count) * item.Quantity
+	}
+
+	queryModifier := `SELECT COALESCE(ingredient_id, 0), quantity FROM modifiers WHERE id = $1`
+	for _, modifierID := range custom.Modifiers {
+		var ingredientID int
+		var quantity float64
+		if err := q.QueryRow(queryModifier, modifierID).Scan(&ingredientID, &quantity); err != nil {
+			return fmt.Errorf("failed to get modifier %d: %w", modifierID, err)
+		}
+		if ingredientID != 0 {
+			requirements[ingredientID] += quantity * item.Quantity
+		}
+	}
+
+	// Комбо-набор списывает рецепты компонентов, сохранённых при расчёте позиции.
+	// Без сохранённого состава (строка меню в FillAvailability) берутся текущие слоты.
+	components := custom.BundleComponents
+	if components == nil {
+		slots, err := loadBundleSlots(q, item.ProductID)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			components = append(components, models.BundleComponent{
+				SlotID: slot.ID, ProductID: slot.ComponentOf(custom.BundleChoices), Quantity: slot.Quantity,
+			})
+		}
+	}
+	for _, component := range components {
+		componentRecipe, err := loadRecipe(q, component.ProductID)
+		if err != nil {
+			return err
+		}
+		for _, ingredient := range componentRecipe {
+			requirements[ingredient.IngredientID] += ingredient.Quantity * float64(component.Quantity) * item.Quantity
+		}
+	}
+
+	return nil
+}
+
+// loadRecipe возвращает ингредиенты позиции меню
+func loadRecipe(q querier, menuItemID int) ([]models.MenuItemIngredient, error) {
+	query := `SELECT ingredient_id, quantity FROM menu_item_ingredients WHERE menu_item_id = $1`
+	rows, err := q.Query(query, menuItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recipe: %w", err)
+	}
+	defer rows.Close()
+
+	var recipe []models.MenuItemIngredient
+	for rows.Next() {
+		var ingredient models.MenuItemIngredient
+		if err := rows.Scan(&ingredient.IngredientID, &ingredient.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		recipe = append(recipe, ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return recipe, nil
+}
+
+// sortedIngredientIDs возвращает ID ингредиентов по возрастанию —
+// строки inventory всегда блокируются в одном порядке, чтобы не ловить deadlock
+func sortedIngredientIDs(requirements map[int]float64) []int {
+	ids := make([]int, 0, len(requirements))
+	for id := range requirements {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// reserveIngredients заново ставит резерв под текущий состав заказа.
+// Доступно = остаток на складе минус резервы других заказов.
+func reserveIngredients(tx *sql.Tx, orderID int) error {
+	if err := releaseReservations(tx, orderID); err != nil {
+		return err
+	}
+
+	requirements, err := orderRequirements(tx, orderID)
+	if err != nil {
+		return err
+	}
+	// Свои резервы уже сняты, так что доступность заготовок считается за вычетом всех резервов
+	if err := expandPrepared(tx, requirements, 0); err != nil {
+		return err
+	}
+
+	queryLock := `SELECT ingredient_name, quantity FROM inventory WHERE id = $1 FOR UPDATE`
+	queryReserved := `SELECT COALESCE(SUM(quantity), 0) FROM inventory_reservations
+		WHERE ingredient_id = $1 AND status = 'held'`
+	queryInsert := `INSERT INTO inventory_reservations (order_id, ingredient_id, quantity) VALUES ($1, $2, $3)`
+
+	for _, ingredientID := range sortedIngredientIDs(requirements) {
+		required := requirements[ingredientID]
+
+		var name string
+		var onHand, reserved float64
+		if err := tx.QueryRow(queryLock, ingredientID).Scan(&name, &onHand); err != nil {
+			return fmt.Errorf("failed to lock inventory: %w", err)
+		}
+		if err := tx.QueryRow(queryReserved, ingredientID).Scan(&reserved); err != nil {
+			return fmt.Errorf("failed to check reservations: %w", err)
+		}
+
+		if onHand-reserved < required {
+			return &InsufficientStockError{IngredientID: ingredientID, Name: name, Available: onHand - reserved, Required: required}
+		}
+
+		if _, err := tx.Exec(queryInsert, orderID, ingredientID, required); err != nil {
+			return fmt.Errorf("failed to reserve ingredient: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// releaseReservations снимает все активные резервы заказа
+func releaseReservations(tx *sql.Tx, orderID int) error {
+	query := `UPDATE inventory_reservations SET status = 'released', updated_at = NOW()
+		WHERE order_id = $1 AND status = 'held'`
+	if _, err := tx.Exec(query, orderID); err != nil {
+		return fmt.Errorf("failed to release reservations: %w", err)
+	}
+	return nil
+}
+
+// consumeReservations помечает резервы заказа списанными (вызывается при закрытии)
+func consumeReservations(tx *sql.Tx, orderID int) error {
+	query := `UPDATE inventory_reservations SET status = 'consumed', updated_at = NOW()
+		WHERE order_id = $1 AND status = 'held'`
+	if _, err := tx.Exec(query, orderID); err != nil {
+		return fmt.Errorf("failed to consume reservations: %w", err)
+	}
+	return nil
+}
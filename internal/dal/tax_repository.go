@@ -0,0 +1,71 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"frappuccino/models"
+)
+
+type TaxRepositoryInterface interface {
+	LoadTaxRates() ([]models.TaxRate, error)
+	AddTaxRate(rate models.TaxRate) (models.TaxRate, error)
+	DeleteTaxRate(id int) error
+}
+
+type TaxRepository struct {
+	db *sql.DB
+}
+
+func NewTaxRepository(db *sql.DB) TaxRepository {
+	return TaxRepository{db: db}
+}
+
+func (r TaxRepository) LoadTaxRates() ([]models.TaxRate, error) {
+	query := `SELECT id, tax_category, order_type, name, rate FROM tax_rates ORDER BY tax_category, order_type, id`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []models.TaxRate{}
+	for rows.Next() {
+		var rate models.TaxRate
+		if err := rows.Scan(&rate.ID, &rate.TaxCategory, &rate.OrderType, &rate.Name, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return rates, nil
+}
+
+func (r TaxRepository) AddTaxRate(rate models.TaxRate) (models.TaxRate, error) {
+	query := `INSERT INTO tax_rates (tax_category, order_type, name, rate) VALUES ($1, $2, $3, $4) RETURNING id`
+	if err := r.db.QueryRow(query, rate.TaxCategory, rate.OrderType, rate.Name, rate.Rate).Scan(&rate.ID); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.TaxRate{}, fmt.Errorf("tax %q already exists for %s %s orders", rate.Name, rate.TaxCategory, rate.OrderType)
+		}
+		return models.TaxRate{}, fmt.Errorf("failed to insert tax rate: %w", err)
+	}
+	return rate, nil
+}
+
+func (r TaxRepository) DeleteTaxRate(id int) error {
+	result, err := r.db.Exec(`DELETE FROM tax_rates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tax rate: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("tax rate with ID %d not found", id)
+	}
+	return nil
+}
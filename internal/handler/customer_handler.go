@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type CustomerHandler struct {
+	customerService service.CustomerService
+}
+
+func NewCustomerHandler(_customerService service.CustomerService) CustomerHandler {
+	return CustomerHandler{customerService: _customerService}
+}
+
+func (h CustomerHandler) HandleGetCustomers(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get customers")
+
+	customers, err := h.customerService.GetCustomers()
+	if err != nil {
+		slog.Error("Failed to retrieve customers", "error", err)
+		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, customers)
+}
+
+func (h CustomerHandler) HandleCreateCustomer(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to create customer")
+
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newCustomer, err := h.customerService.CreateCustomer(customer)
+	if err != nil {
+		slog.Warn("Failed to create customer", "error", err)
+		utils.ErrorInJSON(w, customerErrorCode(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	slog.Info("Customer created successfully", "customerID", newCustomer.ID)
+	setETag(w, newCustomer.Version)
+	utils.ResponseInJSON(w, http.StatusCreated, newCustomer)
+}
+
+func (h CustomerHandler) HandleGetCustomer(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to get customer", "customerID", id)
+
+	customer, err := h.customerService.GetCustomer(id)
+	if err != nil {
+		slog.Warn("Customer not found", "customerID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	if notModified(w, r, customer.Version) {
+		return
+	}
+
+	setETag(w, customer.Version)
+	utils.ResponseInJSON(w, http.StatusOK, customer)
+}
+
+func (h CustomerHandler) HandleUpdateCustomer(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to update customer", "customerID", id)
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	updated, err := h.customerService.UpdateCustomer(id, customer, version)
+	if err != nil {
+		slog.Warn("Failed to update customer", "customerID", id, "error", err)
+		utils.ErrorInJSON(w, versionErrorCode(err, customerErrorCode(err, http.StatusNotFound)), err)
+		return
+	}
+
+	slog.Info("Customer updated successfully", "customerID", id)
+	setETag(w, updated.Version)
+	utils.ResponseInJSON(w, http.StatusOK, updated)
+}
+
+func (h CustomerHandler) HandleDeleteCustomer(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to delete customer", "customerID", id)
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.customerService.DeleteCustomer(id, version); err != nil {
+		slog.Warn("Failed to delete customer", "customerID", id, "error", err)
+		utils.ErrorInJSON(w, versionErrorCode(err, http.StatusNotFound), err)
+		return
+	}
+
+	slog.Info("Customer deleted successfully", "customerID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h CustomerHandler) HandleGetCustomerOrders(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to get customer orders", "customerID", id)
+
+	orders, err := h.customerService.GetCustomerOrders(id)
+	if err != nil {
+		slog.Warn("Failed to retrieve customer orders", "customerID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, orders)
+}
+
+// customerErrorCode: 400 — неверные данные, 409 — телефон или email заняты, иначе fallback
+func customerErrorCode(err error, fallback int) int {
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrCustomerExists):
+		return http.StatusConflict
+	default:
+		return fallback
+	}
+}
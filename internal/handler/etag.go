@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"frappuccino/internal/service"
+	"frappuccino/utils"
+)
+
+var errIfMatchRequired = errors.New("If-Match header with the current ETag is required")
+
+// setETag отдаёт версию записи как сильный ETag: "3"
+func setETag(w http.ResponseWriter, version int) {
+	setTagETag(w, strconv.Itoa(version))
+}
+
+func setTagETag(w http.ResponseWriter, tag string) {
+	w.Header().Set("ETag", strconv.Quote(tag))
+}
+
+// contentTag — ETag записи, часть полей которой считается при чтении (остатки склада,
+// доступность позиции): "3-1a2b…", версия и хеш тела ответа. 304 отдаётся, только если
+// не изменилось и то и другое, а If-Match сверяет версию из первой части.
+func contentTag(version int, body any) string {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return strconv.Itoa(version)
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	return fmt.Sprintf("%d-%x", version, hash.Sum64())
+}
+
+// notModified проверяет If-None-Match для GET. Если клиентская копия актуальна,
+// отвечает 304 и возвращает true.
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	return notModifiedTag(w, r, strconv.Itoa(version))
+}
+
+// notModifiedTag — то же для ETag из contentTag
+func notModifiedTag(w http.ResponseWriter, r *http.Request, current string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if unquoted, err := strconv.Unquote(tag); err == nil {
+			tag = unquoted
+		}
+		if tag == "*" || tag == current {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion читает ожидаемую версию из If-Match. "*" означает любую версию (0).
+// Без заголовка отвечает 428, с некорректным — 400; в обоих случаях ok == false.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (version int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		utils.ErrorInJSON(w, http.StatusPreconditionRequired, errIfMatchRequired)
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	version, err := parseETag(header)
+	if err != nil {
+		utils.ErrorInJSON(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	return version, true
+}
+
+func parseETag(tag string) (int, error) {
+	tag = strings.TrimPrefix(tag, "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		unquoted = tag
+	}
+	// у ETag из contentTag версия — часть до дефиса
+	unquoted, _, _ = strings.Cut(unquoted, "-")
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid ETag %s", tag)
+	}
+	return version, nil
+}
+
+// versionErrorCode возвращает 412 при конфликте версий, иначе fallback
+func versionErrorCode(err error, fallback int) int {
+	if errors.Is(err, service.ErrVersionMismatch) {
+		return http.StatusPreconditionFailed
+	}
+	return fallback
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type GiftCardHandler struct {
+	giftCardService service.GiftCardService
+}
+
+func NewGiftCardHandler(_giftCardService service.GiftCardService) GiftCardHandler {
+	return GiftCardHandler{giftCardService: _giftCardService}
+}
+
+func (h GiftCardHandler) HandleIssueGiftCard(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to issue gift card")
+
+	var card models.GiftCard
+	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newCard, err := h.giftCardService.IssueGiftCard(card)
+	if err != nil {
+		slog.Warn("Failed to issue gift card", "error", err)
+		utils.ErrorInJSON(w, giftCardErrorCode(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	slog.Info("Gift card issued successfully", "giftCardID", newCard.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newCard)
+}
+
+func (h GiftCardHandler) HandleGetGiftCard(w http.ResponseWriter, r *http.Request, code string) {
+	slog.Info("Received request to get gift card")
+
+	card, err := h.giftCardService.GetGiftCard(code)
+	if err != nil {
+		slog.Warn("Gift card not found", "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, card)
+}
+
+func (h GiftCardHandler) HandleTopUpGiftCard(w http.ResponseWriter, r *http.Request, code string) {
+	slog.Info("Received request to top up gift card")
+
+	var topUp models.GiftCardTopUp
+	if err := json.NewDecoder(r.Body).Decode(&topUp); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	card, err := h.giftCardService.TopUpGiftCard(code, topUp)
+	if err != nil {
+		slog.Warn("Failed to top up gift card", "error", err)
+		utils.ErrorInJSON(w, giftCardErrorCode(err, http.StatusNotFound), err)
+		return
+	}
+
+	slog.Info("Gift card topped up successfully", "giftCardID", card.ID, "balance", card.Balance)
+	utils.ResponseInJSON(w, http.StatusOK, card)
+}
+
+// giftCardErrorCode: 400 — неверные данные, 409 — код занят или карта просрочена, иначе fallback
+func giftCardErrorCode(err error, fallback int) int {
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrGiftCardExists), errors.Is(err, service.ErrGiftCardNotUsable):
+		return http.StatusConflict
+	default:
+		return fallback
+	}
+}
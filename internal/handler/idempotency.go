@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/utils"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type IdempotencyMiddleware struct {
+	idempotencyService service.IdempotencyService
+}
+
+func NewIdempotencyMiddleware(_idempotencyService service.IdempotencyService) IdempotencyMiddleware {
+	return IdempotencyMiddleware{idempotencyService: _idempotencyService}
+}
+
+// responseRecorder запоминает код и тело ответа, одновременно отдавая их клиенту
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Wrap делает POST-обработчик идемпотентным по заголовку Idempotency-Key.
+// Без заголовка запрос обрабатывается как обычно. Ответы 5xx не сохраняются,
+// чтобы клиент мог повторить запрос.
+func (m IdempotencyMiddleware) Wrap(endpoint string, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %v", err))
+			return
+		}
+
+		record, release, err := m.idempotencyService.Begin(r.Context(), key, endpoint, body)
+		if err != nil {
+			slog.Warn("Idempotency check failed", "key", key, "endpoint", endpoint, "error", err)
+			if errors.Is(err, service.ErrIdempotencyKeyReused) {
+				utils.ErrorInJSON(w, http.StatusUnprocessableEntity, err)
+				return
+			}
+			utils.ErrorInJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		defer release()
+
+		if record != nil {
+			slog.Info("Replaying idempotent response", "key", key, "endpoint", endpoint)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.ResponseBody)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+			return
+		}
+		if err := m.idempotencyService.Complete(key, endpoint, body, rec.statusCode, rec.body.Bytes()); err != nil {
+			slog.Error("Failed to save idempotent response", "key", key, "endpoint", endpoint, "error", err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -74,17 +75,30 @@ func (h InventoryHandler) HandleGetInventoryById(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// reserved и available меняются вместе с резервами заказов без смены версии,
+	// поэтому они входят в ETag
+	tag := contentTag(inventory.Version, inventory)
+	if notModifiedTag(w, r, tag) {
+		return
+	}
+
 	slog.Info("Successfully retrieved inventory", "inventoryID", inventory.IngredientID)
+	setTagETag(w, tag)
 	utils.ResponseInJSON(w, 200, inventory)
 }
 
 func (h InventoryHandler) HandleDeleteInventoryItem(w http.ResponseWriter, r *http.Request, inventoryItemID int) {
 	slog.Info("Received request to delete inventory", "inevntoryID", inventoryItemID)
 
-	err := h.inventoryService.DeleteInventoryItemByID(inventoryItemID)
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.inventoryService.DeleteInventoryItemByID(inventoryItemID, version)
 	if err != nil {
 		slog.Warn("Failed to delete inventory", "inventoryID", inventoryItemID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, versionErrorCode(err, http.StatusNotFound), err)
 		return
 	}
 
@@ -95,6 +109,11 @@ func (h InventoryHandler) HandleDeleteInventoryItem(w http.ResponseWriter, r *ht
 func (h InventoryHandler) HandleUpdateInventoryItem(w http.ResponseWriter, r *http.Request, inventoryItemID int) {
 	slog.Info("Received request to update inventory", "inventoryID", inventoryItemID)
 
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
 	var changedInventoryItem models.InventoryItem
 	if err := json.NewDecoder(r.Body).Decode(&changedInventoryItem); err != nil {
 		slog.Warn("Invalid JSON format", "error", err)
@@ -102,13 +121,18 @@ func (h InventoryHandler) HandleUpdateInventoryItem(w http.ResponseWriter, r *ht
 		return
 	}
 
-	item, err := h.inventoryService.UpdateInventoryItem(inventoryItemID, changedInventoryItem)
+	item, err := h.inventoryService.UpdateInventoryItem(inventoryItemID, changedInventoryItem, version)
 	if err != nil {
 		slog.Warn("Failed to update inventory", "inventoryID", inventoryItemID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		code := http.StatusNotFound
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, versionErrorCode(err, code), err)
 		return
 	}
 	slog.Info("inventory updated successfully", "inventoryID", item.IngredientID)
+	setETag(w, item.Version)
 	utils.ResponseInJSON(w, 200, item)
 }
 
@@ -138,3 +162,37 @@ func (h InventoryHandler) HandleGetLeftoversHandler(w http.ResponseWriter, r *ht
 	slog.Info("Successfully retrieved inventory leftovers")
 	utils.ResponseInJSON(w, 200, result)
 }
+
+func (h InventoryHandler) HandleProduceInventory(w http.ResponseWriter, r *http.Request, inventoryItemID int) {
+	slog.Info("Received request to produce prepared ingredient", "inventoryID", inventoryItemID)
+
+	var production models.InventoryProduction
+	if err := json.NewDecoder(r.Body).Decode(&production); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid request body JSON format: %v", err))
+		return
+	}
+
+	result, err := h.inventoryService.ProduceInventory(inventoryItemID, production)
+	if err != nil {
+		slog.Warn("Failed to produce prepared ingredient", "inventoryID", inventoryItemID, "error", err)
+		utils.ErrorInJSON(w, productionErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Prepared ingredient produced successfully", "inventoryID", inventoryItemID, "remaining", result.Remaining)
+	utils.ResponseInJSON(w, http.StatusOK, result)
+}
+
+// productionErrorCode: 400 — неверные данные или у позиции нет рецепта, 409 — не хватает сырья, иначе 404
+func productionErrorCode(err error) int {
+	var stockErr *service.InsufficientStockError
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.As(err, &stockErr):
+		return http.StatusConflict
+	default:
+		return http.StatusNotFound
+	}
+}
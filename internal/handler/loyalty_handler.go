@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type LoyaltyHandler struct {
+	loyaltyService service.LoyaltyService
+}
+
+func NewLoyaltyHandler(_loyaltyService service.LoyaltyService) LoyaltyHandler {
+	return LoyaltyHandler{loyaltyService: _loyaltyService}
+}
+
+func (h LoyaltyHandler) HandleGetLoyaltyRules(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get loyalty rules")
+
+	rules, err := h.loyaltyService.GetLoyaltyRules()
+	if err != nil {
+		slog.Error("Failed to retrieve loyalty rules", "error", err)
+		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, rules)
+}
+
+func (h LoyaltyHandler) HandleCreateLoyaltyRule(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to create loyalty rule")
+
+	var rule models.LoyaltyRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newRule, err := h.loyaltyService.CreateLoyaltyRule(rule)
+	if err != nil {
+		slog.Warn("Failed to create loyalty rule", "error", err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, code, err)
+		return
+	}
+
+	slog.Info("Loyalty rule created successfully", "loyaltyRuleID", newRule.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newRule)
+}
+
+func (h LoyaltyHandler) HandleDeleteLoyaltyRule(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to delete loyalty rule", "loyaltyRuleID", id)
+
+	if err := h.loyaltyService.DeleteLoyaltyRule(id); err != nil {
+		slog.Warn("Failed to delete loyalty rule", "loyaltyRuleID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Loyalty rule deleted successfully", "loyaltyRuleID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h LoyaltyHandler) HandleGetCustomerLoyalty(w http.ResponseWriter, r *http.Request, customerID int) {
+	slog.Info("Received request to get customer loyalty", "customerID", customerID)
+
+	loyalty, err := h.loyaltyService.GetCustomerLoyalty(customerID)
+	if err != nil {
+		slog.Warn("Failed to retrieve customer loyalty", "customerID", customerID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, loyalty)
+}
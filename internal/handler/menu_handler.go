@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"frappuccino/internal/service"
 	"frappuccino/models"
@@ -64,10 +66,32 @@ func (m MenuHandler) HandleCreateMenuItem(w http.ResponseWriter, r *http.Request
 func (m MenuHandler) HandleGetAllMenuItems(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Received request to get all menu items")
 
-	items, err := m.menuService.GetAllMenuItems()
+	// ?available=true&excludeAllergens=nuts,dairy&diet=vegan
+	var filter models.MenuFilter
+	if availableStr := r.URL.Query().Get("available"); availableStr != "" {
+		var err error
+		filter.OnlyAvailable, err = strconv.ParseBool(availableStr)
+		if err != nil {
+			slog.Warn("Invalid available parameter", "available", availableStr)
+			utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid available parameter: %q", availableStr))
+			return
+		}
+	}
+	if allergens := r.URL.Query().Get("excludeAllergens"); allergens != "" {
+		filter.ExcludeAllergens = strings.Split(allergens, ",")
+	}
+	if diets := r.URL.Query().Get("diet"); diets != "" {
+		filter.Diets = strings.Split(diets, ",")
+	}
+
+	items, err := m.menuService.GetAllMenuItems(filter)
 	if err != nil {
 		slog.Error("Failed to retrieve menu items", "error", err)
-		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, code, err)
 		return
 	}
 
@@ -96,7 +120,14 @@ func (m MenuHandler) HandleGetMenuItemById(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// available, max_portions и аллергены зависят от склада, поэтому они входят в ETag
+	tag := contentTag(item.Version, item)
+	if notModifiedTag(w, r, tag) {
+		return
+	}
+
 	slog.Info("Successfully retrieved menu item", "menuID", item.ID)
+	setTagETag(w, tag)
 	utils.ResponseInJSON(w, 200, item)
 }
 
@@ -109,10 +140,15 @@ func (m MenuHandler) HandleDeleteMenuItemById(w http.ResponseWriter, r *http.Req
 	// 	return
 	// }
 
-	err := m.menuService.DeleteMenuItemByID(menuID)
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.menuService.DeleteMenuItemByID(menuID, version)
 	if err != nil {
 		slog.Warn("Failed to delete menu item", "menuID", menuID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, versionErrorCode(err, menuErrorCode(err)), err)
 		return
 	}
 
@@ -129,6 +165,11 @@ func (m MenuHandler) HandleUpdateMenu(w http.ResponseWriter, r *http.Request, me
 	// 	return
 	// }
 
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
 	var changeMenu models.MenuItem
 	if err := json.NewDecoder(r.Body).Decode(&changeMenu); err != nil {
 		slog.Warn("Invalid JSON format", "error", err)
@@ -142,13 +183,233 @@ func (m MenuHandler) HandleUpdateMenu(w http.ResponseWriter, r *http.Request, me
 		return
 	}
 
-	menu, err := m.menuService.UpdateMenu(menuID, changeMenu)
+	menu, err := m.menuService.UpdateMenu(menuID, changeMenu, version)
 	if err != nil {
 		slog.Warn("Failed to update menu item", "menuID", menuID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, versionErrorCode(err, http.StatusNotFound), err)
 		return
 	}
 
 	slog.Info("Menu item updated successfully", "menuID", menu.ID)
+	setETag(w, menu.Version)
 	utils.ResponseInJSON(w, 200, menu)
 }
+
+func (m MenuHandler) HandleGetVariants(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to get menu item variants", "menuID", menuID)
+
+	variants, err := m.menuService.GetVariants(menuID)
+	if err != nil {
+		slog.Warn("Failed to retrieve variants", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	if len(variants) == 0 {
+		utils.ResponseInJSON(w, 200, []models.MenuItemVariant{})
+		return
+	}
+
+	utils.ResponseInJSON(w, 200, variants)
+}
+
+func (m MenuHandler) HandleGetVariant(w http.ResponseWriter, r *http.Request, menuID, variantID int) {
+	slog.Info("Received request to get menu item variant", "menuID", menuID, "variantID", variantID)
+
+	variant, err := m.menuService.GetVariant(menuID, variantID)
+	if err != nil {
+		slog.Warn("Variant not found", "menuID", menuID, "variantID", variantID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, 200, variant)
+}
+
+func (m MenuHandler) HandleCreateVariant(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to add a menu item variant", "menuID", menuID)
+
+	var newVariant models.MenuItemVariant
+	if err := json.NewDecoder(r.Body).Decode(&newVariant); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	variant, err := m.menuService.CreateVariant(menuID, newVariant)
+	if err != nil {
+		slog.Warn("Failed to add variant", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Variant added successfully", "menuID", menuID, "variantID", variant.ID)
+	utils.ResponseInJSON(w, 201, variant)
+}
+
+func (m MenuHandler) HandleUpdateVariant(w http.ResponseWriter, r *http.Request, menuID, variantID int) {
+	slog.Info("Received request to update menu item variant", "menuID", menuID, "variantID", variantID)
+
+	var changeVariant models.MenuItemVariant
+	if err := json.NewDecoder(r.Body).Decode(&changeVariant); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	variant, err := m.menuService.UpdateVariant(menuID, variantID, changeVariant)
+	if err != nil {
+		slog.Warn("Failed to update variant", "menuID", menuID, "variantID", variantID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Variant updated successfully", "menuID", menuID, "variantID", variantID)
+	utils.ResponseInJSON(w, 200, variant)
+}
+
+func (m MenuHandler) HandleDeleteVariant(w http.ResponseWriter, r *http.Request, menuID, variantID int) {
+	slog.Info("Received request to delete menu item variant", "menuID", menuID, "variantID", variantID)
+
+	if err := m.menuService.DeleteVariant(menuID, variantID); err != nil {
+		slog.Warn("Failed to delete variant", "menuID", menuID, "variantID", variantID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Variant deleted successfully", "menuID", menuID, "variantID", variantID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSetSoldOut: POST /menu/{id}/sold-out снимает позицию с продажи, DELETE — возвращает
+func (m MenuHandler) HandleSetSoldOut(w http.ResponseWriter, r *http.Request, menuID int, soldOut bool) {
+	slog.Info("Received request to change sold out flag", "menuID", menuID, "soldOut", soldOut)
+
+	item, err := m.menuService.SetSoldOut(menuID, soldOut)
+	if err != nil {
+		slog.Warn("Failed to change sold out flag", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Sold out flag changed successfully", "menuID", menuID, "soldOut", soldOut)
+	setETag(w, item.Version)
+	utils.ResponseInJSON(w, http.StatusOK, item)
+}
+
+// menuErrorCode: 400 — неверные данные, 409 — позиция входит в комбо-набор
+// или вариант уже есть в заказах, иначе 404
+func menuErrorCode(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrMenuItemInBundle), errors.Is(err, service.ErrVariantInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusNotFound
+	}
+}
+
+func (m MenuHandler) HandleGetModifierGroups(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to get modifier groups", "menuID", menuID)
+
+	groups, err := m.menuService.GetModifierGroups(menuID)
+	if err != nil {
+		slog.Warn("Failed to retrieve modifier groups", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	if len(groups) == 0 {
+		utils.ResponseInJSON(w, 200, []models.ModifierGroup{})
+		return
+	}
+
+	utils.ResponseInJSON(w, 200, groups)
+}
+
+func (m MenuHandler) HandleCreateModifierGroup(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to add a modifier group", "menuID", menuID)
+
+	var newGroup models.ModifierGroup
+	if err := json.NewDecoder(r.Body).Decode(&newGroup); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	group, err := m.menuService.CreateModifierGroup(menuID, newGroup)
+	if err != nil {
+		slog.Warn("Failed to add modifier group", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Modifier group added successfully", "menuID", menuID, "groupID", group.ID)
+	utils.ResponseInJSON(w, 201, group)
+}
+
+func (m MenuHandler) HandleDeleteModifierGroup(w http.ResponseWriter, r *http.Request, menuID, groupID int) {
+	slog.Info("Received request to delete modifier group", "menuID", menuID, "groupID", groupID)
+
+	if err := m.menuService.DeleteModifierGroup(menuID, groupID); err != nil {
+		slog.Warn("Failed to delete modifier group", "menuID", menuID, "groupID", groupID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Modifier group deleted successfully", "menuID", menuID, "groupID", groupID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m MenuHandler) HandleGetBundleSlots(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to get bundle slots", "menuID", menuID)
+
+	slots, err := m.menuService.GetBundleSlots(menuID)
+	if err != nil {
+		slog.Warn("Failed to retrieve bundle slots", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	if len(slots) == 0 {
+		utils.ResponseInJSON(w, 200, []models.BundleSlot{})
+		return
+	}
+
+	utils.ResponseInJSON(w, 200, slots)
+}
+
+func (m MenuHandler) HandleCreateBundleSlot(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to add a bundle slot", "menuID", menuID)
+
+	var newSlot models.BundleSlot
+	if err := json.NewDecoder(r.Body).Decode(&newSlot); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	slot, err := m.menuService.CreateBundleSlot(menuID, newSlot)
+	if err != nil {
+		slog.Warn("Failed to add bundle slot", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Bundle slot added successfully", "menuID", menuID, "slotID", slot.ID)
+	utils.ResponseInJSON(w, 201, slot)
+}
+
+func (m MenuHandler) HandleDeleteBundleSlot(w http.ResponseWriter, r *http.Request, menuID, slotID int) {
+	slog.Info("Received request to delete bundle slot", "menuID", menuID, "slotID", slotID)
+
+	if err := m.menuService.DeleteBundleSlot(menuID, slotID); err != nil {
+		slog.Warn("Failed to delete bundle slot", "menuID", menuID, "slotID", slotID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Bundle slot deleted successfully", "menuID", menuID, "slotID", slotID)
+	w.WriteHeader(http.StatusNoContent)
+}
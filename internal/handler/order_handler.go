@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"frappuccino/internal/service"
 	"frappuccino/models"
@@ -19,8 +23,16 @@ type OrderHandlerInterface interface {
 	HandleDeleteOrder(w http.ResponseWriter, r *http.Request, orderID int)
 	HandleUpdateOrder(w http.ResponseWriter, r *http.Request, orderID int)
 	HandleCloseOrder(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleStartOrder(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleReadyOrder(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleCancelOrder(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleReopenOrder(w http.ResponseWriter, r *http.Request, orderID int)
 	HandleNumberOfOrderedItems(w http.ResponseWriter, r *http.Request, startDate, endDate string)
 	HandleBulkOrder(w http.ResponseWriter, r *http.Request)
+	HandleGetOrderHistory(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleAddOrderItem(w http.ResponseWriter, r *http.Request, orderID int)
+	HandleUpdateOrderItem(w http.ResponseWriter, r *http.Request, orderID, productID int)
+	HandleRemoveOrderItem(w http.ResponseWriter, r *http.Request, orderID, productID int)
 }
 
 type OrderHandler struct {
@@ -48,6 +60,10 @@ func (h OrderHandler) HandleCreateOrder(w http.ResponseWriter, r *http.Request)
 	order, err := h.orderService.CreateOrder(newOrder)
 	if err != nil {
 		slog.Error("Failed to create order", "error", err)
+		if errors.Is(err, service.ErrItemSoldOut) {
+			utils.ErrorInJSON(w, http.StatusConflict, err)
+			return
+		}
 		utils.ErrorInJSON(w, 400, err)
 		return
 	} else {
@@ -79,17 +95,41 @@ func (h OrderHandler) HandleGetOrderById(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if notModified(w, r, order.Version) {
+		return
+	}
+
 	slog.Info("Successfully retrieved order", "orderID", order.ID)
+	setETag(w, order.Version)
 	utils.ResponseInJSON(w, 200, order)
 }
 
+func (h OrderHandler) HandleGetOrderHistory(w http.ResponseWriter, r *http.Request, orderID int) {
+	slog.Info("Received request to get order history", "orderID", orderID)
+
+	history, err := h.orderService.GetOrderHistory(orderID)
+	if err != nil {
+		slog.Warn("Failed to retrieve order history", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Successfully retrieved order history", "orderID", orderID, "count", len(history.History))
+	utils.ResponseInJSON(w, 200, history)
+}
+
 func (h OrderHandler) HandleDeleteOrder(w http.ResponseWriter, r *http.Request, orderID int) {
 	slog.Info("Received request to delete order", "orderID", orderID)
 
-	err := h.orderService.DeleteOrder(orderID)
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.orderService.DeleteOrder(orderID, version)
 	if err != nil {
 		slog.Warn("Failed to delete order", "orderID", orderID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, versionErrorCode(err, http.StatusNotFound), err)
 		return
 	}
 
@@ -100,6 +140,11 @@ func (h OrderHandler) HandleDeleteOrder(w http.ResponseWriter, r *http.Request,
 func (h OrderHandler) HandleUpdateOrder(w http.ResponseWriter, r *http.Request, orderID int) {
 	slog.Info("Received request to update order", "orderID", orderID)
 
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
 	var changeOrder models.Order
 	if err := json.NewDecoder(r.Body).Decode(&changeOrder); err != nil {
 		slog.Warn("Invalid JSON format", "error", err)
@@ -107,26 +152,141 @@ func (h OrderHandler) HandleUpdateOrder(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	order, err := h.orderService.UpdateOrder(orderID, changeOrder)
+	order, err := h.orderService.UpdateOrder(orderID, changeOrder, version)
 	if err != nil {
 		slog.Warn("Failed to update order", "orderID", orderID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, versionErrorCode(err, orderItemErrorCode(err)), err)
 		return
 	} else {
 		slog.Info("Order updated successfully", "orderID", order.ID)
+		setETag(w, order.Version)
 		utils.ResponseInJSON(w, 200, order)
 	}
 }
 
+func (h OrderHandler) HandleAddOrderItem(w http.ResponseWriter, r *http.Request, orderID int) {
+	slog.Info("Received request to add order item", "orderID", orderID)
+
+	var item models.OrderItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	order, err := h.orderService.AddOrderItem(orderID, item)
+	if err != nil {
+		slog.Warn("Failed to add order item", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, versionErrorCode(err, orderItemErrorCode(err)), err)
+		return
+	}
+
+	slog.Info("Order item added successfully", "orderID", orderID, "productID", item.ProductID)
+	setETag(w, order.Version)
+	utils.ResponseInJSON(w, 200, order)
+}
+
+// HandleUpdateOrderItem меняет позицию с продуктом productID. Если в заказе несколько
+// позиций этого продукта, нужную выбирают по ?item_id=
+func (h OrderHandler) HandleUpdateOrderItem(w http.ResponseWriter, r *http.Request, orderID, productID int) {
+	slog.Info("Received request to update order item", "orderID", orderID, "productID", productID)
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := orderItemID(r)
+	if err != nil {
+		utils.ErrorInJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var patch models.OrderItemPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	order, err := h.orderService.UpdateOrderItem(orderID, productID, itemID, patch, version)
+	if err != nil {
+		slog.Warn("Failed to update order item", "orderID", orderID, "productID", productID, "error", err)
+		utils.ErrorInJSON(w, versionErrorCode(err, orderItemErrorCode(err)), err)
+		return
+	}
+
+	slog.Info("Order item updated successfully", "orderID", orderID, "productID", productID)
+	setETag(w, order.Version)
+	utils.ResponseInJSON(w, 200, order)
+}
+
+// HandleRemoveOrderItem удаляет позицию с продуктом productID (?item_id= — как в HandleUpdateOrderItem)
+func (h OrderHandler) HandleRemoveOrderItem(w http.ResponseWriter, r *http.Request, orderID, productID int) {
+	slog.Info("Received request to remove order item", "orderID", orderID, "productID", productID)
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := orderItemID(r)
+	if err != nil {
+		utils.ErrorInJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := h.orderService.RemoveOrderItem(orderID, productID, itemID, version)
+	if err != nil {
+		slog.Warn("Failed to remove order item", "orderID", orderID, "productID", productID, "error", err)
+		utils.ErrorInJSON(w, versionErrorCode(err, orderItemErrorCode(err)), err)
+		return
+	}
+
+	slog.Info("Order item removed successfully", "orderID", orderID, "productID", productID)
+	setETag(w, order.Version)
+	utils.ResponseInJSON(w, 200, order)
+}
+
+// orderItemID читает необязательный ?item_id= (0 — не указан)
+func orderItemID(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("item_id")
+	if value == "" {
+		return 0, nil
+	}
+	itemID, err := strconv.Atoi(value)
+	if err != nil || itemID <= 0 {
+		return 0, fmt.Errorf("invalid item_id %q", value)
+	}
+	return itemID, nil
+}
+
+func orderItemErrorCode(err error) int {
+	var stockErr *service.InsufficientStockError
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrOrderNotEditable), errors.Is(err, service.ErrItemSoldOut), errors.As(err, &stockErr):
+		return http.StatusConflict
+	default:
+		return http.StatusNotFound
+	}
+}
+
 func (h OrderHandler) HandleCloseOrder(w http.ResponseWriter, r *http.Request, orderID int) {
 	slog.Info("Received request to close order", "orderID", orderID)
 
-	order, inventoryUpdates, err := h.orderService.CloseOrder(orderID)
+	change, err := decodeStatusChange(r)
+	if err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	order, inventoryUpdates, err := h.orderService.CloseOrder(orderID, change)
 	if inventoryUpdates == nil {
 	}
 	if err != nil {
 		slog.Warn("Failed to close order", "orderID", orderID, "error", err)
-		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		utils.ErrorInJSON(w, statusChangeErrorCode(err), err)
 		return
 	} else {
 		slog.Info("Order closed successfully", "orderID", order.ID)
@@ -134,6 +294,78 @@ func (h OrderHandler) HandleCloseOrder(w http.ResponseWriter, r *http.Request, o
 	}
 }
 
+func (h OrderHandler) HandleStartOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	h.handleStatusChange(w, r, orderID, "start", h.orderService.StartOrder)
+}
+
+func (h OrderHandler) HandleReadyOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	h.handleStatusChange(w, r, orderID, "mark ready", h.orderService.ReadyOrder)
+}
+
+func (h OrderHandler) HandleCancelOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	h.handleStatusChange(w, r, orderID, "cancel", h.orderService.CancelOrder)
+}
+
+func (h OrderHandler) HandleReopenOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	h.handleStatusChange(w, r, orderID, "reopen", h.orderService.ReopenOrder)
+}
+
+// handleStatusChange — общий обработчик для POST /orders/{id}/{action}
+func (h OrderHandler) handleStatusChange(w http.ResponseWriter, r *http.Request, orderID int, action string,
+	transition func(id int, change models.OrderStatusChange) (models.Order, error),
+) {
+	slog.Info("Received request to "+action+" order", "orderID", orderID)
+
+	change, err := decodeStatusChange(r)
+	if err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := transition(orderID, change)
+	if err != nil {
+		slog.Warn("Failed to "+action+" order", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, statusChangeErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Order status changed successfully", "orderID", order.ID, "status", order.Status)
+	utils.ResponseInJSON(w, 200, order)
+}
+
+// Тело запроса со сменой статуса необязательно: {"actor": "...", "notes": "..."}
+func decodeStatusChange(r *http.Request) (models.OrderStatusChange, error) {
+	var change models.OrderStatusChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil && !errors.Is(err, io.EOF) {
+		return models.OrderStatusChange{}, fmt.Errorf("invalid JSON format: %v", err)
+	}
+
+	// actor попадает в order_status_history.changed_by
+	actor := strings.TrimSpace(change.Actor)
+	if change.Actor != "" && actor == "" {
+		return models.OrderStatusChange{}, fmt.Errorf("actor cannot be blank")
+	}
+	if utf8.RuneCountInString(actor) > models.MaxActorLength {
+		return models.OrderStatusChange{}, fmt.Errorf("actor must be at most %d characters", models.MaxActorLength)
+	}
+	change.Actor = actor
+	return change, nil
+}
+
+func statusChangeErrorCode(err error) int {
+	var stockErr *service.InsufficientStockError
+	switch {
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrOrderStatusChanged),
+		errors.Is(err, service.ErrOrderNotPaid), errors.As(err, &stockErr), errors.Is(err, service.ErrInsufficientPoints):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h OrderHandler) HandleNumberOfOrderedItems(w http.ResponseWriter, r *http.Request, startDate, endDate string) {
 	slog.Info("Received request to get number of ordered items", "startDate", startDate, "endDate", endDate)
 
@@ -166,14 +398,33 @@ func (h OrderHandler) HandleBulkOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// режим можно передать в теле или параметром ?mode=
+	mode := bulkOrderRequest.Mode
+	if mode == "" {
+		mode = r.URL.Query().Get("mode")
+	}
+
 	// Передаём список заказов в сервис
-	bulkOrders, err := h.orderService.CreateBulkOrder(bulkOrderRequest.Orders)
+	bulkOrders, err := h.orderService.CreateBulkOrder(bulkOrderRequest.Orders, mode)
 	if err != nil {
 		slog.Error("Failed to create bulk orders", "error", err)
+		if errors.Is(err, utils.ErrValidation) {
+			utils.ErrorInJSON(w, http.StatusBadRequest, err)
+			return
+		}
 		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	slog.Info("✔ Bulk orders created successfully")
-	utils.ResponseInJSON(w, http.StatusCreated, bulkOrders)
+	switch {
+	case bulkOrders.Summary.Mode == models.BatchModeDryRun:
+		slog.Info("✔ Bulk orders simulated", "accepted", bulkOrders.Summary.Accepted, "rejected", bulkOrders.Summary.Rejected)
+		utils.ResponseInJSON(w, http.StatusOK, bulkOrders)
+	case !bulkOrders.Summary.Committed:
+		slog.Warn("Bulk orders rolled back", "mode", bulkOrders.Summary.Mode, "rejected", bulkOrders.Summary.Rejected)
+		utils.ResponseInJSON(w, http.StatusConflict, bulkOrders)
+	default:
+		slog.Info("✔ Bulk orders created successfully")
+		utils.ResponseInJSON(w, http.StatusCreated, bulkOrders)
+	}
 }
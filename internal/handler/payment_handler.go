@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PaymentHandler struct {
+	paymentService service.PaymentService
+}
+
+func NewPaymentHandler(_paymentService service.PaymentService) PaymentHandler {
+	return PaymentHandler{paymentService: _paymentService}
+}
+
+func (h PaymentHandler) HandleAddPayment(w http.ResponseWriter, r *http.Request, orderID int) {
+	slog.Info("Received request to add payment", "orderID", orderID)
+
+	var payment models.Payment
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newPayment, summary, err := h.paymentService.AddPayment(orderID, payment)
+	if err != nil {
+		slog.Warn("Failed to add payment", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, paymentErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Payment added successfully", "orderID", orderID, "paymentID", newPayment.ID, "balance", summary.Balance)
+	utils.ResponseInJSON(w, http.StatusCreated, struct {
+		Payment models.Payment       `json:"payment"`
+		Order   models.OrderPayments `json:"order"`
+	}{newPayment, summary})
+}
+
+func (h PaymentHandler) HandleGetPayments(w http.ResponseWriter, r *http.Request, orderID int) {
+	slog.Info("Received request to get payments", "orderID", orderID)
+
+	payments, err := h.paymentService.GetPayments(orderID)
+	if err != nil {
+		slog.Warn("Failed to retrieve payments", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, payments)
+}
+
+// HandleRefundOrder — POST /orders/{id}/refund. Тело необязательно: без items возвращается весь заказ.
+func (h PaymentHandler) HandleRefundOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	slog.Info("Received request to refund order", "orderID", orderID)
+
+	var request models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	refund, err := h.paymentService.RefundOrder(orderID, request)
+	if err != nil {
+		slog.Warn("Failed to refund order", "orderID", orderID, "error", err)
+		utils.ErrorInJSON(w, paymentErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Order refunded successfully", "orderID", orderID, "refundID", refund.ID, "amount", refund.Amount)
+	utils.ResponseInJSON(w, http.StatusCreated, refund)
+}
+
+func paymentErrorCode(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrOrderNotPayable), errors.Is(err, service.ErrOrderNotRefundable),
+		errors.Is(err, service.ErrInsufficientPoints), errors.Is(err, service.ErrGiftCardNotUsable):
+		return http.StatusConflict
+	default:
+		return http.StatusNotFound
+	}
+}
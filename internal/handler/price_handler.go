@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PriceHandler struct {
+	priceService service.PriceService
+}
+
+func NewPriceHandler(_priceService service.PriceService) PriceHandler {
+	return PriceHandler{priceService: _priceService}
+}
+
+func (h PriceHandler) HandleSchedulePriceChange(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to schedule price change", "menuID", menuID)
+
+	var change models.ScheduledPriceChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newChange, err := h.priceService.SchedulePriceChange(menuID, change)
+	if err != nil {
+		slog.Warn("Failed to schedule price change", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	slog.Info("Price change scheduled successfully", "menuID", menuID, "priceChangeID", newChange.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newChange)
+}
+
+func (h PriceHandler) HandleGetPriceHistory(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to get price history", "menuID", menuID)
+
+	history, err := h.priceService.GetPriceHistory(menuID)
+	if err != nil {
+		slog.Warn("Failed to retrieve price history", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, history)
+}
+
+// HandleGetPriceAt — цена позиции в момент ?at= (RFC 3339, по умолчанию сейчас),
+// ?variant_id= — цена размерного варианта
+func (h PriceHandler) HandleGetPriceAt(w http.ResponseWriter, r *http.Request, menuID int) {
+	slog.Info("Received request to get price at time", "menuID", menuID)
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid at %q, expected RFC 3339 time", value))
+			return
+		}
+		at = parsed
+	}
+	var variantID int
+	if value := r.URL.Query().Get("variant_id"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid variant_id %q", value))
+			return
+		}
+		variantID = parsed
+	}
+
+	price, err := h.priceService.GetPriceAt(menuID, variantID, at)
+	if err != nil {
+		slog.Warn("Failed to get price at time", "menuID", menuID, "error", err)
+		utils.ErrorInJSON(w, menuErrorCode(err), err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, price)
+}
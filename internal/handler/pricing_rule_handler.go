@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PricingRuleHandler struct {
+	pricingRuleService service.PricingRuleService
+}
+
+func NewPricingRuleHandler(_pricingRuleService service.PricingRuleService) PricingRuleHandler {
+	return PricingRuleHandler{pricingRuleService: _pricingRuleService}
+}
+
+func (h PricingRuleHandler) HandleGetPricingRules(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get pricing rules")
+
+	rules, err := h.pricingRuleService.GetPricingRules()
+	if err != nil {
+		slog.Error("Failed to retrieve pricing rules", "error", err)
+		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, rules)
+}
+
+func (h PricingRuleHandler) HandleCreatePricingRule(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to create pricing rule")
+
+	var rule models.PricingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newRule, err := h.pricingRuleService.CreatePricingRule(rule)
+	if err != nil {
+		slog.Warn("Failed to create pricing rule", "error", err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, code, err)
+		return
+	}
+
+	slog.Info("Pricing rule created successfully", "pricingRuleID", newRule.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newRule)
+}
+
+func (h PricingRuleHandler) HandleDeletePricingRule(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to delete pricing rule", "pricingRuleID", id)
+
+	if err := h.pricingRuleService.DeletePricingRule(id); err != nil {
+		slog.Warn("Failed to delete pricing rule", "pricingRuleID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Pricing rule deleted successfully", "pricingRuleID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PromotionHandler struct {
+	promotionService service.PromotionService
+}
+
+func NewPromotionHandler(_promotionService service.PromotionService) PromotionHandler {
+	return PromotionHandler{promotionService: _promotionService}
+}
+
+func (h PromotionHandler) HandleGetPromotions(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get promotions")
+
+	promotions, err := h.promotionService.GetPromotions()
+	if err != nil {
+		slog.Error("Failed to retrieve promotions", "error", err)
+		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, promotions)
+}
+
+func (h PromotionHandler) HandleCreatePromotion(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to create promotion")
+
+	var promotion models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newPromotion, err := h.promotionService.CreatePromotion(promotion)
+	if err != nil {
+		slog.Warn("Failed to create promotion", "error", err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, code, err)
+		return
+	}
+
+	slog.Info("Promotion created successfully", "promotionID", newPromotion.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newPromotion)
+}
+
+func (h PromotionHandler) HandleDeletePromotion(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to delete promotion", "promotionID", id)
+
+	if err := h.promotionService.DeletePromotion(id); err != nil {
+		slog.Warn("Failed to delete promotion", "promotionID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Promotion deleted successfully", "promotionID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -13,6 +13,10 @@ import (
 
 type ReportHandlerInterface interface {
 	HandleGetTotalSales(w http.ResponseWriter, r *http.Request)
+	HandleGetTaxTotals(w http.ResponseWriter, r *http.Request)
+	HandleGetDiscountTotals(w http.ResponseWriter, r *http.Request)
+	HandleGetPriceConsistency(w http.ResponseWriter, r *http.Request)
+	HandleGetGiftCardLiability(w http.ResponseWriter, r *http.Request)
 	HandleGetPopularItems(w http.ResponseWriter, r *http.Request)
 	HandleSearch(w http.ResponseWriter, r *http.Request)
 	HandleGetOrderedItemsByPeriod(w http.ResponseWriter, r *http.Request)
@@ -42,6 +46,76 @@ func (h ReportHandler) HandleGetTotalSales(w http.ResponseWriter, r *http.Reques
 	slog.Info("✅ Total sales response sent successfully", "total_sales", totalSales)
 }
 
+func (h ReportHandler) HandleGetTaxTotals(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get tax totals")
+
+	report, err := h.reportService.GetTaxTotals()
+	if err != nil {
+		slog.Error("Failed to fetch tax totals from service", "error", err.Error())
+		http.Error(w, "Failed to retrieve tax totals", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, report)
+	slog.Info("Tax totals response sent successfully", "total_tax", report.TotalTax)
+}
+
+func (h ReportHandler) HandleGetDiscountTotals(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get discount totals")
+
+	report, err := h.reportService.GetDiscountTotals()
+	if err != nil {
+		slog.Error("Failed to fetch discount totals from service", "error", err.Error())
+		http.Error(w, "Failed to retrieve discount totals", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, report)
+	slog.Info("Discount totals response sent successfully", "total_discount", report.TotalDiscount)
+}
+
+func (h ReportHandler) HandleGetPriceConsistency(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to check order prices")
+
+	report, err := h.reportService.GetPriceConsistency()
+	if err != nil {
+		slog.Error("Failed to check order prices", "error", err.Error())
+		http.Error(w, "Failed to check order prices", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, report)
+	slog.Info("Price consistency response sent successfully", "mismatches", len(report.Mismatches))
+}
+
+func (h ReportHandler) HandleGetGiftCardLiability(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get gift card liability")
+
+	report, err := h.reportService.GetGiftCardLiability()
+	if err != nil {
+		slog.Error("Failed to fetch gift card liability from service", "error", err.Error())
+		http.Error(w, "Failed to retrieve gift card liability", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, report)
+	slog.Info("Gift card liability response sent successfully", "outstanding_balance", report.OutstandingBalance)
+}
+
+func (h ReportHandler) HandleGetItemRevenue(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get item revenue")
+
+	report, err := h.reportService.GetItemRevenue()
+	if err != nil {
+		slog.Error("Failed to fetch item revenue from service", "error", err.Error())
+		http.Error(w, "Failed to retrieve item revenue", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, report)
+	slog.Info("Item revenue response sent successfully", "total_revenue", report.TotalRevenue)
+}
+
 func (h ReportHandler) HandleGetPopularItems(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Received request to get popular items")
 
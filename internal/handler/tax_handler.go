@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type TaxHandler struct {
+	taxService service.TaxService
+}
+
+func NewTaxHandler(_taxService service.TaxService) TaxHandler {
+	return TaxHandler{taxService: _taxService}
+}
+
+func (h TaxHandler) HandleGetTaxRates(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to get tax rates")
+
+	rates, err := h.taxService.GetTaxRates()
+	if err != nil {
+		slog.Error("Failed to retrieve tax rates", "error", err)
+		utils.ErrorInJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.ResponseInJSON(w, http.StatusOK, rates)
+}
+
+func (h TaxHandler) HandleCreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request to create tax rate")
+
+	var rate models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		slog.Warn("Invalid JSON format", "error", err)
+		utils.ErrorInJSON(w, http.StatusBadRequest, fmt.Errorf("invalid JSON format: %v", err))
+		return
+	}
+
+	newRate, err := h.taxService.CreateTaxRate(rate)
+	if err != nil {
+		slog.Warn("Failed to create tax rate", "error", err)
+		code := http.StatusConflict
+		if errors.Is(err, utils.ErrValidation) {
+			code = http.StatusBadRequest
+		}
+		utils.ErrorInJSON(w, code, err)
+		return
+	}
+
+	slog.Info("Tax rate created successfully", "taxRateID", newRate.ID)
+	utils.ResponseInJSON(w, http.StatusCreated, newRate)
+}
+
+func (h TaxHandler) HandleDeleteTaxRate(w http.ResponseWriter, r *http.Request, id int) {
+	slog.Info("Received request to delete tax rate", "taxRateID", id)
+
+	if err := h.taxService.DeleteTaxRate(id); err != nil {
+		slog.Warn("Failed to delete tax rate", "taxRateID", id, "error", err)
+		utils.ErrorInJSON(w, http.StatusNotFound, err)
+		return
+	}
+
+	slog.Info("Tax rate deleted successfully", "taxRateID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
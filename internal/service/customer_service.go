@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// ErrCustomerExists — телефон или email уже принадлежат другому клиенту
+var ErrCustomerExists = dal.ErrCustomerExists
+
+type CustomerServiceInterface interface {
+	GetCustomers() ([]models.Customer, error)
+	GetCustomer(id int) (models.Customer, error)
+	CreateCustomer(customer models.Customer) (models.Customer, error)
+	UpdateCustomer(id int, customer models.Customer, version int) (models.Customer, error)
+	DeleteCustomer(id, version int) error
+	GetCustomerOrders(id int) (models.CustomerOrders, error)
+}
+
+type CustomerService struct {
+	customerRepo dal.CustomerRepositoryInterface
+	orderRepo    dal.OrderRepositoryInterface
+}
+
+func NewCustomerService(_customerRepo dal.CustomerRepositoryInterface, _orderRepo dal.OrderRepositoryInterface) CustomerService {
+	return CustomerService{customerRepo: _customerRepo, orderRepo: _orderRepo}
+}
+
+func (s CustomerService) GetCustomers() ([]models.Customer, error) {
+	return s.customerRepo.LoadCustomers()
+}
+
+func (s CustomerService) GetCustomer(id int) (models.Customer, error) {
+	return s.customerRepo.GetCustomer(id)
+}
+
+func (s CustomerService) CreateCustomer(customer models.Customer) (models.Customer, error) {
+	customer, err := prepareCustomer(customer)
+	if err != nil {
+		return models.Customer{}, err
+	}
+
+	newCustomer, err := s.customerRepo.AddCustomer(customer)
+	if err != nil {
+		return models.Customer{}, err
+	}
+	log.Printf("customer added: %d", newCustomer.ID)
+	return newCustomer, nil
+}
+
+// UpdateCustomer заменяет карточку клиента; version — значение If-Match (0 — без проверки)
+func (s CustomerService) UpdateCustomer(id int, customer models.Customer, version int) (models.Customer, error) {
+	if customer.ID != 0 && customer.ID != id {
+		return models.Customer{}, fmt.Errorf("%w: customer ID cannot be changed", utils.ErrValidation)
+	}
+	customer, err := prepareCustomer(customer)
+	if err != nil {
+		return models.Customer{}, err
+	}
+
+	updated, err := s.customerRepo.UpdateCustomer(id, customer, version)
+	if err != nil {
+		return models.Customer{}, err
+	}
+	log.Printf("customer updated: %d", id)
+	return updated, nil
+}
+
+// DeleteCustomer удаляет клиента; version — значение If-Match (0 — без проверки)
+func (s CustomerService) DeleteCustomer(id, version int) error {
+	if err := s.customerRepo.DeleteCustomer(id, version); err != nil {
+		return err
+	}
+	log.Printf("customer deleted: %d", id)
+	return nil
+}
+
+// GetCustomerOrders возвращает заказы клиента с потраченной суммой и любимыми позициями
+func (s CustomerService) GetCustomerOrders(id int) (models.CustomerOrders, error) {
+	if _, err := s.customerRepo.GetCustomer(id); err != nil {
+		return models.CustomerOrders{}, err
+	}
+
+	result, err := s.customerRepo.CustomerTotals(id)
+	if err != nil {
+		return models.CustomerOrders{}, err
+	}
+	orders, err := s.orderRepo.LoadCustomerOrders(id)
+	if err != nil {
+		return models.CustomerOrders{}, err
+	}
+	result.Orders = orders
+	if result.Orders == nil {
+		result.Orders = []models.Order{}
+	}
+	return result, nil
+}
+
+// prepareCustomer приводит телефон и email к одному виду и проверяет карточку
+func prepareCustomer(customer models.Customer) (models.Customer, error) {
+	customer.Name = strings.TrimSpace(customer.Name)
+	customer.Phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(customer.Phone)
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+	if customer.Preferences == nil {
+		customer.Preferences = map[string]any{}
+	}
+	if err := utils.ValidateCustomer(customer); err != nil {
+		return models.Customer{}, err
+	}
+	return customer, nil
+}
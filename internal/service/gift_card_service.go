@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// ErrGiftCardExists — подарочная карта с таким кодом уже выпущена
+var ErrGiftCardExists = dal.ErrGiftCardExists
+
+// ErrGiftCardNotUsable — карта просрочена или пуста
+var ErrGiftCardNotUsable = dal.ErrGiftCardNotUsable
+
+// maxGiftCardAmount — наибольший остаток, который можно положить на карту за раз
+const maxGiftCardAmount = 10000
+
+var giftCardCodeRegex = regexp.MustCompile(`^[A-Z0-9-]{6,32}$`)
+
+// giftCardAlphabet — символы генерируемого кода без похожих друг на друга (0/O, 1/I)
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type GiftCardServiceInterface interface {
+	IssueGiftCard(card models.GiftCard) (models.GiftCard, error)
+	GetGiftCard(code string) (models.GiftCard, error)
+	TopUpGiftCard(code string, topUp models.GiftCardTopUp) (models.GiftCard, error)
+}
+
+type GiftCardService struct {
+	giftCardRepo dal.GiftCardRepositoryInterface
+}
+
+func NewGiftCardService(_giftCardRepo dal.GiftCardRepositoryInterface) GiftCardService {
+	return GiftCardService{giftCardRepo: _giftCardRepo}
+}
+
+// IssueGiftCard выпускает карту; без code сервер генерирует код вида GC-XXXX-XXXX-XXXX
+func (s GiftCardService) IssueGiftCard(card models.GiftCard) (models.GiftCard, error) {
+	card.Code = NormalizeGiftCardCode(card.Code)
+	if err := validateGiftCard(card); err != nil {
+		return models.GiftCard{}, err
+	}
+
+	generated := card.Code == ""
+	for attempt := 0; ; attempt++ {
+		if generated {
+			code, err := newGiftCardCode()
+			if err != nil {
+				return models.GiftCard{}, err
+			}
+			card.Code = code
+		}
+
+		newCard, err := s.giftCardRepo.IssueGiftCard(card)
+		// Сгенерированный код мог совпасть с уже выпущенным — пробуем другой
+		if generated && errors.Is(err, ErrGiftCardExists) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return models.GiftCard{}, err
+		}
+		log.Printf("gift card issued: %d (%.2f)", newCard.ID, newCard.InitialAmount)
+		return newCard, nil
+	}
+}
+
+func (s GiftCardService) GetGiftCard(code string) (models.GiftCard, error) {
+	return s.giftCardRepo.GetGiftCard(NormalizeGiftCardCode(code))
+}
+
+func (s GiftCardService) TopUpGiftCard(code string, topUp models.GiftCardTopUp) (models.GiftCard, error) {
+	if topUp.Amount <= 0 || topUp.Amount > maxGiftCardAmount {
+		return models.GiftCard{}, fmt.Errorf("%w: top-up amount must be between 0 and %d", utils.ErrValidation, maxGiftCardAmount)
+	}
+	if topUp.Amount != utils.RoundMoney(topUp.Amount) {
+		return models.GiftCard{}, fmt.Errorf("%w: top-up amount must have at most 2 decimal places", utils.ErrValidation)
+	}
+	if len(topUp.Notes) > 200 {
+		return models.GiftCard{}, fmt.Errorf("%w: notes are too long", utils.ErrValidation)
+	}
+
+	card, err := s.giftCardRepo.TopUpGiftCard(NormalizeGiftCardCode(code), topUp)
+	if err != nil {
+		return models.GiftCard{}, err
+	}
+	log.Printf("gift card topped up: %d (+%.2f, balance %.2f)", card.ID, topUp.Amount, card.Balance)
+	return card, nil
+}
+
+// NormalizeGiftCardCode приводит код карты к виду, в котором он хранится
+func NormalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validateGiftCard(card models.GiftCard) error {
+	if card.Code != "" && !giftCardCodeRegex.MatchString(card.Code) {
+		return fmt.Errorf("%w: code must be 6-32 letters, digits or dashes", utils.ErrValidation)
+	}
+	if card.InitialAmount <= 0 || card.InitialAmount > maxGiftCardAmount {
+		return fmt.Errorf("%w: initial_amount must be between 0 and %d", utils.ErrValidation, maxGiftCardAmount)
+	}
+	if card.InitialAmount != utils.RoundMoney(card.InitialAmount) {
+		return fmt.Errorf("%w: initial_amount must have at most 2 decimal places", utils.ErrValidation)
+	}
+	if card.Balance != 0 {
+		return fmt.Errorf("%w: balance starts at initial_amount and cannot be set", utils.ErrValidation)
+	}
+	if card.CustomerID < 0 {
+		return fmt.Errorf("%w: invalid customer_id", utils.ErrValidation)
+	}
+	if card.ExpiresAt != nil && !card.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", utils.ErrValidation)
+	}
+	return nil
+}
+
+// newGiftCardCode генерирует случайный код карты вида GC-XXXX-XXXX-XXXX
+func newGiftCardCode() (string, error) {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate gift card code: %w", err)
+	}
+
+	var code strings.Builder
+	code.WriteString("GC")
+	for i, b := range random {
+		if i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(giftCardAlphabet[int(b)%len(giftCardAlphabet)])
+	}
+	return code.String(), nil
+}
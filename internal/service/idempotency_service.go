@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+)
+
+// IdempotencyRetention — сколько хранится ответ на запрос с Idempotency-Key
+const IdempotencyRetention = 24 * time.Hour
+
+// ErrIdempotencyKeyReused — ключ уже использован с другим телом запроса
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request body")
+
+type IdempotencyService struct {
+	repo dal.IdempotencyRepositoryInterface
+}
+
+func NewIdempotencyService(_repo dal.IdempotencyRepositoryInterface) IdempotencyService {
+	return IdempotencyService{repo: _repo}
+}
+
+// Begin блокирует ключ и возвращает сохранённый ответ, если запрос уже выполнялся.
+// release нужно вызвать после Complete (или при ошибке обработки).
+func (s IdempotencyService) Begin(ctx context.Context, key, endpoint string, body []byte) (*models.IdempotencyRecord, func(), error) {
+	if len(key) == 0 || len(key) > 255 {
+		return nil, nil, fmt.Errorf("idempotency key must be between 1 and 255 characters")
+	}
+
+	release, err := s.repo.Lock(ctx, endpoint+":"+key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record, err := s.repo.GetRecord(key, endpoint, IdempotencyRetention)
+	if err != nil {
+		if errors.Is(err, dal.ErrNotFound) {
+			return nil, release, nil
+		}
+		release()
+		return nil, nil, err
+	}
+
+	if record.RequestHash != RequestHash(body) {
+		release()
+		return nil, nil, ErrIdempotencyKeyReused
+	}
+	return &record, release, nil
+}
+
+// Complete сохраняет ответ, который вернут повторы запроса с этим ключом
+func (s IdempotencyService) Complete(key, endpoint string, body []byte, statusCode int, response []byte) error {
+	return s.repo.SaveRecord(models.IdempotencyRecord{
+		Key:          key,
+		Endpoint:     endpoint,
+		RequestHash:  RequestHash(body),
+		StatusCode:   statusCode,
+		ResponseBody: response,
+	}, IdempotencyRetention)
+}
+
+func RequestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 
@@ -14,8 +15,9 @@ type InventoryServiceInterface interface {
 	CreateInventory(Inventory models.InventoryItem) (models.InventoryItem, error)
 	GetAllInventory() ([]models.InventoryItem, error)
 	GetInventoryByID(id int) (models.InventoryItem, error)
-	DeleteInventoryItemByID(id int) error
-	UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem) (models.InventoryItem, error)
+	DeleteInventoryItemByID(id, version int) error
+	UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem, version int) (models.InventoryItem, error)
+	ProduceInventory(preparedID int, production models.InventoryProduction) (models.ProductionResult, error)
 	GetLeftovers(sortBy string, page, pageSize int) (map[string]interface{}, error)
 }
 
@@ -35,6 +37,13 @@ func (s InventoryService) CreateInventory(inventory models.InventoryItem) (model
 	if inventory.Name == "" || inventory.Quantity == 0 || inventory.Unit == "" {
 		return models.InventoryItem{}, errors.New("invalid request body")
 	}
+	if err := validateRecipe(0, inventory.Recipe); err != nil {
+		return models.InventoryItem{}, err
+	}
+	inventory, err := normalizeInventoryTags(inventory)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
 
 	newInventory, err := s.repository.AddInventory(inventory)
 	if err != nil {
@@ -60,16 +69,23 @@ func (s InventoryService) GetInventoryByID(id int) (models.InventoryItem, error)
 	return s.repository.GetInventoryItemByID(id)
 }
 
-func (h InventoryService) DeleteInventoryItemByID(id int) error {
-	return h.repository.DeleteInventoryItemByID(id)
+func (h InventoryService) DeleteInventoryItemByID(id, version int) error {
+	return h.repository.DeleteInventoryItemByID(id, version)
 }
 
-func (h InventoryService) UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem) (models.InventoryItem, error) {
+func (h InventoryService) UpdateInventoryItem(inventoryItemID int, changedInventoryItem models.InventoryItem, version int) (models.InventoryItem, error) {
 	if changedInventoryItem.Quantity < 0 {
 		return models.InventoryItem{}, errors.New("you can't pass a negative amount")
 	}
+	if err := validateRecipe(inventoryItemID, changedInventoryItem.Recipe); err != nil {
+		return models.InventoryItem{}, err
+	}
+	changedInventoryItem, err := normalizeInventoryTags(changedInventoryItem)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
 
-	return h.repository.UpdateInventoryItem(inventoryItemID, changedInventoryItem)
+	return h.repository.UpdateInventoryItem(inventoryItemID, changedInventoryItem, version)
 }
 
 func (h InventoryService) GetLeftovers(sortBy string, page, pageSize int) (map[string]interface{}, error) {
@@ -97,3 +113,48 @@ func (h InventoryService) GetLeftovers(sortBy string, page, pageSize int) (map[s
 	}
 	return response, nil
 }
+
+// ProduceInventory готовит партию заготовки из сырья по её рецепту
+func (h InventoryService) ProduceInventory(preparedID int, production models.InventoryProduction) (models.ProductionResult, error) {
+	if production.Quantity <= 0 || production.Quantity > 1000 {
+		return models.ProductionResult{}, fmt.Errorf("%w: quantity must be between 0 and 1000", utils.ErrValidation)
+	}
+	if len(production.Notes) > 200 {
+		return models.ProductionResult{}, fmt.Errorf("%w: notes are too long", utils.ErrValidation)
+	}
+
+	result, err := h.repository.ProduceInventory(preparedID, production)
+	if err != nil {
+		return models.ProductionResult{}, err
+	}
+	log.Printf("prepared ingredient produced: %d (+%g, remaining %g)", preparedID, production.Quantity, result.Remaining)
+	return result, nil
+}
+
+// normalizeInventoryTags проверяет аллергены и диеты ингредиента по models.Allergens и models.DietaryTags
+func normalizeInventoryTags(item models.InventoryItem) (models.InventoryItem, error) {
+	var err error
+	if item.Allergens, err = utils.NormalizeTags(item.Allergens, models.Allergens, "allergen"); err != nil {
+		return models.InventoryItem{}, err
+	}
+	if item.DietaryTags, err = utils.NormalizeTags(item.DietaryTags, models.DietaryTags, "dietary tag"); err != nil {
+		return models.InventoryItem{}, err
+	}
+	return item, nil
+}
+
+// validateRecipe проверяет рецепт заготовки preparedID (0 — новая позиция склада)
+func validateRecipe(preparedID int, recipe []models.MenuItemIngredient) error {
+	if len(recipe) == 0 {
+		return nil
+	}
+	if err := utils.ValidateIngredients(recipe); err != nil {
+		return fmt.Errorf("%w: invalid recipe: %v", utils.ErrValidation, err)
+	}
+	for _, ingredient := range recipe {
+		if ingredient.IngredientID == preparedID {
+			return fmt.Errorf("%w: recipe of ingredient %d cannot contain the ingredient itself", utils.ErrValidation, preparedID)
+		}
+	}
+	return nil
+}
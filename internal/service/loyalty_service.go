@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// ErrInsufficientPoints — у клиента не хватает баллов для оплаты
+var ErrInsufficientPoints = dal.ErrInsufficientPoints
+
+// LoyaltySettings — стоимость балла и срок его жизни (LOYALTY_POINT_VALUE и LOYALTY_POINTS_TTL)
+type LoyaltySettings struct {
+	PointValue float64       // сколько денег стоит один балл при оплате
+	PointsTTL  time.Duration // через сколько сгорают начисленные баллы; 0 — не сгорают
+}
+
+// pointsFor — сколько баллов нужно, чтобы оплатить amount (с округлением вверх)
+func (s LoyaltySettings) pointsFor(amount float64) int {
+	return int(math.Ceil(utils.RoundMoney(amount/s.PointValue*100) / 100))
+}
+
+type LoyaltyServiceInterface interface {
+	GetLoyaltyRules() ([]models.LoyaltyRule, error)
+	CreateLoyaltyRule(rule models.LoyaltyRule) (models.LoyaltyRule, error)
+	DeleteLoyaltyRule(id int) error
+	GetCustomerLoyalty(customerID int) (models.CustomerLoyalty, error)
+}
+
+type LoyaltyService struct {
+	loyaltyRepo dal.LoyaltyRepositoryInterface
+	settings    LoyaltySettings
+}
+
+func NewLoyaltyService(_loyaltyRepo dal.LoyaltyRepositoryInterface, _settings LoyaltySettings) LoyaltyService {
+	return LoyaltyService{loyaltyRepo: _loyaltyRepo, settings: _settings}
+}
+
+func (s LoyaltyService) GetLoyaltyRules() ([]models.LoyaltyRule, error) {
+	return s.loyaltyRepo.LoadLoyaltyRules()
+}
+
+func (s LoyaltyService) CreateLoyaltyRule(rule models.LoyaltyRule) (models.LoyaltyRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Category = strings.TrimSpace(rule.Category)
+	if err := validateLoyaltyRule(rule); err != nil {
+		return models.LoyaltyRule{}, err
+	}
+
+	newRule, err := s.loyaltyRepo.AddLoyaltyRule(rule)
+	if err != nil {
+		return models.LoyaltyRule{}, err
+	}
+	log.Printf("loyalty rule added: %d (%s)", newRule.ID, newRule.Name)
+	return newRule, nil
+}
+
+func (s LoyaltyService) DeleteLoyaltyRule(id int) error {
+	if err := s.loyaltyRepo.DeleteLoyaltyRule(id); err != nil {
+		return err
+	}
+	log.Printf("loyalty rule deleted: %d", id)
+	return nil
+}
+
+// GetCustomerLoyalty возвращает баланс баллов клиента, его стоимость и журнал
+func (s LoyaltyService) GetCustomerLoyalty(customerID int) (models.CustomerLoyalty, error) {
+	loyalty, err := s.loyaltyRepo.LoadLoyalty(customerID)
+	if err != nil {
+		return models.CustomerLoyalty{}, err
+	}
+	loyalty.PointValue = s.settings.PointValue
+	loyalty.BalanceValue = utils.RoundMoney(float64(max(loyalty.Balance, 0)) * s.settings.PointValue)
+	return loyalty, nil
+}
+
+// applyPointsDiscount превращает redeem_points заказа в скидку на весь заказ: после акций,
+// до налогов, распределяется по позициям как фиксированная скидка на заказ. Баллов
+// берётся не больше, чем нужно на остаток заказа. Здесь баланс клиента только
+// проверяется, а списываются баллы при закрытии заказа.
+func (s OrderService) applyPointsDiscount(order models.Order, lines []pricedLine) (models.Order, []pricedLine, error) {
+	if order.RedeemPoints == nil || *order.RedeemPoints == 0 {
+		order.RedeemPoints = nil
+		return order, lines, nil
+	}
+	points := *order.RedeemPoints
+	if points < 0 {
+		return models.Order{}, nil, fmt.Errorf("%w: redeem_points must be positive", utils.ErrValidation)
+	}
+	if order.CustomerID == 0 {
+		return models.Order{}, nil, fmt.Errorf("%w: redeem_points requires customer_id", utils.ErrValidation)
+	}
+
+	var rest float64
+	for _, line := range lines {
+		rest += line.Amount
+	}
+	points = min(points, s.loyalty.pointsFor(rest))
+	if points == 0 {
+		order.RedeemPoints = nil
+		return order, lines, nil
+	}
+	balance, err := s.loyaltyRepo.PointsBalance(order.CustomerID)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+	if balance < points {
+		return models.Order{}, nil, fmt.Errorf("%w: customer %d has %d points, %d needed", utils.ErrValidation, order.CustomerID, balance, points)
+	}
+
+	discounts := make([]float64, len(lines))
+	value := math.Min(utils.RoundMoney(float64(points)*s.loyalty.PointValue), rest)
+	orderDiscounts(models.Promotion{Type: models.PromotionFixed, Value: value}, lines, discounts)
+	amount := takeDiscounts(lines, discounts)
+	if amount == 0 {
+		order.RedeemPoints = nil
+		return order, lines, nil
+	}
+	order.Discounts = append(order.Discounts, models.OrderDiscount{Name: "Loyalty points", Amount: amount, Points: points})
+	order.DiscountAmount = utils.RoundMoney(order.DiscountAmount + amount)
+	order.RedeemPoints = &points
+	return order, lines, nil
+}
+
+func validateLoyaltyRule(rule models.LoyaltyRule) error {
+	if rule.Name == "" || len(rule.Name) > 100 {
+		return fmt.Errorf("%w: loyalty rule name must be between 1 and 100 characters", utils.ErrValidation)
+	}
+	if len(rule.Category) > 50 {
+		return fmt.Errorf("%w: category is too long", utils.ErrValidation)
+	}
+	if rule.Points <= 0 || rule.Points > 1000 {
+		return fmt.Errorf("%w: points must be between 0 and 1000", utils.ErrValidation)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
 	"frappuccino/internal/dal"
@@ -13,12 +14,19 @@ import (
 
 type MenuServiceInterface interface {
 	CreateMenuItem(menuItem models.MenuItem) (models.MenuItem, error)
-	GetAllMenuItems() ([]models.MenuItem, error)
+	GetAllMenuItems(filter models.MenuFilter) ([]models.MenuItem, error)
 	GetMenuItemByID(id int) (models.MenuItem, error)
-	DeleteMenuItemByID(id int) error
-	UpdateMenu(id int, changeMenu models.MenuItem) (models.MenuItem, error)
+	DeleteMenuItemByID(id, version int) error
+	UpdateMenu(id int, changeMenu models.MenuItem, version int) (models.MenuItem, error)
+	SetSoldOut(id int, soldOut bool) (models.MenuItem, error)
 }
 
+// ErrMenuItemInBundle — позиция входит в комбо-набор и не может быть удалена
+var ErrMenuItemInBundle = dal.ErrMenuItemInBundle
+
+// ErrVariantInUse — вариант указан в позициях заказов и не может быть удалён
+var ErrVariantInUse = dal.ErrVariantInUse
+
 type MenuService struct {
 	repository dal.MenuRepositoryInterface
 }
@@ -31,12 +39,27 @@ func (s MenuService) CreateMenuItem(menuItem models.MenuItem) (models.MenuItem,
 	if err := utils.ValidateMenuItem(menuItem); err != nil {
 		return models.MenuItem{}, err
 	}
+	if menuItem.TaxCategory == "" {
+		menuItem.TaxCategory = models.DefaultTaxCategory
+	}
+	for i := range menuItem.BundleSlots {
+		menuItem.BundleSlots[i] = withSlotDefaults(menuItem.BundleSlots[i])
+		if err := validateBundleSlot(menuItem.BundleSlots[i]); err != nil {
+			return models.MenuItem{}, err
+		}
+	}
+	if err := uniqueSlotNames(menuItem.BundleSlots); err != nil {
+		return models.MenuItem{}, err
+	}
 
 	newMenuItem, err := s.repository.AddMenuItem(menuItem)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key value") {
 			return models.MenuItem{}, errors.New("menu item with this name already exists")
 		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.MenuItem{}, fmt.Errorf("%w: unknown menu item in bundle slot", utils.ErrValidation)
+		}
 		return models.MenuItem{}, err
 	}
 
@@ -54,13 +77,54 @@ func (s MenuService) CreateMenuItem(menuItem models.MenuItem) (models.MenuItem,
 	return newMenuItem, nil
 }
 
-func (m MenuService) GetAllMenuItems() ([]models.MenuItem, error) {
+// GetAllMenuItems возвращает меню с доступностью по складу, аллергенами и диетами, отфильтрованное по filter
+func (m MenuService) GetAllMenuItems(filter models.MenuFilter) ([]models.MenuItem, error) {
+	var err error
+	if filter.ExcludeAllergens, err = utils.NormalizeTags(filter.ExcludeAllergens, models.Allergens, "allergen"); err != nil {
+		return nil, err
+	}
+	if filter.Diets, err = utils.NormalizeTags(filter.Diets, models.DietaryTags, "diet"); err != nil {
+		return nil, err
+	}
+
 	items, err := m.repository.LoadMenuItems()
 	if err != nil {
 		log.Printf("could not load menu items: %v", err)
 		return nil, fmt.Errorf("could not load menu items: %v", err)
 	}
-	return items, nil
+	if err := m.repository.FillAvailability(items); err != nil {
+		log.Printf("could not compute menu availability: %v", err)
+		return nil, fmt.Errorf("could not compute menu availability: %v", err)
+	}
+	if err := m.repository.FillDietary(items); err != nil {
+		log.Printf("could not compute menu allergens: %v", err)
+		return nil, fmt.Errorf("could not compute menu allergens: %v", err)
+	}
+
+	filtered := make([]models.MenuItem, 0, len(items))
+	for _, item := range items {
+		if matchesMenuFilter(item, filter) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+func matchesMenuFilter(item models.MenuItem, filter models.MenuFilter) bool {
+	if filter.OnlyAvailable && !*item.Available {
+		return false
+	}
+	for _, allergen := range filter.ExcludeAllergens {
+		if slices.Contains(item.Allergens, allergen) {
+			return false
+		}
+	}
+	for _, diet := range filter.Diets {
+		if !slices.Contains(item.DietaryTags, diet) {
+			return false
+		}
+	}
+	return true
 }
 
 func (m MenuService) GetMenuItemByID(id int) (models.MenuItem, error) {
@@ -68,17 +132,277 @@ func (m MenuService) GetMenuItemByID(id int) (models.MenuItem, error) {
 	// 	return models.MenuItem{}, fmt.Errorf("invalid menu ID: %v", err)
 	// }
 
-	return m.repository.GetMenuItemByID(id)
+	item, err := m.repository.GetMenuItemByID(id)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	items := []models.MenuItem{item}
+	if err := m.repository.FillAvailability(items); err != nil {
+		return models.MenuItem{}, fmt.Errorf("could not compute menu availability: %v", err)
+	}
+	if err := m.repository.FillDietary(items); err != nil {
+		return models.MenuItem{}, fmt.Errorf("could not compute menu allergens: %v", err)
+	}
+	return items[0], nil
+}
+
+// SetSoldOut вручную снимает позицию с продажи или возвращает её; новые заказы на неё не принимаются
+func (m MenuService) SetSoldOut(id int, soldOut bool) (models.MenuItem, error) {
+	if err := m.repository.SetSoldOut(id, soldOut); err != nil {
+		return models.MenuItem{}, err
+	}
+	log.Printf("menu item %d sold out: %t", id, soldOut)
+	return m.GetMenuItemByID(id)
 }
 
-func (m MenuService) DeleteMenuItemByID(id int) error {
+func (m MenuService) DeleteMenuItemByID(id, version int) error {
 	// if err := utils.ValidateID(id); err != nil {
 	// 	return fmt.Errorf("invalid menu ID: %v", err)
 	// }
 
-	return m.repository.DeleteMenuItemByID(id)
+	return m.repository.DeleteMenuItemByID(id, version)
 }
 
-func (m MenuService) UpdateMenu(id int, changeMenu models.MenuItem) (models.MenuItem, error) {
-	return m.repository.UpdateMenu(id, changeMenu)
+func (m MenuService) UpdateMenu(id int, changeMenu models.MenuItem, version int) (models.MenuItem, error) {
+	return m.repository.UpdateMenu(id, changeMenu, version)
+}
+
+func (m MenuService) GetVariants(menuItemID int) ([]models.MenuItemVariant, error) {
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return nil, err
+	}
+	return m.repository.LoadVariants(menuItemID)
+}
+
+func (m MenuService) GetVariant(menuItemID, variantID int) (models.MenuItemVariant, error) {
+	return m.repository.GetVariant(menuItemID, variantID)
+}
+
+func (m MenuService) CreateVariant(menuItemID int, variant models.MenuItemVariant) (models.MenuItemVariant, error) {
+	if err := validateVariant(variant); err != nil {
+		return models.MenuItemVariant{}, err
+	}
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return models.MenuItemVariant{}, err
+	}
+
+	variant.MenuItemID = menuItemID
+	newVariant, err := m.repository.AddVariant(variant)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.MenuItemVariant{}, fmt.Errorf("%w: menu item %d already has a %s variant", utils.ErrValidation, menuItemID, variant.Size)
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.MenuItemVariant{}, fmt.Errorf("%w: unknown ingredient in variant recipe", utils.ErrValidation)
+		}
+		return models.MenuItemVariant{}, err
+	}
+
+	log.Printf("menu item variant added: %d (menu item %d)", newVariant.ID, menuItemID)
+	return newVariant, nil
+}
+
+func (m MenuService) UpdateVariant(menuItemID, variantID int, variant models.MenuItemVariant) (models.MenuItemVariant, error) {
+	if err := validateVariant(variant); err != nil {
+		return models.MenuItemVariant{}, err
+	}
+
+	variant.ID = variantID
+	variant.MenuItemID = menuItemID
+	updated, err := m.repository.UpdateVariant(variant)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.MenuItemVariant{}, fmt.Errorf("%w: menu item %d already has a %s variant", utils.ErrValidation, menuItemID, variant.Size)
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.MenuItemVariant{}, fmt.Errorf("%w: unknown ingredient in variant recipe", utils.ErrValidation)
+		}
+		return models.MenuItemVariant{}, err
+	}
+	return updated, nil
+}
+
+func (m MenuService) DeleteVariant(menuItemID, variantID int) error {
+	return m.repository.DeleteVariant(menuItemID, variantID)
+}
+
+// validateVariant проверяет размер, цену и рецепт размерного варианта
+func validateVariant(variant models.MenuItemVariant) error {
+	switch variant.Size {
+	case "small", "medium", "large":
+	default:
+		return fmt.Errorf("%w: invalid size %q, expected small, medium or large", utils.ErrValidation, variant.Size)
+	}
+	if err := utils.ValidatePrice(variant.Price); err != nil {
+		return fmt.Errorf("%w: invalid price: %v", utils.ErrValidation, err)
+	}
+	if err := utils.ValidateIngredients(variant.Ingredients); err != nil {
+		return fmt.Errorf("%w: invalid ingredients: %v", utils.ErrValidation, err)
+	}
+	return nil
+}
+
+func (m MenuService) GetModifierGroups(menuItemID int) ([]models.ModifierGroup, error) {
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return nil, err
+	}
+	return m.repository.LoadModifierGroups(menuItemID)
+}
+
+func (m MenuService) CreateModifierGroup(menuItemID int, group models.ModifierGroup) (models.ModifierGroup, error) {
+	// обязательная группа требует хотя бы одного выбора
+	if group.Required && group.MinSelections == 0 {
+		group.MinSelections = 1
+	}
+	// без max_selections — один выбор, как DEFAULT 1 в БД (но не меньше min_selections)
+	if group.MaxSelections == 0 {
+		group.MaxSelections = max(group.MinSelections, 1)
+	}
+	if err := validateModifierGroup(group); err != nil {
+		return models.ModifierGroup{}, err
+	}
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return models.ModifierGroup{}, err
+	}
+
+	group.MenuItemID = menuItemID
+	newGroup, err := m.repository.AddModifierGroup(group)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.ModifierGroup{}, fmt.Errorf("%w: duplicate modifier group or modifier name", utils.ErrValidation)
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.ModifierGroup{}, fmt.Errorf("%w: unknown ingredient in modifier", utils.ErrValidation)
+		}
+		return models.ModifierGroup{}, err
+	}
+
+	log.Printf("modifier group added: %d (menu item %d)", newGroup.ID, menuItemID)
+	return newGroup, nil
+}
+
+func (m MenuService) DeleteModifierGroup(menuItemID, groupID int) error {
+	return m.repository.DeleteModifierGroup(menuItemID, groupID)
+}
+
+// validateModifierGroup проверяет правила выбора и модификаторы группы
+func validateModifierGroup(group models.ModifierGroup) error {
+	if strings.TrimSpace(group.Name) == "" {
+		return fmt.Errorf("%w: modifier group name cannot be empty", utils.ErrValidation)
+	}
+	if len(group.Modifiers) == 0 {
+		return fmt.Errorf("%w: modifier group must contain at least one modifier", utils.ErrValidation)
+	}
+	if group.MinSelections < 0 || group.MaxSelections < 1 || group.MinSelections > group.MaxSelections {
+		return fmt.Errorf("%w: invalid selection limits %d..%d", utils.ErrValidation, group.MinSelections, group.MaxSelections)
+	}
+	if group.MinSelections > len(group.Modifiers) {
+		return fmt.Errorf("%w: min_selections exceeds the number of modifiers", utils.ErrValidation)
+	}
+
+	for _, modifier := range group.Modifiers {
+		if strings.TrimSpace(modifier.Name) == "" {
+			return fmt.Errorf("%w: modifier name cannot be empty", utils.ErrValidation)
+		}
+		if modifier.IngredientID < 0 || modifier.Quantity < 0 {
+			return fmt.Errorf("%w: invalid ingredient consumption for modifier %q", utils.ErrValidation, modifier.Name)
+		}
+		if modifier.IngredientID > 0 && modifier.Quantity == 0 {
+			return fmt.Errorf("%w: modifier %q must consume a positive quantity of ingredient %d", utils.ErrValidation, modifier.Name, modifier.IngredientID)
+		}
+	}
+	return nil
+}
+
+func (m MenuService) GetBundleSlots(menuItemID int) ([]models.BundleSlot, error) {
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return nil, err
+	}
+	return m.repository.LoadBundleSlots(menuItemID)
+}
+
+// CreateBundleSlot добавляет слот в позицию меню — позиция с хотя бы одним слотом становится комбо-набором
+func (m MenuService) CreateBundleSlot(menuItemID int, slot models.BundleSlot) (models.BundleSlot, error) {
+	slot = withSlotDefaults(slot)
+	if err := validateBundleSlot(slot); err != nil {
+		return models.BundleSlot{}, err
+	}
+	if slot.ProductID == menuItemID {
+		return models.BundleSlot{}, fmt.Errorf("%w: bundle cannot contain itself", utils.ErrValidation)
+	}
+	for _, choice := range slot.Choices {
+		if choice.ProductID == menuItemID {
+			return models.BundleSlot{}, fmt.Errorf("%w: bundle cannot contain itself", utils.ErrValidation)
+		}
+	}
+	if _, err := m.repository.GetMenuItemByID(menuItemID); err != nil {
+		return models.BundleSlot{}, err
+	}
+
+	slot.BundleID = menuItemID
+	newSlot, err := m.repository.AddBundleSlot(slot)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.BundleSlot{}, fmt.Errorf("%w: bundle %d already has a slot named %q", utils.ErrValidation, menuItemID, slot.Name)
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return models.BundleSlot{}, fmt.Errorf("%w: unknown menu item in bundle slot", utils.ErrValidation)
+		}
+		return models.BundleSlot{}, err
+	}
+
+	log.Printf("bundle slot added: %d (menu item %d)", newSlot.ID, menuItemID)
+	return newSlot, nil
+}
+
+func (m MenuService) DeleteBundleSlot(menuItemID, slotID int) error {
+	return m.repository.DeleteBundleSlot(menuItemID, slotID)
+}
+
+// withSlotDefaults: без quantity в слоте одна штука позиции
+func withSlotDefaults(slot models.BundleSlot) models.BundleSlot {
+	if slot.Quantity == 0 {
+		slot.Quantity = 1
+	}
+	return slot
+}
+
+// validateBundleSlot проверяет позицию слота, количество и замены на выбор гостя
+func validateBundleSlot(slot models.BundleSlot) error {
+	name := strings.TrimSpace(slot.Name)
+	if name == "" || len(name) > 50 {
+		return fmt.Errorf("%w: bundle slot name must be 1-50 characters", utils.ErrValidation)
+	}
+	if slot.ProductID <= 0 {
+		return fmt.Errorf("%w: bundle slot %q needs a product_id", utils.ErrValidation, slot.Name)
+	}
+	if slot.Quantity < 1 || slot.Quantity > 10 {
+		return fmt.Errorf("%w: bundle slot %q quantity must be between 1 and 10", utils.ErrValidation, slot.Name)
+	}
+
+	seen := map[int]bool{slot.ProductID: true}
+	for _, choice := range slot.Choices {
+		if choice.ProductID <= 0 {
+			return fmt.Errorf("%w: invalid choice product_id in bundle slot %q", utils.ErrValidation, slot.Name)
+		}
+		if seen[choice.ProductID] {
+			return fmt.Errorf("%w: product %d is listed more than once in bundle slot %q", utils.ErrValidation, choice.ProductID, slot.Name)
+		}
+		seen[choice.ProductID] = true
+		if choice.PriceDelta < 0 || choice.PriceDelta != utils.RoundMoney(choice.PriceDelta) {
+			return fmt.Errorf("%w: price_delta of product %d in bundle slot %q must be a non-negative amount", utils.ErrValidation, choice.ProductID, slot.Name)
+		}
+	}
+	return nil
+}
+
+func uniqueSlotNames(slots []models.BundleSlot) error {
+	seen := make(map[string]bool, len(slots))
+	for _, slot := range slots {
+		if seen[slot.Name] {
+			return fmt.Errorf("%w: duplicate bundle slot name %q", utils.ErrValidation, slot.Name)
+		}
+		seen[slot.Name] = true
+	}
+	return nil
 }
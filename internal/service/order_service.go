@@ -1,9 +1,14 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
+	"math"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,31 +21,141 @@ type OrderServiceInterface interface {
 	CreateOrder(order models.Order) (models.Order, error)
 	GetAllOrders() ([]models.Order, error)
 	GetOrderByID(id int) (models.Order, error)
-	DeleteOrder(id int) error
-	UpdateOrder(id int) (models.Order, error)
-	CloseOrder(id int) (models.Order, []struct {
-		IngredientID int     `json:"ingredient_id"`
-		Name         string  `json:"name"`
-		QuantityUsed float64 `json:"quantity_used"`
-		Remaining    float64 `json:"remaining"`
-	}, error)
+	DeleteOrder(id, version int) error
+	UpdateOrder(id int, changeOrder models.Order, version int) (models.Order, error)
+	StartOrder(id int, change models.OrderStatusChange) (models.Order, error)
+	ReadyOrder(id int, change models.OrderStatusChange) (models.Order, error)
+	CancelOrder(id int, change models.OrderStatusChange) (models.Order, error)
+	ReopenOrder(id int, change models.OrderStatusChange) (models.Order, error)
+	CloseOrder(id int, change models.OrderStatusChange) (models.Order, []models.InventoryUpdate, error)
 	GetNumberOfOrderedItems(startDate, endDate string) (map[string]int, error)
+	GetOrderHistory(id int) (models.OrderStatusHistory, error)
+	AddOrderItem(orderID int, item models.OrderItem) (models.Order, error)
+	UpdateOrderItem(orderID, productID, itemID int, patch models.OrderItemPatch, version int) (models.Order, error)
+	RemoveOrderItem(orderID, productID, itemID, version int) (models.Order, error)
+}
+
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// ErrOrderStatusChanged — заказ успел сменить статус параллельным запросом
+var ErrOrderStatusChanged = dal.ErrOrderStatusChanged
+
+// ErrNotFound — заказ или запись справочника не найдены
+var ErrNotFound = dal.ErrNotFound
+
+// ErrOrderNotPaid — заказ нельзя закрыть, пока он не оплачен полностью
+var ErrOrderNotPaid = dal.ErrOrderNotPaid
+
+// ErrBatchPaymentRejected — оплата заказа из пакета не принята, заказ отклонён
+var ErrBatchPaymentRejected = dal.ErrBatchPaymentRejected
+
+// ErrVersionMismatch — запись изменилась после чтения клиентом (If-Match не совпал)
+var ErrVersionMismatch = dal.ErrVersionMismatch
+
+var ErrOrderNotEditable = dal.ErrOrderNotEditable
+
+// ErrItemSoldOut — позиция (или выбранный компонент набора) снята с продажи вручную
+var ErrItemSoldOut = errors.New("menu item is sold out")
+
+// InsufficientStockError — ошибка DAL о нехватке ингредиента, доступная обработчикам
+type InsufficientStockError = dal.InsufficientStockError
+
+// orderTransitions — допустимые переходы статусов заказа.
+// Основной путь: open → in_progress → ready → closed; заказ «на вынос»
+// можно закрыть сразу из open (так работает batch-process).
+var orderTransitions = map[string][]string{
+	models.OrderStatusOpen:       {models.OrderStatusInProgress, models.OrderStatusClosed, models.OrderStatusCancelled},
+	models.OrderStatusInProgress: {models.OrderStatusReady, models.OrderStatusCancelled},
+	models.OrderStatusReady:      {models.OrderStatusClosed, models.OrderStatusCancelled},
+	models.OrderStatusClosed:     {models.OrderStatusRefunded},
+	models.OrderStatusCancelled:  {models.OrderStatusOpen},
+	models.OrderStatusRefunded:   {},
+}
+
+// Примечания по умолчанию для истории статусов
+var defaultTransitionNotes = map[string]string{
+	models.OrderStatusOpen:       "Order reopened",
+	models.OrderStatusInProgress: "Order started",
+	models.OrderStatusReady:      "Order ready",
+	models.OrderStatusClosed:     "Order completed",
+	models.OrderStatusCancelled:  "Order cancelled",
+	models.OrderStatusRefunded:   "Order refunded",
+}
+
+// CanTransition сообщает, разрешён ли переход из статуса from в статус to
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
 }
 
 type OrderService struct {
 	orderRepo dal.OrderRepository
 	menuRepo  dal.MenuRepository
+	taxRepo   dal.TaxRepository
+	// promotionRepo — акции и промокоды для скидок
+	promotionRepo dal.PromotionRepository
+	// pricingRuleRepo — правила цены по времени; location — часовой пояс кофейни
+	pricingRuleRepo dal.PricingRuleRepository
+	location        *time.Location
+	// customerRepo — постоянные клиенты, на которых ссылаются заказы
+	customerRepo dal.CustomerRepository
+	// loyalty — стоимость и срок баллов; loyaltyRepo — баланс для скидки баллами
+	loyalty     LoyaltySettings
+	loyaltyRepo dal.LoyaltyRepository
+	// requireFullPayment — закрывать заказ только после полной оплаты
+	requireFullPayment bool
+	taxSettings        TaxSettings
 }
 
-func NewOrderService(_orderRepo dal.OrderRepository, _menuRepo dal.MenuRepository) OrderService {
+func NewOrderService(_orderRepo dal.OrderRepository, _menuRepo dal.MenuRepository, _taxRepo dal.TaxRepository,
+	_promotionRepo dal.PromotionRepository, _pricingRuleRepo dal.PricingRuleRepository, _location *time.Location,
+	_customerRepo dal.CustomerRepository, _loyalty LoyaltySettings, _loyaltyRepo dal.LoyaltyRepository, _requireFullPayment bool,
+	_taxSettings TaxSettings,
+) OrderService {
 	return OrderService{
-		orderRepo: _orderRepo,
-		menuRepo:  _menuRepo,
+		orderRepo:          _orderRepo,
+		menuRepo:           _menuRepo,
+		taxRepo:            _taxRepo,
+		promotionRepo:      _promotionRepo,
+		pricingRuleRepo:    _pricingRuleRepo,
+		location:           _location,
+		customerRepo:       _customerRepo,
+		loyalty:            _loyalty,
+		loyaltyRepo:        _loyaltyRepo,
+		requireFullPayment: _requireFullPayment,
+		taxSettings:        _taxSettings,
 	}
 }
 
 // Method of creating a new order
 func (s OrderService) CreateOrder(order models.Order) (models.Order, error) {
+	if len(order.Payments) > 0 {
+		return models.Order{}, fmt.Errorf("%w: payments are recorded with POST /orders/{id}/payments", utils.ErrValidation)
+	}
+	order, err := s.prepareOrder(order)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	newOrder, err := s.orderRepo.AddOrder(order)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("error creating order: %w", err)
+	}
+
+	log.Printf("order added: %d", newOrder.ID)
+	return newOrder, nil
+}
+
+// prepareOrder проверяет новый заказ и считает его сумму по текущему меню
+func (s OrderService) prepareOrder(order models.Order) (models.Order, error) {
+	order, err := s.linkCustomer(order)
+	if err != nil {
+		return models.Order{}, err
+	}
 	if err := utils.IsValidName(order.CustomerName); err != nil {
 		return models.Order{}, err
 	}
@@ -50,7 +165,8 @@ func (s OrderService) CreateOrder(order models.Order) (models.Order, error) {
 	}
 
 	// Checking that all products exist on the menu
-	for _, product := range order.Items {
+	for i, product := range order.Items {
+		order.Items[i].ID = 0 // ID позиций назначает база
 		exists, err := s.menuRepo.ProductExists(product.ProductID)
 		if err != nil {
 			return models.Order{}, err
@@ -59,21 +175,25 @@ func (s OrderService) CreateOrder(order models.Order) (models.Order, error) {
 			return models.Order{}, fmt.Errorf("product with ID %d not found", product.ProductID)
 		}
 	}
+	if err := s.checkSoldOut(order.Items...); err != nil {
+		return models.Order{}, err
+	}
+
+	if order.OrderType == "" {
+		order.OrderType = models.OrderTypeDineIn
+	}
 
 	// Calculating the total amount of the order
-	totalAmount, err := s.TotalAmount(order)
+	order.Discounts = nil
+	order, err = s.PriceOrder(order, nil)
 	if err != nil {
 		return models.Order{}, err
 	}
-	order.TotalAmount = totalAmount
-
-	newOrder, err := s.orderRepo.AddOrder(order)
-	if err != nil {
-		return models.Order{}, fmt.Errorf("error creating order: %w", err)
+	if err := checkPromoCode(order); err != nil {
+		return models.Order{}, err
 	}
 
-	log.Printf("order added: %d", newOrder.ID)
-	return newOrder, nil
+	return order, nil
 }
 
 func (s OrderService) GetAllOrders() ([]models.Order, error) {
@@ -94,17 +214,33 @@ func (s OrderService) GetOrderByID(id int) (models.Order, error) {
 	return order, nil
 }
 
-func (s OrderService) DeleteOrder(id int) error {
-	err := s.orderRepo.DeleteOrderByID(id)
+// DeleteOrder удаляет заказ; version — значение If-Match (0 — без проверки)
+func (s OrderService) DeleteOrder(id, version int) error {
+	err := s.orderRepo.DeleteOrderByID(id, version)
 	if err != nil {
 		slog.Warn("Failed to delete order", "orderID", id, "error", err)
-		return fmt.Errorf("failed to delete order with ID %d: %v", id, err)
+		return fmt.Errorf("failed to delete order with ID %d: %w", id, err)
 	}
 
 	return nil
 }
 
-func (s OrderService) UpdateOrder(id int, changeOrder models.Order) (models.Order, error) {
+// UpdateOrder обновляет заказ; version — значение If-Match (0 — без проверки)
+func (s OrderService) UpdateOrder(id int, changeOrder models.Order, version int) (models.Order, error) {
+	// Без списка позиций состав заказа не меняется, без order_type, promo_code и customer_id — тип заказа,
+	// промокод и клиент, без redeem_points — скидка баллами. Купон снимается явно — remove_promo_code
+	current, err := s.orderRepo.LoadOrder(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if changeOrder.CustomerID == 0 {
+		changeOrder.CustomerID = current.CustomerID
+	}
+	changeOrder, err = s.linkCustomer(changeOrder)
+	if err != nil {
+		return models.Order{}, err
+	}
+
 	if err := utils.IsValidName(changeOrder.CustomerName); err != nil {
 		return models.Order{}, err
 	}
@@ -113,6 +249,25 @@ func (s OrderService) UpdateOrder(id int, changeOrder models.Order) (models.Orde
 		return models.Order{}, err
 	}
 
+	if len(changeOrder.Items) == 0 {
+		changeOrder.Items = slices.Clone(current.Items)
+	}
+	if changeOrder.OrderType == "" {
+		changeOrder.OrderType = current.OrderType
+	}
+	newPromoCode := changeOrder.PromoCode != ""
+	if !newPromoCode {
+		changeOrder.PromoCode = current.PromoCode
+	}
+	changeOrder.Discounts = current.Discounts
+	if changeOrder.RemovePromoCode {
+		changeOrder.PromoCode = ""
+		newPromoCode = false
+	}
+	if changeOrder.RedeemPoints == nil {
+		changeOrder.RedeemPoints = current.RedeemPoints
+	}
+
 	// Checking that all products exist on the menu
 	for _, product := range changeOrder.Items {
 		exists, err := s.menuRepo.ProductExists(product.ProductID)
@@ -124,28 +279,235 @@ func (s OrderService) UpdateOrder(id int, changeOrder models.Order) (models.Orde
 		}
 	}
 
+	if err := s.checkSoldOut(changedLines(changeOrder.Items, current.Items)...); err != nil {
+		return models.Order{}, err
+	}
+
 	// Calculating the total amount of the order
-	totalAmount, err := s.TotalAmount(changeOrder)
+	changeOrder, err = s.PriceOrder(changeOrder, &current)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if newPromoCode {
+		if err := checkPromoCode(changeOrder); err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	order, err := s.orderRepo.UpdateOrder(id, changeOrder, version)
 	if err != nil {
 		return models.Order{}, err
 	}
-	changeOrder.TotalAmount = totalAmount
+	return order, nil
+}
+
+func (s OrderService) StartOrder(id int, change models.OrderStatusChange) (models.Order, error) {
+	return s.changeStatus(id, models.OrderStatusInProgress, change)
+}
+
+func (s OrderService) ReadyOrder(id int, change models.OrderStatusChange) (models.Order, error) {
+	return s.changeStatus(id, models.OrderStatusReady, change)
+}
+
+func (s OrderService) CancelOrder(id int, change models.OrderStatusChange) (models.Order, error) {
+	return s.changeStatus(id, models.OrderStatusCancelled, change)
+}
 
-	order, err := s.orderRepo.UpdateOrder(id, changeOrder)
+func (s OrderService) ReopenOrder(id int, change models.OrderStatusChange) (models.Order, error) {
+	return s.changeStatus(id, models.OrderStatusOpen, change)
+}
+
+// checkTransition загружает заказ и проверяет, можно ли перевести его в статус to
+func (s OrderService) checkTransition(id int, to string, change *models.OrderStatusChange) (models.Order, error) {
+	order, err := s.orderRepo.LoadOrder(id)
 	if err != nil {
 		return models.Order{}, err
 	}
+
+	if !CanTransition(order.Status, to) {
+		return models.Order{}, fmt.Errorf("%w: order %d cannot move from %s to %s", ErrInvalidTransition, id, order.Status, to)
+	}
+
+	if change.Notes == "" {
+		change.Notes = defaultTransitionNotes[to]
+	}
 	return order, nil
 }
 
-func (s OrderService) CloseOrder(id int) (models.Order, []struct {
-	IngredientID int     `json:"ingredient_id"`
-	Name         string  `json:"name"`
-	QuantityUsed float64 `json:"quantity_used"`
-	Remaining    float64 `json:"remaining"`
-}, error,
+func (s OrderService) changeStatus(id int, to string, change models.OrderStatusChange) (models.Order, error) {
+	order, err := s.checkTransition(id, to, &change)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	updated, err := s.orderRepo.UpdateOrderStatus(id, order.Status, to, change)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	slog.Info("Order status changed", "orderID", id, "from", order.Status, "to", to, "actor", change.Actor)
+	return updated, nil
+}
+
+// AddOrderItem добавляет позицию в заказ. Если такой же продукт того же
+// размерного варианта с теми же кастомизациями уже есть, количество суммируется.
+func (s OrderService) AddOrderItem(orderID int, item models.OrderItem) (models.Order, error) {
+	if err := validateItemQuantity(item.Quantity); err != nil {
+		return models.Order{}, err
+	}
+
+	exists, err := s.menuRepo.ProductExists(item.ProductID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !exists {
+		return models.Order{}, fmt.Errorf("%w: product with ID %d not found", utils.ErrValidation, item.ProductID)
+	}
+	if err := s.resolveSize(&item); err != nil {
+		return models.Order{}, err
+	}
+
+	return s.editOrderItems(orderID, 0, func(items []models.OrderItem) ([]models.OrderItem, error) {
+		for i := range items {
+			if items[i].ProductID == item.ProductID && items[i].VariantID == item.VariantID &&
+				sameCustomizations(items[i].Customizations, item.Customizations) {
+				items[i].Quantity += item.Quantity
+				return items, nil
+			}
+		}
+		return append(items, models.OrderItem{
+			ProductID:      item.ProductID,
+			VariantID:      item.VariantID,
+			Quantity:       item.Quantity,
+			Customizations: item.Customizations,
+		}), nil
+	})
+}
+
+// UpdateOrderItem меняет количество, размерный вариант и/или кастомизации позиции
+// с продуктом productID; itemID выбирает позицию, если их несколько (0 — не указан),
+// version — значение If-Match
+func (s OrderService) UpdateOrderItem(orderID, productID, itemID int, patch models.OrderItemPatch, version int) (models.Order, error) {
+	if patch.Quantity != nil {
+		if err := validateItemQuantity(*patch.Quantity); err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	return s.editOrderItems(orderID, version, func(items []models.OrderItem) ([]models.OrderItem, error) {
+		i, err := findOrderLine(items, orderID, productID, itemID)
+		if err != nil {
+			return nil, err
+		}
+		if patch.Quantity != nil {
+			items[i].Quantity = *patch.Quantity
+		}
+		if patch.VariantID != nil {
+			items[i].VariantID = *patch.VariantID
+		}
+		if patch.Customizations != nil {
+			items[i].Customizations = *patch.Customizations
+		}
+		return items, nil
+	})
+}
+
+// RemoveOrderItem удаляет позицию с продуктом productID (itemID и version — как в UpdateOrderItem)
+func (s OrderService) RemoveOrderItem(orderID, productID, itemID, version int) (models.Order, error) {
+	return s.editOrderItems(orderID, version, func(items []models.OrderItem) ([]models.OrderItem, error) {
+		i, err := findOrderLine(items, orderID, productID, itemID)
+		if err != nil {
+			return nil, err
+		}
+		return append(items[:i], items[i+1:]...), nil
+	})
+}
+
+// findOrderLine ищет позицию продукта productID. Без itemID продукт должен
+// встречаться в заказе ровно один раз.
+func findOrderLine(items []models.OrderItem, orderID, productID, itemID int) (int, error) {
+	found := -1
+	for i, item := range items {
+		if item.ProductID != productID || (itemID != 0 && item.ID != itemID) {
+			continue
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("%w: product %d has several lines in order %d, choose one with item_id", utils.ErrValidation, productID, orderID)
+		}
+		found = i
+	}
+	if found < 0 {
+		if itemID != 0 {
+			return 0, fmt.Errorf("item %d with product %d not found in order %d", itemID, productID, orderID)
+		}
+		return 0, fmt.Errorf("product with ID %d not found in order %d", productID, orderID)
+	}
+	return found, nil
+}
+
+// editOrderItems применяет изменение к позициям заказа, пересчитывает цены
+// по текущему меню и сохраняет результат; version — ожидаемая версия заказа (0 — без проверки)
+func (s OrderService) editOrderItems(orderID, version int, edit func(items []models.OrderItem) ([]models.OrderItem, error)) (models.Order, error) {
+	order, err := s.orderRepo.LoadOrder(orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if version != 0 && order.Version != version {
+		return models.Order{}, fmt.Errorf("%w: order %d is at version %d", ErrVersionMismatch, orderID, order.Version)
+	}
+	if isFinalStatus(order.Status) {
+		return models.Order{}, fmt.Errorf("%w: order %d is %s", ErrOrderNotEditable, orderID, order.Status)
+	}
+
+	current := order
+	current.Items = slices.Clone(order.Items)
+	items, err := edit(order.Items)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order.Items = items
+	if err := s.checkSoldOut(changedLines(order.Items, current.Items)...); err != nil {
+		return models.Order{}, err
+	}
+
+	order, err = s.PriceOrder(order, &current)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	updated, err := s.orderRepo.ReplaceOrderItems(orderID, order.Status, order)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	log.Printf("order items updated: %d", orderID)
+	return updated, nil
+}
+
+// sameCustomizations сравнивает кастомизации по их JSON-представлению
+func sameCustomizations(a, b models.OrderItemCustomizations) bool {
+	// Состав набора заполняет сервер, клиент может прислать его обратно или опустить
+	a.BundleComponents, b.BundleComponents = nil, nil
+	first, errA := json.Marshal(a)
+	second, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(first) == string(second)
+}
+
+func validateItemQuantity(quantity float64) error {
+	if quantity <= 0 || quantity != math.Trunc(quantity) {
+		return fmt.Errorf("%w: quantity must be a positive whole number", utils.ErrValidation)
+	}
+	return nil
+}
+
+func (s OrderService) CloseOrder(id int, change models.OrderStatusChange) (models.Order, []models.InventoryUpdate, error,
 ) {
-	order, inventoryUpdates, err := s.orderRepo.CloseOrder(id)
+	order, err := s.checkTransition(id, models.OrderStatusClosed, &change)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	order, inventoryUpdates, err := s.orderRepo.CloseOrder(id, order.Status, change, s.requireFullPayment, s.loyalty.PointsTTL)
 	if err != nil {
 		return models.Order{}, nil, err
 	}
@@ -183,92 +545,612 @@ func (s OrderService) GetNumberOfOrderedItems(startDate, endDate string) (map[st
 	return orderedItems, nil
 }
 
-func (s OrderService) TotalAmount(order models.Order) (float64, error) {
-	// Calculating the total amount of the order
-	totalAmount := 0.0
-	for i, product := range order.Items {
-		price, err := s.menuRepo.GetProductPrice(product.ProductID)
+// GetOrderHistory возвращает переходы статусов заказа с длительностью каждого этапа
+func (s OrderService) GetOrderHistory(id int) (models.OrderStatusHistory, error) {
+	order, err := s.orderRepo.LoadOrder(id)
+	if err != nil {
+		return models.OrderStatusHistory{}, err
+	}
+
+	entries, err := s.orderRepo.LoadStatusHistory(id)
+	if err != nil {
+		return models.OrderStatusHistory{}, err
+	}
+
+	result := models.OrderStatusHistory{
+		OrderID:      order.ID,
+		Status:       order.Status,
+		History:      []models.OrderStatusHistoryEntry{},
+		TimeInStatus: make(map[string]float64),
+	}
+
+	now := time.Now()
+	for i := range entries {
+		// Последний статус длится до текущего момента, если заказ ещё в работе
+		var end time.Time
+		if i+1 < len(entries) {
+			end = entries[i+1].ChangedAt
+		} else if !isFinalStatus(entries[i].Status) {
+			end = now
+		} else {
+			end = entries[i].ChangedAt
+		}
+
+		entries[i].DurationSeconds = end.Sub(entries[i].ChangedAt).Seconds()
+		result.TimeInStatus[entries[i].Status] += entries[i].DurationSeconds
+	}
+	if entries != nil {
+		result.History = entries
+	}
+
+	if timeToClose, ok := TimeToClose(entries); ok {
+		seconds := timeToClose.Seconds()
+		result.TimeToCloseSeconds = &seconds
+	}
+
+	return result, nil
+}
+
+// TimeToClose считает время от первой записи истории до закрытия заказа.
+// Второе значение false, если заказ ещё не закрывался.
+func TimeToClose(history []models.OrderStatusHistoryEntry) (time.Duration, bool) {
+	if len(history) == 0 {
+		return 0, false
+	}
+
+	for _, entry := range history {
+		if entry.Status == models.OrderStatusClosed {
+			return entry.ChangedAt.Sub(history[0].ChangedAt), true
+		}
+	}
+	return 0, false
+}
+
+func isFinalStatus(status string) bool {
+	return status == models.OrderStatusClosed || status == models.OrderStatusCancelled || status == models.OrderStatusRefunded
+}
+
+// PriceOrder считает цены позиций по текущему меню, подытог, скидки по акциям
+// и промокоду, налоги по налоговым категориям позиций и типу заказа и итог к оплате.
+// current — заказ до правки (nil для нового заказа): позиции, которых правка не коснулась,
+// сохраняют прежнюю цену и правило цены, а уже принятый промокод не перепроверяется
+// по сроку действия и лимиту.
+func (s OrderService) PriceOrder(order models.Order, current *models.Order) (models.Order, error) {
+	if err := validateOrderType(order.OrderType); err != nil {
+		return models.Order{}, err
+	}
+	order.PromoCode = strings.ToUpper(strings.TrimSpace(order.PromoCode))
+
+	rates, err := s.taxRepo.LoadTaxRates()
+	if err != nil {
+		return models.Order{}, err
+	}
+	now := time.Now().In(s.location)
+	var currentItems []models.OrderItem
+	couponAccepted := false
+	if current != nil {
+		currentItems = current.Items
+		couponAccepted = order.PromoCode != "" && order.PromoCode == current.PromoCode
+	}
+	promotions, err := s.eligiblePromotions(order.PromoCode, couponAccepted, now, order.Discounts)
+	if err != nil {
+		return models.Order{}, err
+	}
+	rules, err := s.pricingRuleRepo.LoadPricingRules()
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	lines := make([]pricedLine, 0, len(order.Items))
+	var subtotal float64
+	for i := range order.Items {
+		if err := s.resolveSize(&order.Items[i]); err != nil {
+			return models.Order{}, err
+		}
+		product := order.Items[i]
+		categories, err := s.menuRepo.GetProductCategories(product.ProductID)
+		if err != nil {
+			return models.Order{}, err
+		}
+		if line, ok := unchangedLine(product, currentItems); ok {
+			order.Items[i].Price = line.Price
+			order.Items[i].PricingRuleID, order.Items[i].PricingRule = line.PricingRuleID, line.PricingRule
+			order.Items[i].PricedAt = line.PricedAt
+			order.Items[i].Customizations.BundleComponents = line.Customizations.BundleComponents
+		} else {
+			rule := pricingRuleFor(rules, product.ProductID, categories, now)
+			price, err := s.unitPrice(product, rule)
+			if err != nil {
+				return models.Order{}, err
+			}
+			order.Items[i].Price = price
+			order.Items[i].PricedAt = now
+			if order.Items[i].Customizations.BundleComponents, err = s.bundleComponents(product); err != nil {
+				return models.Order{}, err
+			}
+			order.Items[i].PricingRuleID, order.Items[i].PricingRule = 0, ""
+			if rule != nil {
+				order.Items[i].PricingRuleID, order.Items[i].PricingRule = rule.ID, rule.Name
+			}
+		}
+		price := order.Items[i].Price
+
+		taxCategory, err := s.menuRepo.GetProductTaxCategory(product.ProductID)
+		if err != nil {
+			return models.Order{}, err
+		}
+
+		amount := utils.RoundMoney(price * product.Quantity)
+		subtotal += amount
+		lines = append(lines, pricedLine{
+			ProductID: product.ProductID, Categories: categories, TaxCategory: taxCategory, Quantity: product.Quantity, Amount: amount,
+			TaxShares: bundleTaxShares(order.Items[i].Customizations.BundleComponents),
+		})
+	}
+	order.Subtotal = utils.RoundMoney(subtotal)
+
+	order, lines = applyDiscounts(order, lines, promotions)
+	order, lines, err = s.applyPointsDiscount(order, lines)
+	if err != nil {
+		return models.Order{}, err
+	}
+	return applyTaxes(order, lines, rates, s.taxSettings), nil
+}
+
+// unchangedLine ищет в current ту же позицию (item_id, продукт, вариант, количество
+// и кастомизации). Такую позицию правка не затронула, и её не пересчитывают:
+// цена и правило цены остаются прежними, а правила групп модификаторов,
+// изменённые после заказа, к ней не применяются.
+func unchangedLine(item models.OrderItem, current []models.OrderItem) (models.OrderItem, bool) {
+	if item.ID == 0 {
+		return models.OrderItem{}, false
+	}
+	for _, line := range current {
+		if line.ID == item.ID && line.ProductID == item.ProductID && line.VariantID == item.VariantID &&
+			line.Quantity == item.Quantity && sameCustomizations(line.Customizations, item.Customizations) {
+			return line, true
+		}
+	}
+	return models.OrderItem{}, false
+}
+
+// changedLines — новые и изменённые позиции items. Снятие с продажи проверяется только
+// для них: позиции, которых правка не коснулась, уже приняты в заказ.
+func changedLines(items, current []models.OrderItem) []models.OrderItem {
+	var changed []models.OrderItem
+	for _, item := range items {
+		if _, ok := unchangedLine(item, current); !ok {
+			changed = append(changed, item)
+		}
+	}
+	return changed
+}
+
+// linkCustomer проверяет, что клиент заказа существует. Заказ без customer_name
+// получает имя клиента; гость (без customer_id) указывает только имя.
+func (s OrderService) linkCustomer(order models.Order) (models.Order, error) {
+	if order.CustomerID == 0 {
+		return order, nil
+	}
+	if order.CustomerID < 0 {
+		return models.Order{}, fmt.Errorf("%w: invalid customer_id", utils.ErrValidation)
+	}
+
+	customer, err := s.customerRepo.GetCustomer(order.CustomerID)
+	if err != nil {
+		if errors.Is(err, dal.ErrNotFound) {
+			return models.Order{}, fmt.Errorf("%w: customer %d not found", utils.ErrValidation, order.CustomerID)
+		}
+		return models.Order{}, err
+	}
+	if order.CustomerName == "" {
+		order.CustomerName = customer.Name
+	}
+	return order, nil
+}
+
+// checkPromoCode проверяет, что введённый гостем промокод дал скидку
+func checkPromoCode(order models.Order) error {
+	if order.PromoCode == "" {
+		return nil
+	}
+	for _, discount := range order.Discounts {
+		if discount.Code == order.PromoCode {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: promo code %q does not apply to this order", utils.ErrValidation, order.PromoCode)
+}
+
+// unitPrice считает цену единицы позиции: цена из меню (или цена размерного
+// варианта) с учётом правила цены rule, если оно есть, плюс наценки за
+// замены ингредиентов, добавки, модификаторы и замены в слотах комбо-набора.
+// Заодно проверяет, что кастомизации допустимы.
+func (s OrderService) unitPrice(item models.OrderItem, rule *models.PricingRule) (float64, error) {
+	custom := item.Customizations
+
+	price, err := s.menuRepo.GetProductPrice(item.ProductID)
+	if err != nil {
+		return 0.0, err
+	}
+	// Размерный вариант — надбавка к цене позиции: фиксированная цена правила
+	// задаёт цену базового размера, и разница между размерами сохраняется
+	var variantDelta float64
+	var recipe []models.MenuItemIngredient
+	if item.VariantID != 0 {
+		variant, err := s.menuRepo.GetVariant(item.ProductID, item.VariantID)
+		if err != nil {
+			return 0.0, customizationError(err)
+		}
+		variantDelta = variant.Price - price
+		recipe = variant.Ingredients
+	}
+	switch {
+	case rule != nil && rule.FixedPrice > 0:
+		price = utils.RoundMoney(rule.Apply(price)) + variantDelta
+	case rule != nil:
+		price = utils.RoundMoney(rule.Apply(price + variantDelta))
+	default:
+		price += variantDelta
+	}
+
+	if len(custom.Substitutions) > 0 {
+		if item.VariantID == 0 {
+			menuItem, err := s.menuRepo.GetMenuItemByID(item.ProductID)
+			if err != nil {
+				return 0.0, err
+			}
+			recipe = menuItem.Ingredients
+		}
+		inRecipe := make(map[int]bool, len(recipe))
+		for _, ingredient := range recipe {
+			inRecipe[ingredient.IngredientID] = true
+		}
+
+		replaced := make(map[int]bool, len(custom.Substitutions))
+		for _, substitution := range custom.Substitutions {
+			if !inRecipe[substitution.IngredientID] {
+				return 0.0, fmt.Errorf("%w: ingredient %d is not part of product %d", utils.ErrValidation, substitution.IngredientID, item.ProductID)
+			}
+			if replaced[substitution.IngredientID] {
+				return 0.0, fmt.Errorf("%w: ingredient %d is replaced more than once", utils.ErrValidation, substitution.IngredientID)
+			}
+			replaced[substitution.IngredientID] = true
+
+			substitute, err := s.menuRepo.GetIngredientSubstitute(substitution.IngredientID, substitution.SubstituteID)
+			if err != nil {
+				return 0.0, customizationError(err)
+			}
+			price += substitute.PriceDelta
+		}
+	}
+
+	for code, count := range custom.Extras {
+		if count <= 0 || count > 10 {
+			return 0.0, fmt.Errorf("%w: extra %q count must be between 1 and 10", utils.ErrValidation, code)
+		}
+		extra, err := s.menuRepo.GetMenuExtra(code)
+		if err != nil {
+			return 0.0, customizationError(err)
+		}
+		price += extra.PriceDelta * float64(count)
+	}
+
+	modifiersDelta, err := s.modifiersPrice(item.ProductID, custom.Modifiers)
+	if err != nil {
+		return 0.0, err
+	}
+	price += modifiersDelta
+
+	bundleDelta, err := s.bundlePrice(item)
+	if err != nil {
+		return 0.0, err
+	}
+	price += bundleDelta
+
+	if price <= 0 {
+		return 0.0, fmt.Errorf("%w: price of product %d must be positive", utils.ErrValidation, item.ProductID)
+	}
+	return price, nil
+}
+
+// resolveSize заменяет customizations.size размерным вариантом позиции с этим размером:
+// размер — лишь краткая запись variant_id, цена и рецепт берутся из варианта
+func (s OrderService) resolveSize(item *models.OrderItem) error {
+	size := item.Customizations.Size
+	if size == "" {
+		return nil
+	}
+
+	variants, err := s.menuRepo.LoadVariants(item.ProductID)
+	if err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		if variant.Size != size {
+			continue
+		}
+		if item.VariantID != 0 && item.VariantID != variant.ID {
+			return fmt.Errorf("%w: size %q does not match variant %d", utils.ErrValidation, size, item.VariantID)
+		}
+		item.VariantID = variant.ID
+		item.Customizations.Size = ""
+		return nil
+	}
+	return fmt.Errorf("%w: product %d has no %s size", utils.ErrValidation, item.ProductID, size)
+}
+
+// modifiersPrice проверяет выбранные модификаторы по правилам групп позиции меню
+// (min/max, обязательность) и возвращает сумму их наценок
+func (s OrderService) modifiersPrice(productID int, chosen []int) (float64, error) {
+	groups, err := s.menuRepo.LoadModifierGroups(productID)
+	if err != nil {
+		return 0.0, err
+	}
+
+	groupOf := make(map[int]int)
+	deltas := make(map[int]float64)
+	for _, group := range groups {
+		for _, modifier := range group.Modifiers {
+			groupOf[modifier.ID] = group.ID
+			deltas[modifier.ID] = modifier.PriceDelta
+		}
+	}
+
+	var delta float64
+	selected := make(map[int]int, len(groups))
+	seen := make(map[int]bool, len(chosen))
+	for _, modifierID := range chosen {
+		groupID, ok := groupOf[modifierID]
+		if !ok {
+			return 0.0, fmt.Errorf("%w: modifier %d is not available for product %d", utils.ErrValidation, modifierID, productID)
+		}
+		if seen[modifierID] {
+			return 0.0, fmt.Errorf("%w: modifier %d is selected more than once", utils.ErrValidation, modifierID)
+		}
+		seen[modifierID] = true
+		selected[groupID]++
+		delta += deltas[modifierID]
+	}
+
+	for _, group := range groups {
+		count := selected[group.ID]
+		if group.Required && count == 0 {
+			return 0.0, fmt.Errorf("%w: modifier group %q of product %d is required", utils.ErrValidation, group.Name, productID)
+		}
+		if count < group.MinSelections || count > group.MaxSelections {
+			return 0.0, fmt.Errorf("%w: modifier group %q of product %d allows %d to %d selections, got %d",
+				utils.ErrValidation, group.Name, productID, group.MinSelections, group.MaxSelections, count)
+		}
+	}
+
+	return delta, nil
+}
+
+// bundlePrice проверяет выбор гостя в слотах комбо-набора и возвращает сумму доплат
+// за замены. Размерный вариант и замены ингредиентов к набору не применяются.
+func (s OrderService) bundlePrice(item models.OrderItem) (float64, error) {
+	custom := item.Customizations
+	slots, err := s.menuRepo.LoadBundleSlots(item.ProductID)
+	if err != nil {
+		return 0.0, err
+	}
+	if len(slots) == 0 {
+		if len(custom.BundleChoices) > 0 {
+			return 0.0, fmt.Errorf("%w: product %d is not a bundle", utils.ErrValidation, item.ProductID)
+		}
+		return 0.0, nil
+	}
+	if item.VariantID != 0 || len(custom.Substitutions) > 0 {
+		return 0.0, fmt.Errorf("%w: bundle %d cannot be customized with a size variant or substitutions", utils.ErrValidation, item.ProductID)
+	}
+
+	var delta float64
+	inBundle := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		inBundle[slot.ID] = true
+		productID, ok := custom.BundleChoices[slot.ID]
+		if !ok || productID == slot.ProductID {
+			continue
+		}
+
+		available := false
+		for _, choice := range slot.Choices {
+			if choice.ProductID == productID {
+				delta += choice.PriceDelta * float64(slot.Quantity)
+				available = true
+				break
+			}
+		}
+		if !available {
+			return 0.0, fmt.Errorf("%w: product %d is not available in slot %q of bundle %d", utils.ErrValidation, productID, slot.Name, item.ProductID)
+		}
+	}
+
+	for slotID := range custom.BundleChoices {
+		if !inBundle[slotID] {
+			return 0.0, fmt.Errorf("%w: bundle %d has no slot %d", utils.ErrValidation, item.ProductID, slotID)
+		}
+	}
+	return delta, nil
+}
+
+// bundleComponents фиксирует состав набора: компонент каждого слота с учётом выбора
+// гостя, его текущую цену в меню и налоговую категорию. У обычной позиции состава нет.
+func (s OrderService) bundleComponents(item models.OrderItem) ([]models.BundleComponent, error) {
+	slots, err := s.menuRepo.LoadBundleSlots(item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	var components []models.BundleComponent
+	for _, slot := range slots {
+		component := models.BundleComponent{
+			SlotID: slot.ID, ProductID: slot.ComponentOf(item.Customizations.BundleChoices), Quantity: slot.Quantity,
+		}
+		if component.Price, err = s.menuRepo.GetProductPrice(component.ProductID); err != nil {
+			return nil, err
+		}
+		if component.TaxCategory, err = s.menuRepo.GetProductTaxCategory(component.ProductID); err != nil {
+			return nil, err
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// checkSoldOut не даёт заказать позицию, снятую с продажи, или набор с таким компонентом.
+// Нехватку склада проверяет резерв, здесь — только ручная отметка.
+func (s OrderService) checkSoldOut(items ...models.OrderItem) error {
+	var productIDs []int
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		slots, err := s.menuRepo.LoadBundleSlots(item.ProductID)
 		if err != nil {
-			return 0.0, err
+			return err
+		}
+		for _, slot := range slots {
+			productIDs = append(productIDs, slot.ComponentOf(item.Customizations.BundleChoices))
 		}
-		order.Items[i].Price = price
-		totalAmount += price * float64(product.Quantity)
 	}
-	return totalAmount, nil
+
+	soldOut, err := s.menuRepo.SoldOutProducts(productIDs)
+	if err != nil {
+		return err
+	}
+	if len(soldOut) > 0 {
+		return fmt.Errorf("%w: product %d", ErrItemSoldOut, soldOut[0])
+	}
+	return nil
 }
 
-// оптовые заказы
-func (s OrderService) CreateBulkOrder(orders []models.Order) (models.BulkOrderResponse, error) {
-	var newOrders []models.Order
+// customizationError превращает «не найдено» из справочников в ошибку валидации
+func customizationError(err error) error {
+	if errors.Is(err, dal.ErrNotFound) {
+		return fmt.Errorf("%w: invalid customization: %v", utils.ErrValidation, err)
+	}
+	return err
+}
+
+// оптовые заказы: каждый заказ создаётся и сразу закрывается, режим mode
+// определяет, что делать с отклонёнными заказами (см. dal.ProcessBatch)
+func (s OrderService) CreateBulkOrder(orders []models.Order, mode string) (models.BulkOrderResponse, error) {
 	var bulkOrder models.BulkOrderResponse
-	var totalRevenue float64
-	var acceptedCount, rejectedCount int
 
-	// создаём новые заказы
-	for _, order := range orders {
-		newOrder, err := s.CreateOrder(order)
+	if mode == "" {
+		mode = models.BatchModeBestEffort
+	}
+	switch mode {
+	case models.BatchModeAllOrNothing, models.BatchModeBestEffort, models.BatchModeDryRun:
+	default:
+		return models.BulkOrderResponse{}, fmt.Errorf("%w: unknown batch mode %q", utils.ErrValidation, mode)
+	}
+
+	// проверяем и оцениваем заказы до транзакции; невалидный заказ сразу отклоняем
+	processed := make([]models.ProcessedOrder, len(orders))
+	var valid []models.Order
+	var validIndexes []int
+	for i, order := range orders {
+		processed[i].CustomerName = order.CustomerName
+
+		prepared, err := s.prepareOrder(order)
+		for j := 0; err == nil && j < len(prepared.Payments); j++ {
+			prepared.Payments[j], err = preparePayment(prepared.Payments[j], s.loyalty)
+		}
+		if err != nil {
+			processed[i].Status = "rejected"
+			processed[i].Reason = "invalid_order: " + err.Error()
+			continue
+		}
+		valid = append(valid, prepared)
+		validIndexes = append(validIndexes, i)
+	}
+
+	var outcomes []dal.BatchOrderOutcome
+	committed := false
+	if len(valid) == len(orders) || mode != models.BatchModeAllOrNothing {
+		var err error
+		change := models.OrderStatusChange{Notes: "Closed by batch processing"}
+		outcomes, committed, err = s.orderRepo.ProcessBatch(valid, mode, change, s.requireFullPayment, s.loyalty.PointsTTL)
 		if err != nil {
 			return models.BulkOrderResponse{}, err
 		}
-		newOrders = append(newOrders, newOrder)
 	}
 
-	// закрываем новые заказы и списываем инвентарь
-	for _, newOrder := range newOrders {
-		closedOrder, usedIngredients, err := s.CloseOrder(newOrder.ID)
+	// all_or_nothing без фиксации: ни один заказ не принят
+	aborted := mode == models.BatchModeAllOrNothing && !committed
 
-		// Создаём объект processedOrder для каждого заказа
-		processedOrder := struct {
-			ID           int     `json:"order_id"`
-			CustomerName string  `json:"customer_name"`
-			Status       string  `json:"status"`
-			TotalAmount  float64 `json:"total,omitempty"`
-			Reason       string  `json:"reason,omitempty"`
-		}{
-			ID:           newOrder.ID,
-			CustomerName: newOrder.CustomerName,
+	usage := make(map[int]*models.InventoryUpdate)
+	for i, index := range validIndexes {
+		if i >= len(outcomes) {
+			// до заказа не дошли: пакет остановился на отклонённом заказе
+			processed[index].Status = "rejected"
+			processed[index].Reason = "batch_aborted"
+			continue
 		}
 
-		if err != nil {
-			if strings.Contains(err.Error(), "insufficient inventory") {
-				processedOrder.Status = "rejected"
-				processedOrder.Reason = "insufficient_inventory"
-				rejectedCount++
-			} else {
-				return models.BulkOrderResponse{}, err
+		outcome := outcomes[i]
+		if outcome.Err != nil {
+			processed[index].Status = "rejected"
+			processed[index].Reason = "insufficient_inventory: " + outcome.Err.Error()
+			if errors.Is(outcome.Err, ErrOrderNotPaid) {
+				processed[index].Reason = "not_paid: " + outcome.Err.Error()
 			}
-		} else {
-			processedOrder.Status = "accepted"
-			processedOrder.TotalAmount = closedOrder.TotalAmount
-			totalRevenue += closedOrder.TotalAmount
-			acceptedCount++
-		}
-
-		// Агрегация использованных ингредиентов
-
-		for _, ingredient := range usedIngredients {
-			inventoryUpdates := struct {
-				IngredientID int     `json:"ingredient_id"`
-				Name         string  `json:"name"`
-				QuantityUsed float64 `json:"quantity_used"`
-				Remaining    float64 `json:"remaining"`
-			}{
-				IngredientID: ingredient.IngredientID,
-				Name:         ingredient.Name,
-				QuantityUsed: ingredient.QuantityUsed,
-				Remaining:    ingredient.QuantityUsed,
+			if errors.Is(outcome.Err, ErrInsufficientPoints) {
+				processed[index].Reason = "insufficient_points: " + outcome.Err.Error()
+			}
+			if errors.Is(outcome.Err, ErrBatchPaymentRejected) {
+				processed[index].Reason = "payment_rejected: " + outcome.Err.Error()
 			}
-			bulkOrder.Summary.InventoryUpdates = append(bulkOrder.Summary.InventoryUpdates, inventoryUpdates)
+			continue
+		}
+		if aborted {
+			processed[index].Status = "rejected"
+			processed[index].Reason = "batch_aborted"
+			continue
 		}
 
-		bulkOrder.ProcessedOrders = append(bulkOrder.ProcessedOrders, processedOrder)
+		processed[index].Status = "accepted"
+		processed[index].TotalAmount = outcome.Order.TotalAmount
+		if committed {
+			processed[index].ID = outcome.Order.ID
+		}
+
+		// остаток берём после последнего списания: заказы списываются по очереди
+		for _, update := range outcome.InventoryUpdates {
+			total, ok := usage[update.IngredientID]
+			if !ok {
+				total = &models.InventoryUpdate{IngredientID: update.IngredientID, Name: update.Name}
+				usage[update.IngredientID] = total
+			}
+			total.QuantityUsed += update.QuantityUsed
+			total.Remaining = update.Remaining
+		}
+	}
+
+	for _, order := range processed {
+		if order.Status == "accepted" {
+			bulkOrder.Summary.Accepted++
+			bulkOrder.Summary.TotalRevenue += order.TotalAmount
+		} else {
+			bulkOrder.Summary.Rejected++
+		}
+	}
+
+	ingredientIDs := make([]int, 0, len(usage))
+	for id := range usage {
+		ingredientIDs = append(ingredientIDs, id)
+	}
+	sort.Ints(ingredientIDs)
+	bulkOrder.Summary.InventoryUpdates = []models.InventoryUpdate{}
+	for _, id := range ingredientIDs {
+		bulkOrder.Summary.InventoryUpdates = append(bulkOrder.Summary.InventoryUpdates, *usage[id])
 	}
 
-	// Заполняем итог
+	bulkOrder.ProcessedOrders = processed
+	bulkOrder.Summary.Mode = mode
+	bulkOrder.Summary.Committed = committed
 	bulkOrder.Summary.TotalOrders = len(orders)
-	bulkOrder.Summary.Accepted = acceptedCount
-	bulkOrder.Summary.Rejected = rejectedCount
-	bulkOrder.Summary.TotalRevenue = totalRevenue
 
 	return bulkOrder, nil
 }
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.OrderStatusOpen, models.OrderStatusInProgress, true},
+		{models.OrderStatusOpen, models.OrderStatusClosed, true},
+		{models.OrderStatusOpen, models.OrderStatusCancelled, true},
+		{models.OrderStatusOpen, models.OrderStatusReady, false},
+		{models.OrderStatusOpen, models.OrderStatusRefunded, false},
+		{models.OrderStatusInProgress, models.OrderStatusReady, true},
+		{models.OrderStatusInProgress, models.OrderStatusCancelled, true},
+		{models.OrderStatusInProgress, models.OrderStatusClosed, false},
+		{models.OrderStatusInProgress, models.OrderStatusOpen, false},
+		{models.OrderStatusReady, models.OrderStatusClosed, true},
+		{models.OrderStatusReady, models.OrderStatusCancelled, true},
+		{models.OrderStatusReady, models.OrderStatusInProgress, false},
+		{models.OrderStatusClosed, models.OrderStatusRefunded, true},
+		{models.OrderStatusClosed, models.OrderStatusCancelled, false},
+		{models.OrderStatusClosed, models.OrderStatusOpen, false},
+		{models.OrderStatusCancelled, models.OrderStatusOpen, true},
+		{models.OrderStatusCancelled, models.OrderStatusClosed, false},
+		{models.OrderStatusRefunded, models.OrderStatusClosed, false},
+		{models.OrderStatusRefunded, models.OrderStatusOpen, false},
+		{"unknown", models.OrderStatusOpen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Неизвестный режим пакета отклоняется до обращения к базе
+func TestCreateBulkOrderUnknownMode(t *testing.T) {
+	for _, mode := range []string{"all", "BEST_EFFORT", "dry-run"} {
+		t.Run(mode, func(t *testing.T) {
+			_, err := OrderService{}.CreateBulkOrder([]models.Order{{CustomerName: "test"}}, mode)
+			if !errors.Is(err, utils.ErrValidation) {
+				t.Errorf("CreateBulkOrder(mode %q) error = %v, want validation error", mode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// ErrOrderNotPayable — отменённый, возвращённый или уже оплаченный заказ оплатить нельзя
+var ErrOrderNotPayable = dal.ErrOrderNotPayable
+
+// ErrOrderNotRefundable — вернуть можно только закрытый и ещё не возвращённый полностью заказ
+var ErrOrderNotRefundable = dal.ErrOrderNotRefundable
+
+type PaymentServiceInterface interface {
+	AddPayment(orderID int, payment models.Payment) (models.Payment, models.OrderPayments, error)
+	GetPayments(orderID int) (models.OrderPayments, error)
+	RefundOrder(orderID int, request models.RefundRequest) (models.Refund, error)
+}
+
+type PaymentService struct {
+	paymentRepo dal.PaymentRepositoryInterface
+	// loyalty — стоимость балла для оплаты баллами и срок баллов, возвращённых при возврате
+	loyalty LoyaltySettings
+}
+
+func NewPaymentService(_paymentRepo dal.PaymentRepositoryInterface, _loyalty LoyaltySettings) PaymentService {
+	return PaymentService{paymentRepo: _paymentRepo, loyalty: _loyalty}
+}
+
+// AddPayment принимает оплату заказа и возвращает её вместе с новым остатком
+func (s PaymentService) AddPayment(orderID int, payment models.Payment) (models.Payment, models.OrderPayments, error) {
+	payment, err := preparePayment(payment, s.loyalty)
+	if err != nil {
+		return models.Payment{}, models.OrderPayments{}, err
+	}
+
+	newPayment, err := s.paymentRepo.AddPayment(orderID, payment)
+	if err != nil {
+		return models.Payment{}, models.OrderPayments{}, err
+	}
+	log.Printf("payment added: %d (order %d, %s %.2f)", newPayment.ID, orderID, newPayment.Method, newPayment.Amount)
+
+	summary, err := s.paymentRepo.LoadPayments(orderID)
+	if err != nil {
+		return models.Payment{}, models.OrderPayments{}, err
+	}
+	return newPayment, summary, nil
+}
+
+func (s PaymentService) GetPayments(orderID int) (models.OrderPayments, error) {
+	return s.paymentRepo.LoadPayments(orderID)
+}
+
+// RefundOrder возвращает заказ целиком (без items) или отдельные позиции
+func (s PaymentService) RefundOrder(orderID int, request models.RefundRequest) (models.Refund, error) {
+	if err := validateRefund(request); err != nil {
+		return models.Refund{}, err
+	}
+
+	refund, err := s.paymentRepo.RefundOrder(orderID, request, s.loyalty.PointsTTL)
+	if err != nil {
+		return models.Refund{}, err
+	}
+	log.Printf("order refunded: %d (refund %d, %.2f, status %s)", orderID, refund.ID, refund.Amount, refund.OrderStatus)
+	return refund, nil
+}
+
+func validateRefund(request models.RefundRequest) error {
+	for _, item := range request.Items {
+		if item.OrderItemID <= 0 {
+			return fmt.Errorf("%w: item_id is required for every refunded item", utils.ErrValidation)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: refund quantity for item %d must be positive", utils.ErrValidation, item.OrderItemID)
+		}
+		if item.Amount != 0 {
+			return fmt.Errorf("%w: refund amount is calculated from the order and cannot be set", utils.ErrValidation)
+		}
+	}
+	// полный возврат записывает actor в историю статусов (changed_by VARCHAR(50))
+	if utf8.RuneCountInString(request.Actor) > models.MaxActorLength {
+		return fmt.Errorf("%w: actor must be at most %d characters", utils.ErrValidation, models.MaxActorLength)
+	}
+	return nil
+}
+
+// preparePayment проверяет оплату, считает баллы для оплаты баллами и приводит код подарочной карты
+func preparePayment(payment models.Payment, loyalty LoyaltySettings) (models.Payment, error) {
+	if err := validatePayment(payment); err != nil {
+		return models.Payment{}, err
+	}
+	switch payment.Method {
+	case models.PaymentMethodLoyalty:
+		payment.Points = loyalty.pointsFor(payment.Amount)
+	case models.PaymentMethodGiftCard:
+		payment.Reference = NormalizeGiftCardCode(payment.Reference)
+	}
+	return payment, nil
+}
+
+func validatePayment(payment models.Payment) error {
+	switch payment.Method {
+	case models.PaymentMethodCash:
+		if payment.Amount <= 0 && payment.Tendered <= 0 {
+			return fmt.Errorf("%w: cash payment requires a positive amount or tendered", utils.ErrValidation)
+		}
+		if payment.Amount < 0 || payment.Tendered < 0 {
+			return fmt.Errorf("%w: amounts cannot be negative", utils.ErrValidation)
+		}
+		return nil
+	case models.PaymentMethodCard, models.PaymentMethodOther:
+	case models.PaymentMethodLoyalty:
+		if payment.Points != 0 {
+			return fmt.Errorf("%w: points are calculated from the amount and cannot be set", utils.ErrValidation)
+		}
+	case models.PaymentMethodGiftCard:
+		if strings.TrimSpace(payment.Reference) == "" {
+			return fmt.Errorf("%w: gift card payment requires the card code in reference", utils.ErrValidation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown payment method %q, expected cash, card, gift_card, loyalty_points or other", utils.ErrValidation, payment.Method)
+	}
+
+	if payment.Tendered != 0 {
+		return fmt.Errorf("%w: tendered is only allowed for cash payments", utils.ErrValidation)
+	}
+	if payment.Amount <= 0 {
+		return fmt.Errorf("%w: payment amount must be positive", utils.ErrValidation)
+	}
+	if len(payment.Reference) > 100 {
+		return fmt.Errorf("%w: reference is too long", utils.ErrValidation)
+	}
+	return nil
+}
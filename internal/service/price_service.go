@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PriceServiceInterface interface {
+	SchedulePriceChange(menuItemID int, change models.ScheduledPriceChange) (models.ScheduledPriceChange, error)
+	GetPriceHistory(menuItemID int) (models.PriceHistory, error)
+	GetPriceAt(menuItemID, variantID int, at time.Time) (models.PriceAtTime, error)
+	RunScheduler(ctx context.Context)
+}
+
+type PriceService struct {
+	priceRepo dal.PriceRepositoryInterface
+	// interval — как часто планировщик перепроверяет изменения, даже если ближайшее ещё далеко
+	interval time.Duration
+	// wake будит планировщик, когда запланировано новое изменение
+	wake chan struct{}
+}
+
+func NewPriceService(_priceRepo dal.PriceRepositoryInterface, _interval time.Duration) PriceService {
+	return PriceService{priceRepo: _priceRepo, interval: _interval, wake: make(chan struct{}, 1)}
+}
+
+func (s PriceService) SchedulePriceChange(menuItemID int, change models.ScheduledPriceChange) (models.ScheduledPriceChange, error) {
+	change.ProductID = menuItemID
+	change.Reason = strings.TrimSpace(change.Reason)
+	if change.Price <= 0 {
+		return models.ScheduledPriceChange{}, fmt.Errorf("%w: price must be positive", utils.ErrValidation)
+	}
+	if change.EffectiveAt.IsZero() || !change.EffectiveAt.After(time.Now()) {
+		return models.ScheduledPriceChange{}, fmt.Errorf("%w: effective_at must be in the future", utils.ErrValidation)
+	}
+	if change.Reason == "" {
+		return models.ScheduledPriceChange{}, fmt.Errorf("%w: reason is required", utils.ErrValidation)
+	}
+
+	newChange, err := s.priceRepo.SchedulePriceChange(change)
+	if err != nil {
+		return models.ScheduledPriceChange{}, err
+	}
+	log.Printf("price change scheduled: menu item %d -> %.2f at %s", menuItemID, newChange.Price, newChange.EffectiveAt.Format(time.RFC3339))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return newChange, nil
+}
+
+func (s PriceService) GetPriceHistory(menuItemID int) (models.PriceHistory, error) {
+	return s.priceRepo.LoadPriceHistory(menuItemID)
+}
+
+// GetPriceAt возвращает цену позиции или её варианта, действовавшую в момент at
+func (s PriceService) GetPriceAt(menuItemID, variantID int, at time.Time) (models.PriceAtTime, error) {
+	if variantID < 0 {
+		return models.PriceAtTime{}, fmt.Errorf("%w: invalid variant_id", utils.ErrValidation)
+	}
+	return s.priceRepo.GetPriceAt(menuItemID, variantID, at)
+}
+
+// RunScheduler применяет запланированные изменения цены, пока не отменён ctx.
+// Спит до ближайшего изменения, но не дольше interval; новое изменение будит его сразу.
+func (s PriceService) RunScheduler(ctx context.Context) {
+	log.Printf("price scheduler started")
+	for {
+		wait := s.interval
+		applied, err := s.priceRepo.ApplyDuePriceChanges()
+		if err != nil {
+			log.Printf("failed to apply scheduled price changes: %v", err)
+		}
+		for _, change := range applied {
+			log.Printf("scheduled price change applied: %d (menu item %d -> %.2f)", change.ID, change.ProductID, change.Price)
+		}
+
+		// Не чаще раза в секунду: изменение может быть заблокировано другим экземпляром сервера
+		if next, ok, err := s.priceRepo.NextPriceChangeAt(); err != nil {
+			log.Printf("failed to get next price change: %v", err)
+		} else if ok {
+			wait = min(wait, max(time.Until(next), time.Second))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("price scheduler stopped")
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
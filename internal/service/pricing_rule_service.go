@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PricingRuleServiceInterface interface {
+	GetPricingRules() ([]models.PricingRule, error)
+	CreatePricingRule(rule models.PricingRule) (models.PricingRule, error)
+	DeletePricingRule(id int) error
+}
+
+type PricingRuleService struct {
+	pricingRuleRepo dal.PricingRuleRepositoryInterface
+}
+
+func NewPricingRuleService(_pricingRuleRepo dal.PricingRuleRepositoryInterface) PricingRuleService {
+	return PricingRuleService{pricingRuleRepo: _pricingRuleRepo}
+}
+
+func (s PricingRuleService) GetPricingRules() ([]models.PricingRule, error) {
+	return s.pricingRuleRepo.LoadPricingRules()
+}
+
+func (s PricingRuleService) CreatePricingRule(rule models.PricingRule) (models.PricingRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Category = strings.TrimSpace(rule.Category)
+	if err := validatePricingRule(rule); err != nil {
+		return models.PricingRule{}, err
+	}
+	slices.Sort(rule.DaysOfWeek)
+	rule.DaysOfWeek = slices.Compact(rule.DaysOfWeek)
+
+	newRule, err := s.pricingRuleRepo.AddPricingRule(rule)
+	if err != nil {
+		return models.PricingRule{}, err
+	}
+	log.Printf("pricing rule added: %d (%s)", newRule.ID, newRule.Name)
+	return newRule, nil
+}
+
+func (s PricingRuleService) DeletePricingRule(id int) error {
+	if err := s.pricingRuleRepo.DeletePricingRule(id); err != nil {
+		return err
+	}
+	log.Printf("pricing rule deleted: %d", id)
+	return nil
+}
+
+func validatePricingRule(rule models.PricingRule) error {
+	if rule.Name == "" || len(rule.Name) > 100 {
+		return fmt.Errorf("%w: pricing rule name must be between 1 and 100 characters", utils.ErrValidation)
+	}
+	if rule.MenuItemID < 0 {
+		return fmt.Errorf("%w: invalid product_id", utils.ErrValidation)
+	}
+	if (rule.MenuItemID == 0) == (rule.Category == "") {
+		return fmt.Errorf("%w: exactly one of product_id or category is required", utils.ErrValidation)
+	}
+	if len(rule.Category) > 50 {
+		return fmt.Errorf("%w: category is too long", utils.ErrValidation)
+	}
+
+	for _, day := range rule.DaysOfWeek {
+		if day < 1 || day > 7 {
+			return fmt.Errorf("%w: days_of_week must be between 1 (Monday) and 7 (Sunday)", utils.ErrValidation)
+		}
+	}
+	start, err := time.Parse(models.PricingRuleTimeLayout, rule.StartTime)
+	if err != nil {
+		return fmt.Errorf("%w: start_time must be in HH:MM format", utils.ErrValidation)
+	}
+	end, err := time.Parse(models.PricingRuleTimeLayout, rule.EndTime)
+	if err != nil {
+		return fmt.Errorf("%w: end_time must be in HH:MM format", utils.ErrValidation)
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("%w: start_time and end_time must differ", utils.ErrValidation)
+	}
+
+	if (rule.PercentOff == 0) == (rule.FixedPrice == 0) {
+		return fmt.Errorf("%w: exactly one of percent_off or fixed_price is required", utils.ErrValidation)
+	}
+	if rule.PercentOff < 0 || rule.PercentOff >= 100 {
+		return fmt.Errorf("%w: percent_off must be between 0 and 100", utils.ErrValidation)
+	}
+	if rule.FixedPrice < 0 {
+		return fmt.Errorf("%w: fixed_price must be positive", utils.ErrValidation)
+	}
+	return nil
+}
+
+// pricingRuleFor выбирает правило цены, действующее в момент at: правило для
+// самой позиции важнее правила категории, среди равных — созданное раньше
+func pricingRuleFor(rules []models.PricingRule, productID int, categories []string, at time.Time) *models.PricingRule {
+	var found *models.PricingRule
+	for i, rule := range rules {
+		if !rule.AppliesAt(at) {
+			continue
+		}
+		if rule.MenuItemID != 0 && rule.MenuItemID == productID {
+			return &rules[i]
+		}
+		if found == nil && rule.Category != "" && slices.Contains(categories, rule.Category) {
+			found = &rules[i]
+		}
+	}
+	return found
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+type PromotionServiceInterface interface {
+	GetPromotions() ([]models.Promotion, error)
+	CreatePromotion(promotion models.Promotion) (models.Promotion, error)
+	DeletePromotion(id int) error
+}
+
+type PromotionService struct {
+	promotionRepo dal.PromotionRepositoryInterface
+}
+
+func NewPromotionService(_promotionRepo dal.PromotionRepositoryInterface) PromotionService {
+	return PromotionService{promotionRepo: _promotionRepo}
+}
+
+func (s PromotionService) GetPromotions() ([]models.Promotion, error) {
+	return s.promotionRepo.LoadPromotions()
+}
+
+func (s PromotionService) CreatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	promotion.Code = strings.ToUpper(strings.TrimSpace(promotion.Code))
+	if err := validatePromotion(promotion); err != nil {
+		return models.Promotion{}, err
+	}
+
+	newPromotion, err := s.promotionRepo.AddPromotion(promotion)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+	log.Printf("promotion added: %d (%s)", newPromotion.ID, newPromotion.Name)
+	return newPromotion, nil
+}
+
+func (s PromotionService) DeletePromotion(id int) error {
+	if err := s.promotionRepo.DeletePromotion(id); err != nil {
+		return err
+	}
+	log.Printf("promotion deleted: %d", id)
+	return nil
+}
+
+var promoCodeRegex = regexp.MustCompile(`^[A-Z0-9_-]{3,50}$`)
+
+func validatePromotion(promotion models.Promotion) error {
+	if promotion.Name == "" || len(promotion.Name) > 100 {
+		return fmt.Errorf("%w: promotion name must be between 1 and 100 characters", utils.ErrValidation)
+	}
+
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		if promotion.Value <= 0 || promotion.Value > 100 {
+			return fmt.Errorf("%w: percentage must be between 0 and 100", utils.ErrValidation)
+		}
+	case models.PromotionFixed:
+		if promotion.Value <= 0 {
+			return fmt.Errorf("%w: fixed discount must be positive", utils.ErrValidation)
+		}
+	case models.PromotionBuyXGetY:
+		if promotion.BuyQuantity < 1 || promotion.GetQuantity < 1 {
+			return fmt.Errorf("%w: buy_quantity and get_quantity must be at least 1", utils.ErrValidation)
+		}
+		if promotion.Value != 0 {
+			return fmt.Errorf("%w: buy_x_get_y promotions have no value", utils.ErrValidation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown promotion type %q, expected percentage, fixed or buy_x_get_y", utils.ErrValidation, promotion.Type)
+	}
+	if promotion.Type != models.PromotionBuyXGetY && (promotion.BuyQuantity != 0 || promotion.GetQuantity != 0) {
+		return fmt.Errorf("%w: buy_quantity and get_quantity are only allowed for buy_x_get_y", utils.ErrValidation)
+	}
+
+	if promotion.MenuItemID < 0 {
+		return fmt.Errorf("%w: invalid product_id", utils.ErrValidation)
+	}
+	if len(promotion.Category) > 50 {
+		return fmt.Errorf("%w: category is too long", utils.ErrValidation)
+	}
+	if promotion.Code != "" && !promoCodeRegex.MatchString(promotion.Code) {
+		return fmt.Errorf("%w: promo code must be 3-50 latin letters, digits, '-' or '_'", utils.ErrValidation)
+	}
+	if promotion.UsageLimit < 0 {
+		return fmt.Errorf("%w: usage_limit cannot be negative", utils.ErrValidation)
+	}
+	if promotion.ValidFrom != nil && promotion.ValidTo != nil && !promotion.ValidTo.After(*promotion.ValidFrom) {
+		return fmt.Errorf("%w: valid_to must be after valid_from", utils.ErrValidation)
+	}
+	return nil
+}
+
+// eligiblePromotions возвращает автоматические акции, действующие в момент at,
+// и акцию по промокоду заказа. Исчерпанные автоматические акции пропускаются,
+// а промокод с истёкшим сроком или лимитом — ошибка. used — акции, которые уже
+// применены к этому заказу: их использование лимит не увеличивает. accepted —
+// промокод уже принят заказом раньше: он действует и после окончания срока
+// или удаления акции, иначе любая правка такого заказа отклонялась бы.
+func (s OrderService) eligiblePromotions(promoCode string, accepted bool, at time.Time, used []models.OrderDiscount) ([]models.Promotion, error) {
+	automatic, err := s.promotionRepo.LoadAutomaticPromotions()
+	if err != nil {
+		return nil, err
+	}
+
+	exhausted := func(promotion models.Promotion) bool {
+		alreadyUsed := slices.ContainsFunc(used, func(d models.OrderDiscount) bool { return d.PromotionID == promotion.ID })
+		return promotion.UsageLimit > 0 && promotion.TimesUsed >= promotion.UsageLimit && !alreadyUsed
+	}
+
+	var promotions []models.Promotion
+	for _, promotion := range automatic {
+		if promotion.ActiveAt(at) && !exhausted(promotion) {
+			promotions = append(promotions, promotion)
+		}
+	}
+
+	if promoCode == "" {
+		return promotions, nil
+	}
+	coupon, err := s.promotionRepo.GetPromotionByCode(promoCode)
+	if err == nil && coupon.DeletedAt != nil && !accepted {
+		err = dal.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, dal.ErrNotFound) {
+			return nil, fmt.Errorf("%w: promo code %q not found", utils.ErrValidation, promoCode)
+		}
+		return nil, err
+	}
+	if accepted {
+		return append(promotions, coupon), nil
+	}
+	if !coupon.ActiveAt(at) {
+		return nil, fmt.Errorf("%w: promo code %q is not valid at this time", utils.ErrValidation, promoCode)
+	}
+	if exhausted(coupon) {
+		return nil, fmt.Errorf("%w: promo code %q has reached its usage limit", utils.ErrValidation, promoCode)
+	}
+	return append(promotions, coupon), nil
+}
+
+// Шаги применения акций: сначала «купи X — получи Y», затем скидки на позиции
+// и категории, в конце — скидки на весь заказ
+func promotionStep(promotion models.Promotion) int {
+	switch {
+	case promotion.Type == models.PromotionBuyXGetY:
+		return 0
+	case promotion.MenuItemID != 0 || promotion.Category != "":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// applyDiscounts применяет акции к позициям в детерминированном порядке: по шагу
+// (promotionStep), внутри шага — по id акции. Каждая скидка считается от того, что
+// осталось от позиции после предыдущих, поэтому позиция не уходит в минус.
+// Возвращает заказ со скидками и позиции с уменьшенной стоимостью.
+func applyDiscounts(order models.Order, lines []pricedLine, promotions []models.Promotion) (models.Order, []pricedLine) {
+	sorted := slices.Clone(promotions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if promotionStep(sorted[i]) != promotionStep(sorted[j]) {
+			return promotionStep(sorted[i]) < promotionStep(sorted[j])
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	order.Discounts = []models.OrderDiscount{}
+	order.DiscountAmount = 0
+	for _, promotion := range sorted {
+		discounts := make([]float64, len(lines))
+		switch promotionStep(promotion) {
+		case 0:
+			buyXGetYDiscounts(promotion, lines, discounts)
+		case 1:
+			lineDiscounts(promotion, lines, discounts)
+		default:
+			orderDiscounts(promotion, lines, discounts)
+		}
+
+		if amount := takeDiscounts(lines, discounts); amount > 0 {
+			order.Discounts = append(order.Discounts, models.OrderDiscount{
+				PromotionID: promotion.ID, Name: promotion.Name, Code: promotion.Code, Amount: amount,
+			})
+			order.DiscountAmount += amount
+		}
+	}
+	order.DiscountAmount = utils.RoundMoney(order.DiscountAmount)
+
+	return order, lines
+}
+
+// takeDiscounts вычитает скидки из позиций (не больше их остатка) и возвращает их сумму
+func takeDiscounts(lines []pricedLine, discounts []float64) float64 {
+	var amount float64
+	for i, discount := range discounts {
+		discount = math.Min(utils.RoundMoney(discount), lines[i].Amount)
+		lines[i].Amount = utils.RoundMoney(lines[i].Amount - discount)
+		amount += discount
+	}
+	return utils.RoundMoney(amount)
+}
+
+// promotionMatches сообщает, относится ли акция к позиции (по позиции меню и категории)
+func promotionMatches(promotion models.Promotion, line pricedLine) bool {
+	if promotion.MenuItemID != 0 && promotion.MenuItemID != line.ProductID {
+		return false
+	}
+	return promotion.Category == "" || slices.Contains(line.Categories, promotion.Category)
+}
+
+// lineDiscounts — процент или фиксированная сумма с каждой единицы подходящих позиций
+func lineDiscounts(promotion models.Promotion, lines []pricedLine, discounts []float64) {
+	for i, line := range lines {
+		if !promotionMatches(promotion, line) {
+			continue
+		}
+		if promotion.Type == models.PromotionPercentage {
+			discounts[i] = line.Amount * promotion.Value / 100
+		} else {
+			discounts[i] = promotion.Value * line.Quantity
+		}
+	}
+}
+
+// orderDiscounts — процент или фиксированная сумма со всего заказа; фиксированная
+// скидка распределяется по позициям пропорционально их стоимости
+func orderDiscounts(promotion models.Promotion, lines []pricedLine, discounts []float64) {
+	if promotion.Type == models.PromotionPercentage {
+		for i, line := range lines {
+			discounts[i] = line.Amount * promotion.Value / 100
+		}
+		return
+	}
+
+	var base float64
+	last := -1
+	for i, line := range lines {
+		if line.Amount > 0 {
+			base += line.Amount
+			last = i
+		}
+	}
+	if last < 0 {
+		return
+	}
+
+	total := math.Min(promotion.Value, base)
+	var given float64
+	for i, line := range lines {
+		if line.Amount <= 0 {
+			continue
+		}
+		if i == last {
+			discounts[i] = utils.RoundMoney(total - given)
+			break
+		}
+		discounts[i] = utils.RoundMoney(total * line.Amount / base)
+		given += discounts[i]
+	}
+}
+
+// buyXGetYDiscounts — из каждых buy+get подходящих единиц get самых дешёвых бесплатно.
+// Считаются только целые единицы; при равной цене раньше бесплатной становится
+// единица из позиции, стоящей в заказе раньше.
+func buyXGetYDiscounts(promotion models.Promotion, lines []pricedLine, discounts []float64) {
+	type unit struct {
+		line  int
+		price float64
+	}
+	var units []unit
+	for i, line := range lines {
+		if !promotionMatches(promotion, line) || line.Quantity < 1 {
+			continue
+		}
+		price := line.Amount / line.Quantity
+		for n := 0; n < int(line.Quantity); n++ {
+			units = append(units, unit{line: i, price: price})
+		}
+	}
+
+	sort.SliceStable(units, func(i, j int) bool { return units[i].price < units[j].price })
+
+	free := len(units) / (promotion.BuyQuantity + promotion.GetQuantity) * promotion.GetQuantity
+	for _, u := range units[:free] {
+		discounts[u.line] += u.price
+	}
+}
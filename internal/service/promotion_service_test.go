@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+
+	"frappuccino/models"
+)
+
+func TestApplyDiscounts(t *testing.T) {
+	lines := func() []pricedLine {
+		return []pricedLine{
+			{ProductID: 1, Categories: []string{"coffee"}, Quantity: 2, Amount: 8},
+			{ProductID: 2, Categories: []string{"pastry"}, Quantity: 1, Amount: 2},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		promotions   []models.Promotion
+		wantDiscount float64
+		wantAmounts  []float64
+	}{
+		{
+			name:         "order percentage",
+			promotions:   []models.Promotion{{ID: 1, Type: models.PromotionPercentage, Value: 10}},
+			wantDiscount: 1,
+			wantAmounts:  []float64{7.2, 1.8},
+		},
+		{
+			name:         "fixed per unit of a category",
+			promotions:   []models.Promotion{{ID: 1, Type: models.PromotionFixed, Value: 0.5, Category: "coffee"}},
+			wantDiscount: 1,
+			wantAmounts:  []float64{7, 2},
+		},
+		{
+			name:         "fixed order discount split by amount",
+			promotions:   []models.Promotion{{ID: 1, Type: models.PromotionFixed, Value: 1}},
+			wantDiscount: 1,
+			wantAmounts:  []float64{7.2, 1.8},
+		},
+		{
+			name:         "fixed order discount capped by total",
+			promotions:   []models.Promotion{{ID: 1, Type: models.PromotionFixed, Value: 50}},
+			wantDiscount: 10,
+			wantAmounts:  []float64{0, 0},
+		},
+		{
+			name:         "buy 2 get 1: cheapest unit free",
+			promotions:   []models.Promotion{{ID: 1, Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			wantDiscount: 2,
+			wantAmounts:  []float64{8, 0},
+		},
+		{
+			// процент от заказа считается после скидки на позицию, хотя id акции меньше
+			name: "line discount before order discount",
+			promotions: []models.Promotion{
+				{ID: 1, Type: models.PromotionPercentage, Value: 50},
+				{ID: 2, Type: models.PromotionFixed, Value: 2, MenuItemID: 2},
+			},
+			wantDiscount: 6, // 2 + 50% от 8
+			wantAmounts:  []float64{4, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, got := applyDiscounts(models.Order{}, lines(), tt.promotions)
+			if order.DiscountAmount != tt.wantDiscount {
+				t.Errorf("discount = %v, want %v", order.DiscountAmount, tt.wantDiscount)
+			}
+			for i, line := range got {
+				if line.Amount != tt.wantAmounts[i] {
+					t.Errorf("line %d amount = %v, want %v", i, line.Amount, tt.wantAmounts[i])
+				}
+			}
+		})
+	}
+}
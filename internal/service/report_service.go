@@ -11,6 +11,11 @@ import (
 
 type ReportServiceInterface interface {
 	GetTotalSales() (float64, error)
+	GetTaxTotals() (models.TaxReport, error)
+	GetDiscountTotals() (models.DiscountReport, error)
+	GetPriceConsistency() (models.PriceConsistencyReport, error)
+	GetGiftCardLiability() (models.GiftCardLiability, error)
+	GetItemRevenue() (models.ItemRevenueReport, error)
 	GetPopularItems() ([]models.MenuItem, error)
 	GetOrderedItemsByPeriod(period string, month string, year int) ([]models.OrderItemReport, error)
 	Search(q string, filters []string, minPrice int, maxPrice int) (models.SearchResult, error)
@@ -35,6 +40,46 @@ func (r ReportService) GetTotalSales() (float64, error) {
 	return totalSales, nil
 }
 
+func (s ReportService) GetTaxTotals() (models.TaxReport, error) {
+	report, err := s.reportRepo.TaxTotals()
+	if err != nil {
+		return models.TaxReport{}, fmt.Errorf("error getting tax totals: %v", err)
+	}
+	return report, nil
+}
+
+func (s ReportService) GetDiscountTotals() (models.DiscountReport, error) {
+	report, err := s.reportRepo.DiscountTotals()
+	if err != nil {
+		return models.DiscountReport{}, fmt.Errorf("error getting discount totals: %v", err)
+	}
+	return report, nil
+}
+
+func (s ReportService) GetPriceConsistency() (models.PriceConsistencyReport, error) {
+	report, err := s.reportRepo.PriceConsistency()
+	if err != nil {
+		return models.PriceConsistencyReport{}, fmt.Errorf("error checking order prices: %v", err)
+	}
+	return report, nil
+}
+
+func (s ReportService) GetGiftCardLiability() (models.GiftCardLiability, error) {
+	report, err := s.reportRepo.GiftCardLiability()
+	if err != nil {
+		return models.GiftCardLiability{}, fmt.Errorf("error getting gift card liability: %v", err)
+	}
+	return report, nil
+}
+
+func (s ReportService) GetItemRevenue() (models.ItemRevenueReport, error) {
+	report, err := s.reportRepo.ItemRevenue()
+	if err != nil {
+		return models.ItemRevenueReport{}, fmt.Errorf("error getting item revenue: %v", err)
+	}
+	return report, nil
+}
+
 func (s ReportService) GetPopularItems() ([]models.MenuItem, error) {
 	return s.reportRepo.GetPopularItems()
 }
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"frappuccino/utils"
+)
+
+// TaxSettings — как считаются налоги заказа (TAX_INCLUSIVE и TAX_ROUNDING)
+type TaxSettings struct {
+	Inclusive bool   // цены меню уже включают налог
+	Rounding  string // models.TaxRoundingOrder или models.TaxRoundingLine
+}
+
+type TaxServiceInterface interface {
+	GetTaxRates() ([]models.TaxRate, error)
+	CreateTaxRate(rate models.TaxRate) (models.TaxRate, error)
+	DeleteTaxRate(id int) error
+}
+
+type TaxService struct {
+	taxRepo dal.TaxRepositoryInterface
+}
+
+func NewTaxService(_taxRepo dal.TaxRepositoryInterface) TaxService {
+	return TaxService{taxRepo: _taxRepo}
+}
+
+func (s TaxService) GetTaxRates() ([]models.TaxRate, error) {
+	return s.taxRepo.LoadTaxRates()
+}
+
+func (s TaxService) CreateTaxRate(rate models.TaxRate) (models.TaxRate, error) {
+	rate.Name = strings.TrimSpace(rate.Name)
+	if err := validateTaxRate(rate); err != nil {
+		return models.TaxRate{}, err
+	}
+
+	newRate, err := s.taxRepo.AddTaxRate(rate)
+	if err != nil {
+		return models.TaxRate{}, err
+	}
+	log.Printf("tax rate added: %d (%s %s %s %.4f)", newRate.ID, newRate.TaxCategory, newRate.OrderType, newRate.Name, newRate.Rate)
+	return newRate, nil
+}
+
+func (s TaxService) DeleteTaxRate(id int) error {
+	if err := s.taxRepo.DeleteTaxRate(id); err != nil {
+		return err
+	}
+	log.Printf("tax rate deleted: %d", id)
+	return nil
+}
+
+func validateTaxRate(rate models.TaxRate) error {
+	if err := utils.ValidateTaxCategory(rate.TaxCategory); err != nil {
+		return fmt.Errorf("%w: invalid tax category: %v", utils.ErrValidation, err)
+	}
+	if err := validateOrderType(rate.OrderType); err != nil {
+		return err
+	}
+	if rate.Name == "" || len(rate.Name) > 50 {
+		return fmt.Errorf("%w: tax name must be between 1 and 50 characters", utils.ErrValidation)
+	}
+	if rate.Rate < 0 || rate.Rate >= 1 {
+		return fmt.Errorf("%w: rate must be a fraction between 0 and 1 (0.12 for 12%%)", utils.ErrValidation)
+	}
+	return nil
+}
+
+func validateOrderType(orderType string) error {
+	if orderType != models.OrderTypeDineIn && orderType != models.OrderTypeTakeaway {
+		return fmt.Errorf("%w: unknown order type %q, expected dine_in or takeaway", utils.ErrValidation, orderType)
+	}
+	return nil
+}
+
+// pricedLine — позиция заказа при расчёте суммы: Amount — стоимость после скидок
+type pricedLine struct {
+	ProductID   int
+	Categories  []string
+	TaxCategory string
+	Quantity    float64
+	Amount      float64
+	// TaxShares — доли стоимости набора по налоговым категориям его компонентов;
+	// nil — вся стоимость облагается по TaxCategory
+	TaxShares map[string]float64
+}
+
+// bundleTaxShares делит стоимость набора между налоговыми категориями компонентов
+// пропорционально их ценам в меню и количеству в слоте
+func bundleTaxShares(components []models.BundleComponent) map[string]float64 {
+	var total float64
+	for _, component := range components {
+		total += component.Price * float64(component.Quantity)
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	shares := make(map[string]float64)
+	for _, component := range components {
+		shares[component.TaxCategory] += component.Price * float64(component.Quantity) / total
+	}
+	return shares
+}
+
+// applyTaxes считает строки налогов и итог заказа по стоимости позиций после скидок.
+// К позиции применяются все ставки её налоговой категории для типа заказа, стоимость
+// набора делится между категориями компонентов (TaxShares). При
+// включённом в цену налоге база — цена без налога (amount / (1 + сумма ставок)) и налог
+// сверху не добавляется. Округление до копеек — по заказу целиком или по позициям.
+func applyTaxes(order models.Order, lines []pricedLine, rates []models.TaxRate, settings TaxSettings) models.Order {
+	byCategory := make(map[string][]models.TaxRate)
+	for _, rate := range rates {
+		if rate.OrderType == order.OrderType {
+			byCategory[rate.TaxCategory] = append(byCategory[rate.TaxCategory], rate)
+		}
+	}
+
+	perLine := settings.Rounding == models.TaxRoundingLine
+	round := func(amount float64) float64 {
+		if perLine {
+			return utils.RoundMoney(amount)
+		}
+		return amount
+	}
+
+	taxes := []models.OrderTax{}
+	index := make(map[string]int)
+	var net float64
+	for _, line := range lines {
+		net += line.Amount
+
+		shares := line.TaxShares
+		if len(shares) == 0 {
+			shares = map[string]float64{line.TaxCategory: 1}
+		}
+		categories := slices.Sorted(maps.Keys(shares))
+		for _, category := range categories {
+			applicable := byCategory[category]
+			base := line.Amount * shares[category]
+			if settings.Inclusive {
+				combined := 0.0
+				for _, rate := range applicable {
+					combined += rate.Rate
+				}
+				base /= 1 + combined
+			}
+
+			for _, rate := range applicable {
+				key := fmt.Sprintf("%s|%.4f", rate.Name, rate.Rate)
+				i, ok := index[key]
+				if !ok {
+					i = len(taxes)
+					index[key] = i
+					taxes = append(taxes, models.OrderTax{Name: rate.Name, Rate: rate.Rate})
+				}
+				taxes[i].TaxableAmount += round(base)
+				taxes[i].Amount += round(base * rate.Rate)
+			}
+		}
+	}
+
+	order.TaxAmount = 0
+	for i := range taxes {
+		taxes[i].TaxableAmount = utils.RoundMoney(taxes[i].TaxableAmount)
+		taxes[i].Amount = utils.RoundMoney(taxes[i].Amount)
+		order.TaxAmount += taxes[i].Amount
+	}
+	order.TaxAmount = utils.RoundMoney(order.TaxAmount)
+	order.Taxes = taxes
+	order.TaxInclusive = settings.Inclusive
+
+	order.TotalAmount = utils.RoundMoney(net)
+	if !settings.Inclusive {
+		order.TotalAmount = utils.RoundMoney(net + order.TaxAmount)
+	}
+	return order
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"frappuccino/models"
+)
+
+func TestApplyTaxes(t *testing.T) {
+	rates := []models.TaxRate{
+		{TaxCategory: "drinks", OrderType: models.OrderTypeDineIn, Name: "VAT", Rate: 0.05},
+		{TaxCategory: "drinks", OrderType: models.OrderTypeTakeaway, Name: "VAT", Rate: 0.10},
+		{TaxCategory: "food", OrderType: models.OrderTypeDineIn, Name: "VAT", Rate: 0.10},
+	}
+	// три позиции по 1.05: налог с каждой 0.0525
+	threeDrinks := []pricedLine{
+		{TaxCategory: "drinks", Quantity: 1, Amount: 1.05},
+		{TaxCategory: "drinks", Quantity: 1, Amount: 1.05},
+		{TaxCategory: "drinks", Quantity: 1, Amount: 1.05},
+	}
+
+	tests := []struct {
+		name      string
+		orderType string
+		lines     []pricedLine
+		settings  TaxSettings
+		wantTax   float64
+		wantTotal float64
+	}{
+		{
+			name:      "order rounding",
+			orderType: models.OrderTypeDineIn,
+			lines:     threeDrinks,
+			settings:  TaxSettings{Rounding: models.TaxRoundingOrder},
+			wantTax:   0.16, // 0.1575
+			wantTotal: 3.31,
+		},
+		{
+			name:      "line rounding",
+			orderType: models.OrderTypeDineIn,
+			lines:     threeDrinks,
+			settings:  TaxSettings{Rounding: models.TaxRoundingLine},
+			wantTax:   0.15, // 3 × 0.05
+			wantTotal: 3.30,
+		},
+		{
+			name:      "rates of the order type",
+			orderType: models.OrderTypeTakeaway,
+			lines:     []pricedLine{{TaxCategory: "drinks", Quantity: 1, Amount: 2}},
+			settings:  TaxSettings{Rounding: models.TaxRoundingOrder},
+			wantTax:   0.20,
+			wantTotal: 2.20,
+		},
+		{
+			name:      "inclusive",
+			orderType: models.OrderTypeDineIn,
+			lines:     []pricedLine{{TaxCategory: "food", Quantity: 1, Amount: 1.10}},
+			settings:  TaxSettings{Inclusive: true, Rounding: models.TaxRoundingOrder},
+			wantTax:   0.10,
+			wantTotal: 1.10,
+		},
+		{
+			name:      "bundle split by component category",
+			orderType: models.OrderTypeDineIn,
+			lines: []pricedLine{{
+				TaxCategory: "drinks", Quantity: 1, Amount: 4,
+				TaxShares: map[string]float64{"drinks": 0.5, "food": 0.5},
+			}},
+			settings:  TaxSettings{Rounding: models.TaxRoundingOrder},
+			wantTax:   0.30, // 2 × 5% + 2 × 10%
+			wantTotal: 4.30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := applyTaxes(models.Order{OrderType: tt.orderType}, tt.lines, rates, tt.settings)
+			if order.TaxAmount != tt.wantTax {
+				t.Errorf("tax = %v, want %v", order.TaxAmount, tt.wantTax)
+			}
+			if order.TotalAmount != tt.wantTotal {
+				t.Errorf("total = %v, want %v", order.TotalAmount, tt.wantTotal)
+			}
+		})
+	}
+}
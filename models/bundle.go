@@ -0,0 +1,57 @@
+package models
+
+// BundleSlot — слот комбо-набора: позиция по умолчанию и замены на выбор гостя.
+// Набор продаётся по цене своей позиции меню, ингредиенты списываются по компонентам.
+type BundleSlot struct {
+	ID        int            `json:"slot_id"`
+	BundleID  int            `json:"bundle_id"`
+	Name      string         `json:"name"`
+	ProductID int            `json:"product_id"` // Позиция по умолчанию
+	Quantity  int            `json:"quantity"`
+	Choices   []BundleChoice `json:"choices,omitempty"`
+}
+
+// BundleChoice — позиция, которую гость может выбрать в слоте вместо позиции по умолчанию
+type BundleChoice struct {
+	ProductID  int     `json:"product_id"`
+	PriceDelta float64 `json:"price_delta"`
+}
+
+// BundleComponent — компонент набора, выбранный при расчёте позиции заказа. Состав
+// хранится в customizations позиции, так что списание, возвраты и отчёты не зависят
+// от последующих правок слотов набора.
+type BundleComponent struct {
+	SlotID      int     `json:"slot_id"`
+	ProductID   int     `json:"product_id"`
+	Quantity    int     `json:"quantity"`
+	Price       float64 `json:"price"` // Цена компонента в меню при расчёте — вес его доли в выручке и налоге
+	TaxCategory string  `json:"tax_category"`
+}
+
+// ComponentOf возвращает позицию, выбранную в слоте: замену из choices или позицию по умолчанию
+func (s BundleSlot) ComponentOf(choices map[int]int) int {
+	if productID, ok := choices[s.ID]; ok && productID != 0 {
+		return productID
+	}
+	return s.ProductID
+}
+
+// ItemRevenue — выручка позиции меню: продажи самой позиции и доля выручки
+// наборов, в которые она входила
+type ItemRevenue struct {
+	ProductID     int     `json:"product_id"`
+	Name          string  `json:"name"`
+	Quantity      int     `json:"quantity"`        // Продано штук, включая штуки в наборах
+	BundleUnits   int     `json:"bundle_quantity"` // Из них в составе наборов
+	DirectRevenue float64 `json:"direct_revenue"`
+	BundleRevenue float64 `json:"bundle_revenue"`
+	TotalRevenue  float64 `json:"total_revenue"`
+}
+
+// ItemRevenueReport — выручка закрытых заказов по позициям (за вычетом возвратов,
+// до скидок на заказ). Выручка набора делится между компонентами пропорционально
+// их ценам в меню на момент расчёта позиции, сами наборы в отчёт не попадают.
+type ItemRevenueReport struct {
+	TotalRevenue float64       `json:"total_revenue"`
+	Items        []ItemRevenue `json:"items"`
+}
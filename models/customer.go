@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type Customer struct {
+	ID          int            `json:"customer_id"`
+	Name        string         `json:"name"`
+	Phone       string         `json:"phone,omitempty"`
+	Email       string         `json:"email,omitempty"`
+	Preferences map[string]any `json:"preferences"` // Например {"milk": "oat", "sugar": "no sugar"}
+	Version     int            `json:"version"`     // Растёт при каждом изменении, отдаётся как ETag
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// FavoriteItem — позиция меню, которую клиент заказывает чаще всего
+type FavoriteItem struct {
+	ProductID int     `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  float64 `json:"quantity"`
+}
+
+// CustomerOrders — заказы клиента с итогами (GET /customers/{id}/orders)
+type CustomerOrders struct {
+	CustomerID    int            `json:"customer_id"`
+	OrderCount    int            `json:"order_count"` // Без отменённых
+	TotalSpent    float64        `json:"total_spent"` // Закрытые заказы за вычетом возвратов
+	FavoriteItems []FavoriteItem `json:"favorite_items"`
+	Orders        []Order        `json:"orders"`
+}
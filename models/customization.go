@@ -0,0 +1,32 @@
+package models
+
+// OrderItemCustomizations хранится в order_items.customizations (JSONB)
+type OrderItemCustomizations struct {
+	Size          string                   `json:"size,omitempty"` // small / medium / large — краткая запись размерного варианта
+	Substitutions []IngredientSubstitution `json:"substitutions,omitempty"`
+	Extras        map[string]int           `json:"extras,omitempty"`         // код добавки → количество
+	Modifiers     []int                    `json:"modifiers,omitempty"`      // ID выбранных модификаторов
+	BundleChoices map[int]int              `json:"bundle_choices,omitempty"` // ID слота набора → ID выбранной позиции
+	// Состав набора на момент расчёта; заполняет сервер, присланное клиентом не учитывается
+	BundleComponents []BundleComponent `json:"bundle_components,omitempty"`
+}
+
+// IngredientSubstitution — замена ингредиента рецепта (например, молоко → овсяное молоко)
+type IngredientSubstitution struct {
+	IngredientID int `json:"ingredient_id"`
+	SubstituteID int `json:"substitute_id"`
+}
+
+type IngredientSubstitute struct {
+	IngredientID int     `json:"ingredient_id"`
+	SubstituteID int     `json:"substitute_id"`
+	PriceDelta   float64 `json:"price_delta"`
+}
+
+type MenuExtra struct {
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	IngredientID int     `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+	PriceDelta   float64 `json:"price_delta"`
+}
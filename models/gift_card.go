@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Типы записей журнала подарочной карты (gift_card_entry_type в БД)
+const (
+	GiftCardEntryIssue  = "issue"
+	GiftCardEntryTopUp  = "top_up"
+	GiftCardEntryRedeem = "redeem" // оплата заказа, сумма отрицательная
+	GiftCardEntryRefund = "refund" // возврат оплаты заказа на карту
+)
+
+type GiftCard struct {
+	ID            int             `json:"gift_card_id"`
+	Code          string          `json:"code"` // Пустой при выпуске — код сгенерирует сервер
+	InitialAmount float64         `json:"initial_amount"`
+	Balance       float64         `json:"balance"`
+	CustomerID    int             `json:"customer_id,omitempty"`
+	ExpiresAt     *time.Time      `json:"expires_at,omitempty"`
+	Expired       bool            `json:"expired"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	Entries       []GiftCardEntry `json:"entries,omitempty"`
+}
+
+type GiftCardEntry struct {
+	ID        int       `json:"entry_id"`
+	Type      string    `json:"type"`
+	Amount    float64   `json:"amount"` // Отрицательная — оплата заказа
+	OrderID   int       `json:"order_id,omitempty"`
+	PaymentID int       `json:"payment_id,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GiftCardTopUp — тело POST /gift-cards/{code}/top-up
+type GiftCardTopUp struct {
+	Amount float64 `json:"amount"`
+	Notes  string  `json:"notes,omitempty"`
+}
+
+// GiftCardLiability — обязательства по подарочным картам: непотраченные остатки
+// действующих карт и остатки, сгоревшие вместе с картой
+type GiftCardLiability struct {
+	OutstandingCards   int        `json:"outstanding_cards"`
+	OutstandingBalance float64    `json:"outstanding_balance"`
+	ExpiredCards       int        `json:"expired_cards"`
+	ExpiredBalance     float64    `json:"expired_balance"`
+	Cards              []GiftCard `json:"cards"` // Действующие карты с остатком, крупные первыми
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// IdempotencyRecord — сохранённый ответ на запрос с заголовком Idempotency-Key
+type IdempotencyRecord struct {
+	Key          string
+	Endpoint     string
+	RequestHash  string
+	StatusCode   int
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
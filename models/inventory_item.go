@@ -3,10 +3,40 @@ package models
 import "time"
 
 type InventoryItem struct {
-	IngredientID     int       `json:"ingredient_id"`
-	Name             string    `json:"name"`
-	Quantity         float64   `json:"quantity"`
-	Unit             string    `json:"unit"`
-	ReorderThreshold *float64  `json:"reorder_threshold,omitempty"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	IngredientID     int                  `json:"ingredient_id"`
+	Name             string               `json:"name"`
+	Quantity         float64              `json:"quantity"`  // Остаток на складе
+	Reserved         float64              `json:"reserved"`  // Зарезервировано под незакрытые заказы
+	Available        float64              `json:"available"` // Можно использовать для новых заказов
+	Unit             string               `json:"unit"`
+	ReorderThreshold *float64             `json:"reorder_threshold,omitempty"`
+	Recipe           []MenuItemIngredient `json:"recipe,omitempty"`       // Рецепт заготовки на единицу, у сырья пусто
+	Allergens        []string             `json:"allergens,omitempty"`    // Из списка Allergens
+	DietaryTags      []string             `json:"dietary_tags,omitempty"` // Диеты из DietaryTags, которым ингредиент подходит
+	Version          int                  `json:"version"`                // Растёт при каждом изменении, отдаётся как ETag
+	UpdatedAt        time.Time            `json:"updated_at"`
+}
+
+// Allergens — аллергены, которые можно указать у ингредиента (14 основных пищевых аллергенов)
+var Allergens = []string{
+	"gluten", "crustaceans", "eggs", "fish", "peanuts", "soy", "dairy",
+	"nuts", "celery", "mustard", "sesame", "sulphites", "lupin", "molluscs",
+}
+
+// DietaryTags — диеты, которым может подходить ингредиент
+var DietaryTags = []string{"vegan", "vegetarian", "halal", "kosher"}
+
+// InventoryProduction — тело POST /inventory/{id}/produce: сколько заготовки приготовить
+type InventoryProduction struct {
+	Quantity float64 `json:"quantity"`
+	Notes    string  `json:"notes,omitempty"`
+}
+
+// ProductionResult — результат приготовления партии заготовки и списанное сырьё
+type ProductionResult struct {
+	IngredientID int               `json:"ingredient_id"`
+	Name         string            `json:"name"`
+	Produced     float64           `json:"produced"`
+	Remaining    float64           `json:"remaining"` // Остаток заготовки после партии
+	Consumed     []InventoryUpdate `json:"consumed"`
 }
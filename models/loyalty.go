@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Типы записей журнала баллов (loyalty_entry_type в БД)
+const (
+	LoyaltyEntryEarn    = "earn"    // начислено при закрытии заказа
+	LoyaltyEntryRedeem  = "redeem"  // списано в оплату заказа
+	LoyaltyEntryReverse = "reverse" // начисление отменено возвратом заказа
+	LoyaltyEntryRestore = "restore" // возвращены баллы, которыми был оплачен возвращённый заказ
+	LoyaltyEntryExpire  = "expire"  // сгорели по сроку
+)
+
+// LoyaltyRule — правило начисления баллов. Без category — points за каждую
+// единицу суммы, оплаченной деньгами; с category — points за каждую позицию категории.
+type LoyaltyRule struct {
+	ID        int       `json:"loyalty_rule_id"`
+	Name      string    `json:"name"`
+	Category  string    `json:"category,omitempty"`
+	Points    float64   `json:"points"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoyaltyEntry struct {
+	ID        int        `json:"entry_id"`
+	OrderID   int        `json:"order_id,omitempty"`
+	PaymentID int        `json:"payment_id,omitempty"`
+	Type      string     `json:"type"`
+	Points    int        `json:"points"`              // Отрицательные — списание
+	Remaining int        `json:"remaining,omitempty"` // Непотраченный остаток начисления
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Notes     string     `json:"notes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CustomerLoyalty — баланс и журнал баллов клиента (GET /customers/{id}/loyalty)
+type CustomerLoyalty struct {
+	CustomerID   int            `json:"customer_id"`
+	Balance      int            `json:"balance"`
+	BalanceValue float64        `json:"balance_value"` // Сколько можно оплатить баллами
+	PointValue   float64        `json:"point_value"`
+	NextExpiry   *time.Time     `json:"next_expiry,omitempty"`
+	Expiring     int            `json:"expiring_points,omitempty"` // Сгорят в next_expiry
+	Entries      []LoyaltyEntry `json:"entries"`
+}
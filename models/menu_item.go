@@ -3,17 +3,48 @@ package models
 import "time"
 
 type MenuItem struct {
-	ID          int                  `json:"product_id"`
-	Name        string               `json:"name"`
-	Description string               `json:"description"`
+	ID             int                  `json:"product_id"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	Price          float64              `json:"price"`
+	Categories     []string             `json:"categories,omitempty"`
+	TaxCategory    string               `json:"tax_category,omitempty"` // Ключ ставок в tax_rates, по умолчанию drinks
+	Ingredients    []MenuItemIngredient `json:"ingredients"`
+	Variants       []MenuItemVariant    `json:"variants,omitempty"`
+	ModifierGroups []ModifierGroup      `json:"modifier_groups,omitempty"`
+	BundleSlots    []BundleSlot         `json:"bundle_slots,omitempty"` // Непустой у комбо-набора
+	SoldOut        bool                 `json:"sold_out"`               // Снята с продажи вручную
+	// Allergens и DietaryTags сводятся из ингредиентов рецепта (и компонентов набора) при чтении меню
+	Allergens   []string `json:"allergens,omitempty"`
+	DietaryTags []string `json:"dietary_tags,omitempty"`
+	// Available и MaxPortions считаются по складу при чтении меню; MaxPortions нет —
+	// склад позицию не ограничивает (у неё нет рецепта)
+	Available   *bool     `json:"available,omitempty"`
+	MaxPortions *int      `json:"max_portions,omitempty"`
+	Version     int       `json:"version"` // Растёт при каждом изменении, отдаётся как ETag
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type MenuItemIngredient struct {
+	IngredientID int     `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+}
+
+// MenuItemVariant — размер позиции меню со своей ценой и рецептом
+type MenuItemVariant struct {
+	ID          int                  `json:"variant_id"`
+	MenuItemID  int                  `json:"product_id"`
+	Size        string               `json:"size"`
 	Price       float64              `json:"price"`
-	Categories  []string             `json:"categories,omitempty"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
 	CreatedAt   time.Time            `json:"created_at"`
 	UpdatedAt   time.Time            `json:"updated_at"`
 }
 
-type MenuItemIngredient struct {
-	IngredientID int     `json:"ingredient_id"`
-	Quantity     float64 `json:"quantity"`
+// MenuFilter — фильтры GET /menu
+type MenuFilter struct {
+	OnlyAvailable    bool     // ?available=true — только то, что можно заказать сейчас
+	ExcludeAllergens []string // ?excludeAllergens=nuts,dairy — без этих аллергенов
+	Diets            []string // ?diet=vegan — подходит всем перечисленным диетам
 }
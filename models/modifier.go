@@ -0,0 +1,22 @@
+package models
+
+// ModifierGroup — группа модификаторов позиции меню с правилами выбора
+type ModifierGroup struct {
+	ID            int        `json:"group_id"`
+	MenuItemID    int        `json:"product_id"`
+	Name          string     `json:"name"`
+	Required      bool       `json:"required"`
+	MinSelections int        `json:"min_selections"`
+	MaxSelections int        `json:"max_selections"`
+	Modifiers     []Modifier `json:"modifiers"`
+}
+
+// Modifier — вариант выбора внутри группы. IngredientID == 0 — без расхода инвентаря
+type Modifier struct {
+	ID           int     `json:"modifier_id"`
+	GroupID      int     `json:"group_id"`
+	Name         string  `json:"name"`
+	PriceDelta   float64 `json:"price_delta"`
+	IngredientID int     `json:"ingredient_id,omitempty"`
+	Quantity     float64 `json:"quantity,omitempty"`
+}
@@ -4,46 +4,107 @@ import (
 	"time"
 )
 
+// Статусы заказа (order_status в БД)
+const (
+	OrderStatusOpen       = "open"
+	OrderStatusInProgress = "in_progress"
+	OrderStatusReady      = "ready"
+	OrderStatusClosed     = "closed"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+)
+
 type Order struct {
 	ID                  int               `json:"order_id"`
 	CustomerName        string            `json:"customer_name"`
+	CustomerID          int               `json:"customer_id,omitempty"` // Постоянный клиент; без него — гость
 	Status              string            `json:"status"`
-	TotalAmount         float64           `json:"total_amount,omitempty"`
+	OrderType           string            `json:"order_type,omitempty"`        // dine_in (по умолчанию) или takeaway
+	Subtotal            float64           `json:"subtotal"`                    // Сумма позиций
+	PromoCode           string            `json:"promo_code,omitempty"`        // Купон, введённый гостем
+	RemovePromoCode     bool              `json:"remove_promo_code,omitempty"` // В PUT /orders/{id}: снять купон с заказа
+	RedeemPoints        *int              `json:"redeem_points,omitempty"`     // Баллы клиента в счёт скидки; в PUT 0 — отказаться от них
+	Discounts           []OrderDiscount   `json:"discounts"`
+	DiscountAmount      float64           `json:"discount_amount"`
+	Taxes               []OrderTax        `json:"taxes"`
+	TaxAmount           float64           `json:"tax_amount"`
+	TaxInclusive        bool              `json:"tax_inclusive"`          // Налог уже входит в цены позиций
+	TotalAmount         float64           `json:"total_amount,omitempty"` // Итог к оплате
 	SpecialInstructions map[string]string `json:"special_instructions,omitempty"`
 	Items               []OrderItem       `json:"items"`
+	Payments            []Payment         `json:"payments,omitempty"` // Только в batch-process: оплаты, записываемые перед закрытием
+	Version             int               `json:"version"`            // Растёт при каждом изменении, отдаётся как ETag
 	CreatedAt           time.Time         `json:"created_at"`
 	UpdatedAt           time.Time         `json:"updated_at"`
 }
 
 type OrderItem struct {
-	ProductID int     `json:"product_id"`
-	Quantity  float64 `json:"quantity"`
-	Price     float64
+	ID             int                     `json:"item_id,omitempty"`
+	ProductID      int                     `json:"product_id"`
+	VariantID      int                     `json:"variant_id,omitempty"` // Размерный вариант позиции меню
+	Quantity       float64                 `json:"quantity"`
+	Price          float64                 // Цена за единицу с учётом размера, замен и добавок
+	Customizations OrderItemCustomizations `json:"customizations"`
+	PricingRuleID  int                     `json:"pricing_rule_id,omitempty"` // Правило цены, действовавшее при расчёте
+	PricingRule    string                  `json:"pricing_rule,omitempty"`    // Его название (остаётся после удаления правила)
+	PricedAt       time.Time               `json:"priced_at"`                 // Когда цена позиции последний раз пересчитывалась
+}
+
+// OrderItemPatch — частичное изменение позиции (PATCH /orders/{id}/items/{itemId})
+type OrderItemPatch struct {
+	Quantity       *float64                 `json:"quantity,omitempty"`
+	VariantID      *int                     `json:"variant_id,omitempty"`
+	Customizations *OrderItemCustomizations `json:"customizations,omitempty"`
+}
+
+// OrderStatusChange — кто и почему меняет статус заказа,
+// записывается в order_status_history
+// MaxActorLength — наибольшая длина actor (order_status_history.changed_by)
+const MaxActorLength = 50
+
+type OrderStatusChange struct {
+	Actor string `json:"actor,omitempty"`
+	Notes string `json:"notes,omitempty"`
 }
 
+// Режимы пакетной обработки заказов (POST /orders/batch-process)
+const (
+	BatchModeAllOrNothing = "all_or_nothing" // все заказы в одной транзакции: либо все приняты, либо ни один
+	BatchModeBestEffort   = "best_effort"    // каждый заказ принимается или отклоняется отдельно
+	BatchModeDryRun       = "dry_run"        // проверка по текущему инвентарю без записи в базу
+)
+
 type BulkOrderRequest struct {
+	Mode   string  `json:"mode,omitempty"` // по умолчанию best_effort
 	Orders []Order `json:"orders"`
 }
 
 type BulkOrderResponse struct {
-	ProcessedOrders []struct {
-		ID           int     `json:"order_id"`
-		CustomerName string  `json:"customer_name"`
-		Status       string  `json:"status"`
-		TotalAmount  float64 `json:"total,omitempty"`  // Может отсутствовать, если заказ отклонён
-		Reason       string  `json:"reason,omitempty"` // Причина отклонения
-	} `json:"processed_orders"`
+	ProcessedOrders []ProcessedOrder `json:"processed_orders"`
 
 	Summary struct {
-		TotalOrders      int     `json:"total_orders"`
-		Accepted         int     `json:"accepted"`
-		Rejected         int     `json:"rejected"`
-		TotalRevenue     float64 `json:"total_revenue"`
-		InventoryUpdates []struct {
-			IngredientID int     `json:"ingredient_id"`
-			Name         string  `json:"name"`
-			QuantityUsed float64 `json:"quantity_used"`
-			Remaining    float64 `json:"remaining"`
-		} `json:"inventory_updates"`
+		Mode             string            `json:"mode"`
+		Committed        bool              `json:"committed"` // false для dry_run и отменённого all_or_nothing
+		TotalOrders      int               `json:"total_orders"`
+		Accepted         int               `json:"accepted"`
+		Rejected         int               `json:"rejected"`
+		TotalRevenue     float64           `json:"total_revenue"`
+		InventoryUpdates []InventoryUpdate `json:"inventory_updates"`
 	} `json:"summary"`
 }
+
+type ProcessedOrder struct {
+	ID           int     `json:"order_id,omitempty"` // Отсутствует для dry_run и отклонённых заказов
+	CustomerName string  `json:"customer_name"`
+	Status       string  `json:"status"`
+	TotalAmount  float64 `json:"total,omitempty"`  // Может отсутствовать, если заказ отклонён
+	Reason       string  `json:"reason,omitempty"` // Причина отклонения
+}
+
+// InventoryUpdate — расход ингредиента и остаток на складе после списания
+type InventoryUpdate struct {
+	IngredientID int     `json:"ingredient_id"`
+	Name         string  `json:"name"`
+	QuantityUsed float64 `json:"quantity_used"`
+	Remaining    float64 `json:"remaining"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type OrderStatusHistoryEntry struct {
+	ID              int       `json:"id"`
+	Status          string    `json:"status"`
+	Notes           string    `json:"notes,omitempty"`
+	ChangedBy       string    `json:"changed_by,omitempty"`
+	ChangedAt       time.Time `json:"changed_at"`
+	DurationSeconds float64   `json:"duration_seconds"` // Сколько заказ пробыл в этом статусе
+}
+
+type OrderStatusHistory struct {
+	OrderID            int                       `json:"order_id"`
+	Status             string                    `json:"status"`
+	History            []OrderStatusHistoryEntry `json:"history"`
+	TimeInStatus       map[string]float64        `json:"time_in_status_seconds"`
+	TimeToCloseSeconds *float64                  `json:"time_to_close_seconds,omitempty"` // Только для закрытых заказов
+}
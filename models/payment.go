@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Способы оплаты (payment_method в БД)
+const (
+	PaymentMethodCash     = "cash"
+	PaymentMethodCard     = "card"
+	PaymentMethodGiftCard = "gift_card"
+	PaymentMethodLoyalty  = "loyalty_points"
+	PaymentMethodOther    = "other"
+)
+
+type Payment struct {
+	ID        int       `json:"payment_id"`
+	OrderID   int       `json:"order_id"`
+	Method    string    `json:"method"`
+	Amount    float64   `json:"amount"`             // Зачтено в оплату заказа
+	Tendered  float64   `json:"tendered,omitempty"` // Сколько дал гость (только наличные)
+	Change    float64   `json:"change,omitempty"`   // Сдача (только наличные)
+	Reference string    `json:"reference,omitempty"`
+	Points    int       `json:"points,omitempty"` // Списано баллов (только loyalty_points)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderPayments — оплаты заказа и остаток к оплате
+type OrderPayments struct {
+	OrderID     int       `json:"order_id"`
+	TotalAmount float64   `json:"total_amount"`
+	Paid        float64   `json:"paid"`
+	Refunded    float64   `json:"refunded"`
+	Balance     float64   `json:"balance"` // Отрицательный — переплата
+	FullyPaid   bool      `json:"fully_paid"`
+	Payments    []Payment `json:"payments"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// ScheduledPriceChange — запланированная смена цены позиции меню
+type ScheduledPriceChange struct {
+	ID          int        `json:"price_change_id"`
+	ProductID   int        `json:"product_id"`
+	Price       float64    `json:"price"`
+	EffectiveAt time.Time  `json:"effective_at"`
+	Reason      string     `json:"reason"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"` // Пусто, пока изменение ждёт своего времени
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// PriceHistoryEntry — запись price_history
+type PriceHistoryEntry struct {
+	VariantID     int        `json:"variant_id,omitempty"` // 0 — базовая цена позиции
+	Price         float64    `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"` // Пусто у действующей цены
+	Reason        string     `json:"reason,omitempty"`
+}
+
+// PriceHistory — история цен позиции и ещё не применённые изменения
+type PriceHistory struct {
+	ProductID int                    `json:"product_id"`
+	History   []PriceHistoryEntry    `json:"history"`
+	Pending   []ScheduledPriceChange `json:"pending"`
+}
+
+// PriceAtTime — цена позиции (или её варианта), действовавшая в момент At
+type PriceAtTime struct {
+	ProductID int       `json:"product_id"`
+	VariantID int       `json:"variant_id,omitempty"`
+	At        time.Time `json:"at"`
+	Price     float64   `json:"price"`
+}
+
+// PriceMismatch — позиция заказа, цена которой не совпала с ценой меню на момент заказа
+type PriceMismatch struct {
+	OrderID       int       `json:"order_id"`
+	ItemID        int       `json:"item_id"`
+	ProductID     int       `json:"product_id"`
+	VariantID     int       `json:"variant_id,omitempty"`
+	OrderedAt     time.Time `json:"ordered_at"`
+	PricedAt      time.Time `json:"priced_at"` // Когда позиция последний раз пересчитывалась; с этим моментом и сверяется цена
+	Price         float64   `json:"price"`
+	ExpectedPrice *float64  `json:"expected_price"` // null — цена на тот момент неизвестна
+}
+
+// PriceConsistencyReport — сверка цен позиций заказов с price_history.
+// Позиции с кастомизациями или правилом цены не проверяются (skipped_items).
+type PriceConsistencyReport struct {
+	CheckedItems int             `json:"checked_items"`
+	SkippedItems int             `json:"skipped_items"`
+	Mismatches   []PriceMismatch `json:"mismatches"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// PricingRuleTimeLayout — формат start_time / end_time
+const PricingRuleTimeLayout = "15:04"
+
+// PricingRule меняет цену позиции по дням недели и в окне времени
+type PricingRule struct {
+	ID         int       `json:"pricing_rule_id"`
+	Name       string    `json:"name"`
+	MenuItemID int       `json:"product_id,omitempty"`  // Только для этой позиции меню
+	Category   string    `json:"category,omitempty"`    // Либо для позиций с этой категорией
+	DaysOfWeek []int     `json:"days_of_week"`          // ISO: 1 — понедельник … 7 — воскресенье; пусто — каждый день
+	StartTime  string    `json:"start_time"`            // "HH:MM" по часовому поясу кофейни
+	EndTime    string    `json:"end_time"`              // Раньше start_time — окно через полночь
+	PercentOff float64   `json:"percent_off,omitempty"` // Скидка от цены меню в процентах
+	FixedPrice float64   `json:"fixed_price,omitempty"` // Либо фиксированная цена
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AppliesAt сообщает, действует ли правило в момент at (at уже в часовом поясе кофейни).
+// Окно через полночь относится к дню, в который оно началось.
+func (r PricingRule) AppliesAt(at time.Time) bool {
+	start, err := time.Parse(PricingRuleTimeLayout, r.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(PricingRuleTimeLayout, r.EndTime)
+	if err != nil {
+		return false
+	}
+	startMin := start.Hour()*60 + start.Minute()
+	endMin := end.Hour()*60 + end.Minute()
+	nowMin := at.Hour()*60 + at.Minute()
+
+	day := at
+	switch {
+	case startMin < endMin:
+		if nowMin < startMin || nowMin >= endMin {
+			return false
+		}
+	case nowMin >= startMin:
+	case nowMin < endMin:
+		day = at.AddDate(0, 0, -1)
+	default:
+		return false
+	}
+
+	if len(r.DaysOfWeek) == 0 {
+		return true
+	}
+	weekday := int(day.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	return slices.Contains(r.DaysOfWeek, weekday)
+}
+
+// Apply возвращает цену с учётом правила
+func (r PricingRule) Apply(price float64) float64 {
+	if r.FixedPrice > 0 {
+		return r.FixedPrice
+	}
+	return price * (100 - r.PercentOff) / 100
+}
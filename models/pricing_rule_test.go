@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPricingRuleAppliesAt(t *testing.T) {
+	// 2026-01-02 — пятница (5), 2026-01-03 — суббота (6)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+	happyHour := PricingRule{StartTime: "15:00", EndTime: "17:00"}
+	fridayNight := PricingRule{DaysOfWeek: []int{5}, StartTime: "22:00", EndTime: "02:00"}
+	sundayNight := PricingRule{DaysOfWeek: []int{7}, StartTime: "23:00", EndTime: "01:00"}
+
+	tests := []struct {
+		name string
+		rule PricingRule
+		at   time.Time
+		want bool
+	}{
+		{"inside window", happyHour, at(2, 15, 30), true},
+		{"at start", happyHour, at(2, 15, 0), true},
+		{"end is exclusive", happyHour, at(2, 17, 0), false},
+		{"before window", happyHour, at(2, 14, 59), false},
+		{"overnight before midnight", fridayNight, at(2, 23, 0), true},
+		{"overnight after midnight belongs to start day", fridayNight, at(3, 1, 30), true},
+		{"overnight end is exclusive", fridayNight, at(3, 2, 0), false},
+		{"overnight gap", fridayNight, at(2, 12, 0), false},
+		{"overnight on another day", fridayNight, at(3, 23, 0), false},
+		{"after midnight of the previous day", fridayNight, at(2, 1, 0), false},
+		{"sunday night into monday", sundayNight, at(5, 0, 30), true},
+		{"invalid time", PricingRule{StartTime: "25:00", EndTime: "02:00"}, at(2, 23, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.AppliesAt(tt.at); got != tt.want {
+				t.Errorf("AppliesAt(%s) = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Типы акций (promotion_type в БД)
+const (
+	PromotionPercentage = "percentage"  // value — процент скидки
+	PromotionFixed      = "fixed"       // value — сумма скидки (на единицу позиции или на заказ)
+	PromotionBuyXGetY   = "buy_x_get_y" // из каждых buy+get единиц get самых дешёвых бесплатно
+)
+
+type Promotion struct {
+	ID          int        `json:"promotion_id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Value       float64    `json:"value,omitempty"`
+	MenuItemID  int        `json:"product_id,omitempty"` // Только для этой позиции меню
+	Category    string     `json:"category,omitempty"`   // Только для позиций с этой категорией
+	BuyQuantity int        `json:"buy_quantity,omitempty"`
+	GetQuantity int        `json:"get_quantity,omitempty"`
+	Code        string     `json:"code,omitempty"`        // Купон; без кода акция применяется автоматически
+	UsageLimit  int        `json:"usage_limit,omitempty"` // 0 — без ограничения
+	TimesUsed   int        `json:"times_used"`            // Заказы (кроме отменённых), получившие скидку
+	ValidFrom   *time.Time `json:"valid_from,omitempty"`
+	ValidTo     *time.Time `json:"valid_to,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Удалена: действует только в заказах, уже принявших купон
+}
+
+// ActiveAt сообщает, действует ли акция в момент at
+func (p Promotion) ActiveAt(at time.Time) bool {
+	if p.ValidFrom != nil && at.Before(*p.ValidFrom) {
+		return false
+	}
+	return p.ValidTo == nil || at.Before(*p.ValidTo)
+}
+
+// OrderDiscount — скидка по одной акции в заказе
+type OrderDiscount struct {
+	PromotionID int     `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Code        string  `json:"code,omitempty"`
+	Amount      float64 `json:"amount"`
+	Points      int     `json:"points,omitempty"` // Скидка баллами лояльности: сколько баллов она стоит
+}
+
+// DiscountTotal — сумма скидок по акции в отчёте
+type DiscountTotal struct {
+	PromotionID int     `json:"promotion_id,omitempty"` // 0 — акция удалена или скидка баллами
+	Name        string  `json:"name"`
+	Code        string  `json:"code,omitempty"`
+	Orders      int     `json:"orders"`
+	Amount      float64 `json:"amount"`
+}
+
+// DiscountReport — скидки по закрытым заказам за вычетом возвратов
+type DiscountReport struct {
+	Discounts     []DiscountTotal `json:"discounts"`
+	TotalDiscount float64         `json:"total_discount"`
+}
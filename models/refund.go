@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// RefundRequest — тело POST /orders/{id}/refund. Без items возвращается весь
+// ещё не возвращённый остаток заказа.
+type RefundRequest struct {
+	Items   []RefundItem `json:"items,omitempty"`
+	Restock bool         `json:"restock"` // true — ингредиенты на склад, false — в отходы
+	Reason  string       `json:"reason,omitempty"`
+	Actor   string       `json:"actor,omitempty"`
+}
+
+type RefundItem struct {
+	OrderItemID int     `json:"item_id"`
+	Quantity    float64 `json:"quantity"`
+	Amount      float64 `json:"amount,omitempty"` // Заполняется в ответе
+}
+
+// RefundPayment — часть возврата, проведённая по исходной оплате
+type RefundPayment struct {
+	PaymentID  int     `json:"payment_id"`
+	Method     string  `json:"method"`
+	Amount     float64 `json:"amount"`
+	Points     int     `json:"points,omitempty"`      // Возвращено баллов (оплата баллами)
+	RefundedAs string  `json:"refunded_as,omitempty"` // Чем возвращено, если не тем же способом
+}
+
+type Refund struct {
+	ID             int             `json:"refund_id"`
+	OrderID        int             `json:"order_id"`
+	Amount         float64         `json:"amount"` // 0 — заказ не был оплачен (аннулирование)
+	Restock        bool            `json:"restock"`
+	Reason         string          `json:"reason,omitempty"`
+	Actor          string          `json:"actor,omitempty"`
+	Items          []RefundItem    `json:"items"`
+	Payments       []RefundPayment `json:"payments"`
+	ReversedPoints int             `json:"reversed_points,omitempty"` // Списано баллов, начисленных за заказ
+	RestoredPoints int             `json:"restored_points,omitempty"` // Возвращено баллов, потраченных на скидку заказа
+	OrderStatus    string          `json:"order_status"`              // refunded, если возвращено всё
+	CreatedAt      time.Time       `json:"created_at"`
+}
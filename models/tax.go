@@ -0,0 +1,39 @@
+package models
+
+// Типы заказа (order_type в БД): от них зависят ставки налогов
+const (
+	OrderTypeDineIn   = "dine_in"
+	OrderTypeTakeaway = "takeaway"
+)
+
+// Налоговая категория позиции меню по умолчанию
+const DefaultTaxCategory = "drinks"
+
+// Правила округления налога (TAX_ROUNDING)
+const (
+	TaxRoundingOrder = "order" // налог округляется один раз по всему заказу
+	TaxRoundingLine  = "line"  // налог округляется по каждой позиции, затем суммируется
+)
+
+// TaxRate — ставка налога для категории позиций меню и типа заказа
+type TaxRate struct {
+	ID          int     `json:"tax_rate_id"`
+	TaxCategory string  `json:"tax_category"`
+	OrderType   string  `json:"order_type"`
+	Name        string  `json:"name"`
+	Rate        float64 `json:"rate"` // Доля: 0.12 — 12%
+}
+
+// OrderTax — строка налога в заказе
+type OrderTax struct {
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	Amount        float64 `json:"amount"`
+}
+
+// TaxReport — налоги по закрытым заказам за вычетом возвратов
+type TaxReport struct {
+	Taxes    []OrderTax `json:"taxes"`
+	TotalTax float64    `json:"total_tax"`
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 	"unicode/utf8"
 
@@ -48,13 +50,51 @@ func ValidateMenuItem(menuItem models.MenuItem) error {
 		return fmt.Errorf("%w: invalid price: %v", ErrValidation, err)
 	}
 
-	if err := ValidateIngredients(menuItem.Ingredients); err != nil {
-		return fmt.Errorf("%w: invalid ingredients: %v", ErrValidation, err)
+	// У комбо-набора своего рецепта может не быть: ингредиенты списываются по компонентам
+	if len(menuItem.BundleSlots) == 0 || len(menuItem.Ingredients) > 0 {
+		if err := ValidateIngredients(menuItem.Ingredients); err != nil {
+			return fmt.Errorf("%w: invalid ingredients: %v", ErrValidation, err)
+		}
+	}
+
+	if menuItem.TaxCategory != "" {
+		if err := ValidateTaxCategory(menuItem.TaxCategory); err != nil {
+			return fmt.Errorf("%w: invalid tax category: %v", ErrValidation, err)
+		}
 	}
 
 	return nil
 }
 
+var taxCategoryRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// ValidateTaxCategory проверяет ключ налоговой категории (drinks, food, ...)
+func ValidateTaxCategory(taxCategory string) error {
+	if !taxCategoryRegex.MatchString(taxCategory) {
+		return fmt.Errorf("tax category must be lowercase latin letters, digits or underscores (up to 50)")
+	}
+	return nil
+}
+
+var (
+	phoneRegex = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+	emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// ValidateCustomer проверяет карточку клиента; телефон и email необязательны
+func ValidateCustomer(customer models.Customer) error {
+	if err := IsValidName(customer.Name); err != nil {
+		return fmt.Errorf("%w: invalid name: %v", ErrValidation, err)
+	}
+	if customer.Phone != "" && !phoneRegex.MatchString(customer.Phone) {
+		return fmt.Errorf("%w: phone must contain 7 to 15 digits with an optional leading +", ErrValidation)
+	}
+	if customer.Email != "" && (len(customer.Email) > 100 || !emailRegex.MatchString(customer.Email)) {
+		return fmt.Errorf("%w: invalid email %q", ErrValidation, customer.Email)
+	}
+	return nil
+}
+
 func ValidateDescription(description string) error {
 	if description == "" {
 		return fmt.Errorf("description cannot be empty")
@@ -85,6 +125,11 @@ func ValidatePrice(price float64) error {
 	return nil
 }
 
+// RoundMoney округляет денежную сумму до копеек
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
 func ValidateIngredients(ingredients []models.MenuItemIngredient) error {
 	if len(ingredients) == 0 {
 		return fmt.Errorf("ingredients list cannot be empty")
@@ -125,6 +170,31 @@ func ValidateIngredient(ingredient models.MenuItemIngredient) error {
 	return nil
 }
 
+// NormalizeTags приводит аллергены или диеты к нижнему регистру, убирает повторы
+// и проверяет по списку allowed; результат идёт в порядке allowed, nil остаётся nil
+func NormalizeTags(tags []string, allowed []string, kind string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !slices.Contains(allowed, tag) {
+			return nil, fmt.Errorf("%w: unknown %s %q (allowed: %s)", ErrValidation, kind, tag, strings.Join(allowed, ", "))
+		}
+		seen[tag] = true
+	}
+
+	normalized := []string{}
+	for _, tag := range allowed {
+		if seen[tag] {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
 func ValidateID(id string) error {
 	if id == "" {
 		return fmt.Errorf("ID cannot be empty")